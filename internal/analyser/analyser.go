@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/db"
@@ -19,6 +21,22 @@ const (
 	ArgBaseBranch = "%BASE_BRANCH%"
 )
 
+// Default timeouts for each step of an analysis, used when the Config or
+// Tool does not specify its own.
+const (
+	DefaultCloneTimeout = 3 * time.Minute // DefaultCloneTimeout is the maximum duration of each clone, fetch or checkout command.
+	DefaultDepsTimeout  = 5 * time.Minute // DefaultDepsTimeout is the maximum duration of installing dependencies.
+	DefaultToolTimeout  = 3 * time.Minute // DefaultToolTimeout is the maximum duration of a single tool.
+)
+
+// localHeadRef is the local reference a pull request's head is fetched into,
+// when its head isn't a branch, such as a pull request from a fork.
+const localHeadRef = "refs/gopherci/head"
+
+// DefaultToolConcurrency is the maximum number of tools executed concurrently
+// within a single analysis, used when the Config does not specify its own.
+const DefaultToolConcurrency = 4
+
 // An Analyser is builds an isolated execution environment to run checks in.
 // It should provide isolation from other environments and support being
 // called concurrently.
@@ -28,35 +46,131 @@ type Analyser interface {
 	NewExecuter(ctx context.Context, goSrcPath string) (Executer, error)
 }
 
+// A VersionedAnalyser is an Analyser that can provide different versions of
+// Go for each executer.
+type VersionedAnalyser interface {
+	Analyser
+	// NewVersionedExecuter is the same as NewExecuter, but the Executer
+	// provides goVersion, such as "1.8". If goVersion is not available, the
+	// analyser's default is used.
+	NewVersionedExecuter(ctx context.Context, goSrcPath, goVersion string) (Executer, error)
+}
+
+// A RestrictedAnalyser is an Analyser that can provide executers with
+// reduced privileges, for untrusted code such as pull requests from forks.
+type RestrictedAnalyser interface {
+	Analyser
+	// NewRestrictedExecuter is the same as NewExecuter, but the Executer runs
+	// commands with reduced privileges. If the analyser is also a
+	// VersionedAnalyser, the Executer provides goVersion, if not empty.
+	NewRestrictedExecuter(ctx context.Context, goSrcPath, goVersion string) (Executer, error)
+}
+
+// A Reaper is an Analyser that can remove executers which were never
+// stopped, such as when GopherCI exits during an analysis.
+type Reaper interface {
+	// Reap removes all executers created before the time before, returning
+	// the number of executers removed. Executers should not be in use when
+	// reaped, so before should be earlier than the start of any analysis
+	// still running.
+	Reap(ctx context.Context, before time.Time) (int, error)
+}
+
 // Config hold configuration options for use in analyser. All options
-// are required.
+// are required, unless otherwise stated.
 type Config struct {
 	// EventType defines the type of event being processed.
 	EventType EventType
 	// BaseURL is the VCS fetchable base repo URL.
 	BaseURL string
 	// BaseRef is the reference we want to merge into, for EventTypePullRequest
-	// it's likely the branch, for EventTypePush it's a sha~number.
+	// it's likely the branch, for EventTypePush it's a sha~number. Not used
+	// for EventTypeFullScan.
 	BaseRef string
 	// HeadURL is the VCS fetchable repo URL containing the changes to be merged.
 	HeadURL string
-	// HeadRef is the name of the reference containing changes.
+	// HeadRef is the name of the reference containing changes. For
+	// EventTypePullRequest, this may be a full ref which isn't a branch, such
+	// as "refs/pull/1/head" for a pull request from a fork.
 	HeadRef string
 	// GoSrcPath is the repository's path when placed in $GOPATH/src.
 	GoSrcPath string
+	// CloneTimeout is the maximum duration of each command used to clone the
+	// repository. Optional, if zero DefaultCloneTimeout is used.
+	CloneTimeout time.Duration
+	// DepsTimeout is the maximum duration of installing dependencies.
+	// Optional, if zero DefaultDepsTimeout is used.
+	DepsTimeout time.Duration
+	// ToolTimeout is the maximum duration of a tool which does not have its
+	// own timeout. Optional, if zero DefaultToolTimeout is used.
+	ToolTimeout time.Duration
+	// ToolConcurrency is the maximum number of tools to execute concurrently.
+	// Optional, if zero DefaultToolConcurrency is used.
+	ToolConcurrency int
+	// GoVersion is the version of Go required by the repository, used if the
+	// analyser is a VersionedAnalyser. Optional, if empty the analyser's
+	// default is used.
+	GoVersion string
+	// Suppressed are the fingerprints of issues marked as false positives,
+	// which are removed from the results. Optional.
+	Suppressed map[string]bool
+	// Untrusted is true if the code being analysed is not trusted, such as a
+	// pull request from a fork. Untrusted code is only analysed if the
+	// analyser is a RestrictedAnalyser. Optional.
+	Untrusted bool
+	// GitToken authenticates the git commands which clone the repository,
+	// such as when the repository is private. The token is only provided to
+	// these commands, in their environment, which requires the analyser's
+	// executers to be EnvExecuters. Optional.
+	GitToken Secret
+	// Deps configures the installation of private dependencies, it's only
+	// provided to the command installing dependencies, in its environment,
+	// which requires the analyser's executers to be EnvExecuters. Deps are
+	// ignored if Untrusted is true. Optional.
+	Deps Deps
 }
 
-// Executer executes a single command in a contained environment.
+// Executer executes a single command in a contained environment. Execute
+// may be called concurrently, but not concurrently with Stop.
 type Executer interface {
 	// Execute executes a command and returns the combined stdout and stderr,
 	// along with an error if any. Must not be called after Stop(). If the
 	// command returns a non-zero exit code, an error of type NonZeroError
-	// is returned.
+	// is returned. If the context's deadline is exceeded before the command
+	// finishes, an error of type TimeoutError is returned. The output may be
+	// truncated if it's larger than MaxOutputSize.
 	Execute(context.Context, []string) ([]byte, error)
 	// Stop stops the executer and allows it to cleanup, if applicable.
 	Stop(context.Context) error
 }
 
+// An EnvExecuter is an Executer which can add environment variables to a
+// command, such as credentials which must not be visible in the command's
+// arguments.
+type EnvExecuter interface {
+	Executer
+	// ExecuteEnv is like Execute, but adds env, a list of "key=value"
+	// strings, to the command's environment.
+	ExecuteEnv(ctx context.Context, args []string, env []string) ([]byte, error)
+}
+
+// networkKey is the context key used by withNetwork.
+type networkKey struct{}
+
+// withNetwork returns a copy of ctx which grants network access to commands
+// executed with it, for executers which otherwise isolate commands from the
+// network. Only the commands to clone a repository and install its
+// dependencies are granted network access.
+func withNetwork(ctx context.Context) context.Context {
+	return context.WithValue(ctx, networkKey{}, true)
+}
+
+// networkGranted returns true if ctx was returned by withNetwork.
+func networkGranted(ctx context.Context) bool {
+	granted, _ := ctx.Value(networkKey{}).(bool)
+	return granted
+}
+
 // NonZeroError maybe returned by an Executer when the command executed returns
 // with a non-zero exit status.
 type NonZeroError struct {
@@ -69,6 +183,17 @@ func (e *NonZeroError) Error() string {
 	return fmt.Sprintf("%v returned exit code %v", e.args, e.ExitCode)
 }
 
+// TimeoutError maybe returned by an Executer when the command executed did
+// not finish before the context's deadline.
+type TimeoutError struct {
+	args []string
+}
+
+// Error implements the error interface.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v timed out", e.args)
+}
+
 // EventType defines the type of even which needs to be analysed, as there
 // maybe different or optimal methods based on the type.
 type EventType int
@@ -80,55 +205,108 @@ const (
 	EventTypePullRequest
 	// EventTypePush is a push.
 	EventTypePush
+	// EventTypeFullScan is a scan of the entire repository at HeadRef, all
+	// issues are reported, not just those introduced by a change.
+	EventTypeFullScan
 )
 
 // Analyse downloads a repository set in config in an environment provided by
 // analyser, running the series of tools. Writes results to provided analysis,
-// or an error.
+// or an error. Tools added by an installation are only executed if analyser is
+// a RestrictedAnalyser.
 func Analyse(ctx context.Context, analyser Analyser, tools []db.Tool, config Config, analysis *db.Analysis) error {
 	// Get a new executer/environment to execute in
-	exec, err := analyser.NewExecuter(ctx, config.GoSrcPath)
+	var (
+		exec Executer
+		err  error
+	)
+	va, versioned := analyser.(VersionedAnalyser)
+	ra, restricted := analyser.(RestrictedAnalyser)
+	installTools := installationTools(tools)
+	switch {
+	case config.Untrusted && !restricted:
+		return errors.New("analyser cannot restrict executers to analyse untrusted code")
+	case installTools && !restricted:
+		return errors.New("analyser cannot restrict executers to run installation tools")
+	case config.Untrusted, installTools:
+		exec, err = ra.NewRestrictedExecuter(ctx, config.GoSrcPath, config.GoVersion)
+	case versioned && config.GoVersion != "":
+		exec, err = va.NewVersionedExecuter(ctx, config.GoSrcPath, config.GoVersion)
+	default:
+		exec, err = analyser.NewExecuter(ctx, config.GoSrcPath)
+	}
 	if err != nil {
 		return errors.Wrap(err, "analyser could create new executer")
 	}
 
+	if config.CloneTimeout == 0 {
+		config.CloneTimeout = DefaultCloneTimeout
+	}
+	if config.DepsTimeout == 0 {
+		config.DepsTimeout = DefaultDepsTimeout
+	}
+	if config.ToolTimeout == 0 {
+		config.ToolTimeout = DefaultToolTimeout
+	}
+	if config.ToolConcurrency == 0 {
+		config.ToolConcurrency = DefaultToolConcurrency
+	}
+
 	var (
 		// baseRef is the reference to the base branch or before commit, the ref
 		// of the state before this PR/Push.
-		baseRef    string
-		start      = time.Now() // start of entire analysis
-		deltaStart = time.Now() // start of specific analysis
+		baseRef string
+		// headRef is the local reference to the changes, which differs from
+		// config.HeadRef when it's fetched into a local ref.
+		headRef    = config.HeadRef
+		cloneEnv   = cloneEnvironment(config.GitToken)
+		netCtx     = withNetwork(ctx) // netCtx grants network access to clone and install dependencies
+		start      = time.Now()       // start of entire analysis
+		deltaStart = time.Now()       // start of specific analysis
 	)
 	switch config.EventType {
 	case EventTypePullRequest:
 		// clone repo
-		args := []string{"git", "clone", "--depth", "1", "--branch", config.HeadRef, "--single-branch", config.HeadURL, "."}
-		out, err := exec.Execute(ctx, args)
-		if err != nil {
-			return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
+		cmds := [][]string{{"git", "clone", "--depth", "1", "--branch", config.HeadRef, "--single-branch", config.HeadURL, "."}}
+		if strings.HasPrefix(config.HeadRef, "refs/") {
+			// Refs which aren't branches can't be cloned, so fetch the ref
+			// into a local ref and checkout the local ref instead. FETCH_HEAD
+			// can't be used, as it's replaced when fetching the base.
+			headRef = localHeadRef
+			cmds = [][]string{
+				{"git", "init"},
+				{"git", "fetch", "--depth", "1", config.HeadURL, "+" + config.HeadRef + ":" + headRef},
+				{"git", "checkout", headRef},
+			}
+		}
+		for _, args := range cmds {
+			out, err := executeEnv(netCtx, exec, config.CloneTimeout, cloneEnv, args)
+			if err != nil {
+				return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
+			}
 		}
 
 		// This is a PR, fetch base as some tools (apicompat) needs to
 		// reference it.
-		args = []string{"git", "fetch", "--depth", "1", config.BaseURL, config.BaseRef}
-		out, err = exec.Execute(ctx, args)
+		args := []string{"git", "fetch", "--depth", "1", config.BaseURL, config.BaseRef}
+		out, err := executeEnv(netCtx, exec, config.CloneTimeout, cloneEnv, args)
 		if err != nil {
 			return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
 		}
 		baseRef = "FETCH_HEAD"
-	case EventTypePush:
+	case EventTypePush, EventTypeFullScan:
 		// clone repo, this cannot be shallow and needs access to all commits
 		// therefore cannot be shallow (or if it is, would required a very
 		// large depth and --no-single-branch).
 		args := []string{"git", "clone", config.HeadURL, "."}
-		out, err := exec.Execute(ctx, args)
+		out, err := executeEnv(netCtx, exec, config.CloneTimeout, cloneEnv, args)
 		if err != nil {
 			return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
 		}
 
 		// Checkout sha
 		args = []string{"git", "checkout", config.HeadRef}
-		out, err = exec.Execute(ctx, args)
+		out, err = executeEnv(netCtx, exec, config.CloneTimeout, cloneEnv, args)
 		if err != nil {
 			return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
 		}
@@ -138,17 +316,33 @@ func Analyse(ctx context.Context, analyser Analyser, tools []db.Tool, config Con
 	}
 	analysis.CloneDuration = db.Duration(time.Since(deltaStart))
 
-	// create a unified diff for use by revgrep
+	// create a unified diff for use by revgrep, full scans report all issues
+	// so don't have a patch.
+	var patch []byte
+	if config.EventType == EventTypeFullScan {
+		tools = fullScanTools(tools)
+	} else {
+		patch, err = getPatch(ctx, exec, baseRef, headRef)
+		if err != nil {
+			return errors.Wrap(err, "could not get patch")
+		}
+	}
 
-	patch, err := getPatch(ctx, exec, baseRef, config.HeadRef)
+	repoConfig, err := readRepoConfig(ctx, exec)
 	if err != nil {
-		return errors.Wrap(err, "could not get patch")
+		// Continue with the default configuration, the analysis is still
+		// useful even if some issues should have been ignored.
+		log.Printf("could not read repository config: %v", err)
 	}
 
 	// install dependencies, some static analysis tools require building a project
 	deltaStart = time.Now()
+	var depsEnv []string
+	if !config.Untrusted {
+		depsEnv = depsEnvironment(config.Deps)
+	}
 	args := []string{"install-deps.sh"}
-	out, err := exec.Execute(ctx, args)
+	out, err := executeEnv(netCtx, exec, config.DepsTimeout, depsEnv, args)
 	if err != nil {
 		return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
 	}
@@ -165,77 +359,293 @@ func Analyse(ctx context.Context, analyser Analyser, tools []db.Tool, config Con
 	}
 	pwd := string(bytes.TrimSpace(out))
 
+	// Tools only read the source, so execute them concurrently in the same
+	// executer. Each result is stored by its tool's position and only added
+	// to the analysis once all tools have finished, so the results don't
+	// depend on the order the tools finish in.
+	var (
+		results = make([]db.AnalysisTool, len(tools))
+		sem     = make(chan struct{}, config.ToolConcurrency)
+		wg      sync.WaitGroup
+	)
+	for i, tool := range tools {
+		timeout := config.ToolTimeout
+		if tool.Timeout > 0 {
+			timeout = time.Duration(tool.Timeout)
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, tool db.Tool, timeout time.Duration) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = runTool(ctx, exec, tool, timeout, baseRef, pwd, patch)
+		}(i, tool, timeout)
+	}
+	wg.Wait()
+
+	for i, tool := range tools {
+		analysis.Tools[tool.ID] = results[i]
+	}
+
+	// Remove issues in generated or ignored files, once for all tools, so
+	// each file only needs to be read once.
+	filterIssues(ctx, exec, repoConfig, analysis.Tools)
+
+	// Read the files with issues, and the changed files which may have new
+	// directives, once to apply directives and to fingerprint the remaining
+	// issues, so they can be tracked across commits.
+	files, err := readFiles(ctx, exec, sourcePaths(analysis.Tools, patch), sourceFileSize)
+	if err != nil {
+		log.Printf("could not read files to apply directives and fingerprint issues: %v", err)
+	}
+	applyDirectives(tools, analysis.Tools, files, patch)
+	fingerprintIssues(analysis.Tools, files)
+	suppressIssues(analysis.Tools, config.Suppressed)
+
+	log.Printf("stopping executer")
+	if err := exec.Stop(ctx); err != nil {
+		log.Printf("warning: could not stop executer: %v", err)
+	}
+	log.Printf("finished stopping executer")
+
+	analysis.TotalDuration = db.Duration(time.Since(start))
+	return nil
+}
+
+// filterIssues removes issues from each of the tools which are in ignored
+// paths, or in files which are generated.
+func filterIssues(ctx context.Context, exec Executer, repoConfig RepoConfig, tools map[db.ToolID]db.AnalysisTool) {
+	var paths []string
 	for _, tool := range tools {
-		deltaStart = time.Now()
-		args := []string{tool.Path}
-		for _, arg := range strings.Fields(tool.Args) {
-			switch arg {
-			case ArgBaseBranch: // TODO change to ArgBaseRef
-				// Tool wants the base ref name as a flag
-				arg = baseRef
+		for _, issue := range tool.Issues {
+			if !repoConfig.isIgnored(issue.Path) {
+				paths = append(paths, issue.Path)
 			}
-			args = append(args, arg)
-		}
-		out, err := exec.Execute(ctx, args)
-		switch err.(type) {
-		case nil, *NonZeroError:
-			// Ignore non-zero exit codes from tools, these are often normal.
-		default:
-			return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
 		}
-		log.Printf("%v output:\n%s", tool.Name, out)
+	}
 
-		checker := revgrep.Checker{
-			Patch:   bytes.NewReader(patch),
-			Regexp:  tool.Regexp,
-			AbsPath: pwd,
+	generated, err := generatedFiles(ctx, exec, paths)
+	if err != nil {
+		// Keep the issues, it's better to report an issue in a generated file
+		// than to hide issues in files which are not generated.
+		log.Printf("could not detect generated files: %v", err)
+	}
+
+	for toolID, tool := range tools {
+		var issues []db.Issue
+		for _, issue := range tool.Issues {
+			if repoConfig.isIgnored(issue.Path) || generated[issue.Path] {
+				continue
+			}
+			issues = append(issues, issue)
 		}
+		tool.Issues = issues
+		tools[toolID] = tool
+	}
+}
 
-		revIssues, err := checker.Check(bytes.NewReader(out), ioutil.Discard)
-		if err != nil {
-			return err
+// sourcePaths returns the paths of the files with issues, and the files
+// changed in patch.
+func sourcePaths(tools map[db.ToolID]db.AnalysisTool, patch []byte) []string {
+	paths := patchPaths(patch)
+	for _, tool := range tools {
+		for _, issue := range tool.Issues {
+			paths = append(paths, issue.Path)
 		}
-		log.Printf("revgrep found %v issues", len(revIssues))
+	}
+	return paths
+}
 
+// suppressIssues removes issues from each of the tools which have a
+// suppressed fingerprint.
+func suppressIssues(tools map[db.ToolID]db.AnalysisTool, suppressed map[string]bool) {
+	if len(suppressed) == 0 {
+		return
+	}
+	for toolID, tool := range tools {
 		var issues []db.Issue
-		for _, issue := range revIssues {
-			// Remove issues in generated files, isFileGenereated will return
-			// 0 for file is generated or 1 for file is not generated.
-			args = []string{"isFileGenerated", pwd, issue.File}
-			out, err := exec.Execute(ctx, args)
-			log.Printf("isFileGenerated output: %s", bytes.TrimSpace(out))
-			switch err {
-			case nil:
-				continue // file is generated, ignore the issue
-			default:
-				if etype, ok := err.(*NonZeroError); ok && etype.ExitCode == 1 {
-					break // file is not generated, record the issue
-				}
-				return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
+		for _, issue := range tool.Issues {
+			if suppressed[issue.Fingerprint] {
+				log.Printf("%v: suppressed issue %q", issue.Path, issue.Issue)
+				continue
 			}
+			issues = append(issues, issue)
+		}
+		tool.Issues = issues
+		tools[toolID] = tool
+	}
+}
 
-			issues = append(issues, db.Issue{
-				Path:    issue.File,
-				Line:    issue.LineNo,
-				HunkPos: issue.HunkPos,
-				Issue:   fmt.Sprintf("%s: %s", tool.Name, issue.Message),
-			})
+// installationTools returns true if any of the tools were added by an
+// installation, rather than by GopherCI's operator. Installation tools are
+// untrusted, so must only be executed with restricted privileges.
+func installationTools(tools []db.Tool) bool {
+	for _, tool := range tools {
+		if tool.InstallationID != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fullScanTools returns the tools which can be used in a full scan, tools
+// which compare against the base ref are excluded as there's no base ref.
+func fullScanTools(tools []db.Tool) []db.Tool {
+	var scanTools []db.Tool
+	for _, tool := range tools {
+		if !strings.Contains(tool.Args, ArgBaseBranch) {
+			scanTools = append(scanTools, tool)
 		}
+	}
+	return scanTools
+}
 
-		analysis.Tools[tool.ID] = db.AnalysisTool{
-			Duration: db.Duration(time.Since(deltaStart)),
+// runTool executes a single tool and returns the issues it found in patch,
+// or if patch is nil, all issues it found in the repository. Failures are
+// recorded in the returned AnalysisTool's Status instead of being returned as
+// an error, so one broken tool does not prevent the remaining tools from
+// running and reporting their issues.
+func runTool(ctx context.Context, exec Executer, tool db.Tool, timeout time.Duration, baseRef, pwd string, patch []byte) db.AnalysisTool {
+	start := time.Now()
+	result := func(status db.AnalysisToolStatus, issues []db.Issue) db.AnalysisTool {
+		return db.AnalysisTool{
+			Duration: db.Duration(time.Since(start)),
+			Status:   status,
 			Issues:   issues,
 		}
 	}
 
-	log.Printf("stopping executer")
-	if err := exec.Stop(ctx); err != nil {
-		log.Printf("warning: could not stop executer: %v", err)
+	if ctx.Err() != nil {
+		// The entire analysis has run out of time, don't try to run the tool.
+		log.Printf("skipping %v: %v", tool.Name, ctx.Err())
+		return result(db.AnalysisToolStatusSkipped, nil)
 	}
-	log.Printf("finished stopping executer")
 
-	analysis.TotalDuration = db.Duration(time.Since(start))
-	return nil
+	args := []string{tool.Path}
+	for _, arg := range strings.Fields(tool.Args) {
+		switch arg {
+		case ArgBaseBranch: // TODO change to ArgBaseRef
+			// Tool wants the base ref name as a flag
+			arg = baseRef
+		}
+		args = append(args, arg)
+	}
+
+	out, err := executeTimeout(ctx, exec, timeout, args)
+	switch err.(type) {
+	case nil, *NonZeroError:
+		// Ignore non-zero exit codes from tools, these are often normal.
+	case *TimeoutError:
+		if ctx.Err() != nil {
+			// The entire analysis ran out of time, not just the tool.
+			log.Printf("skipping %v: %v", tool.Name, ctx.Err())
+			return result(db.AnalysisToolStatusSkipped, nil)
+		}
+		log.Printf("%v timed out after %v, output:\n%s", tool.Name, timeout, out)
+		return result(db.AnalysisToolStatusTimeout, nil)
+	default:
+		log.Printf("%v failed, could not execute %v: %s\n%s", tool.Name, args, err, out)
+		return result(db.AnalysisToolStatusFailure, nil)
+	}
+	log.Printf("%v output:\n%s", tool.Name, out)
+
+	if patch == nil {
+		issues, err := repoIssues(tool, pwd, out)
+		if err != nil {
+			log.Printf("%v failed, could not parse output: %v", tool.Name, err)
+			return result(db.AnalysisToolStatusFailure, nil)
+		}
+		log.Printf("%v: found %v issues in repository", tool.Name, len(issues))
+		return result(db.AnalysisToolStatusSuccess, issues)
+	}
+
+	checker := revgrep.Checker{
+		Patch:   bytes.NewReader(patch),
+		Regexp:  tool.Regexp,
+		AbsPath: pwd,
+	}
+
+	revIssues, err := checker.Check(bytes.NewReader(out), ioutil.Discard)
+	if err != nil {
+		log.Printf("%v failed, revgrep could not check output: %v", tool.Name, err)
+		return result(db.AnalysisToolStatusFailure, nil)
+	}
+	log.Printf("%v: revgrep found %v issues", tool.Name, len(revIssues))
+
+	var issues []db.Issue
+	for _, issue := range revIssues {
+		issues = append(issues, db.Issue{
+			Path:    issue.File,
+			Line:    issue.LineNo,
+			HunkPos: issue.HunkPos,
+			Issue:   fmt.Sprintf("%s: %s", tool.Name, issue.Message),
+		})
+	}
+
+	return result(db.AnalysisToolStatusSuccess, issues)
+}
+
+// repoIssues parses a tool's output and returns all the issues in files within
+// the repository at pwd. Absolute paths are made relative to pwd, the same as
+// revgrep does for issues in a patch.
+func repoIssues(tool db.Tool, pwd string, out []byte) ([]db.Issue, error) {
+	parsed, err := ParseOutput(tool.Regexp, out)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []db.Issue
+	for _, issue := range parsed {
+		path := issue.File
+		if filepath.IsAbs(path) {
+			if path, err = filepath.Rel(pwd, path); err != nil {
+				continue
+			}
+		}
+		path = filepath.Clean(path)
+		if strings.HasPrefix(path, "..") {
+			// Outside the repository, such as an issue in a dependency.
+			continue
+		}
+		issues = append(issues, db.Issue{
+			Path:  filepath.ToSlash(path),
+			Line:  issue.Line,
+			Issue: fmt.Sprintf("%s: %s", tool.Name, issue.Message),
+		})
+	}
+	return issues, nil
+}
+
+// executeTimeout executes args using exec, cancelling the command if it has
+// not finished before timeout.
+func executeTimeout(ctx context.Context, exec Executer, timeout time.Duration, args []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return exec.Execute(ctx, args)
+}
+
+// killAfter is the duration a command has to exit after it's terminated by
+// timeoutCmd, before it's killed.
+const killAfter = 5 * time.Second
+
+// timeoutCmd returns cmd wrapped with the timeout command, so cmd and the
+// processes it started are terminated once ctx's deadline is exceeded, as
+// cancelling an exec in a container doesn't stop its process. If ctx has no
+// deadline, cmd is returned unchanged.
+func timeoutCmd(ctx context.Context, cmd []string) []string {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return cmd
+	}
+	// Round up, so the command isn't terminated before the deadline.
+	seconds := (time.Until(deadline) + time.Second - 1) / time.Second
+	if seconds < 1 {
+		seconds = 1
+	}
+	return append([]string{"timeout", fmt.Sprintf("--kill-after=%ds", killAfter/time.Second), fmt.Sprintf("%ds", seconds)}, cmd...)
 }
 
 func getPatch(ctx context.Context, exec Executer, baseRef, headRef string) ([]byte, error) {
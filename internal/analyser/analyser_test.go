@@ -2,15 +2,24 @@ package analyser
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/db"
 )
 
 type mockAnalyser struct {
+	mu         sync.Mutex // protects all fields below
 	Executed   [][]string
+	Networked  [][]string // Networked are the commands granted network access
 	ExecuteOut [][]byte
 	ExecuteErr []error
 	Stopped    bool
@@ -24,8 +33,13 @@ func (a *mockAnalyser) NewExecuter(_ context.Context, _ string) (Executer, error
 	return a, nil
 }
 
-func (a *mockAnalyser) Execute(_ context.Context, args []string) (out []byte, err error) {
+func (a *mockAnalyser) Execute(ctx context.Context, args []string) (out []byte, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.Executed = append(a.Executed, args)
+	if networkGranted(ctx) {
+		a.Networked = append(a.Networked, args)
+	}
 	out, a.ExecuteOut = a.ExecuteOut[0], a.ExecuteOut[1:]
 	err, a.ExecuteErr = a.ExecuteErr[0], a.ExecuteErr[1:]
 	return out, err
@@ -43,6 +57,9 @@ func TestAnalyse_pr(t *testing.T) {
 		BaseRef:   "base-branch",
 		HeadURL:   "head-url",
 		HeadRef:   "head-branch",
+		// Tools are executed one at a time so mockAnalyser's outputs are
+		// returned in order.
+		ToolConcurrency: 1,
 	}
 
 	tools := []db.Tool{
@@ -57,34 +74,50 @@ index 0000000..6362395
 --- /dev/null
 +++ b/main.go
 @@ -0,0 +1,1 @@
++var _ = fmt.Sprintln()
+diff --git a/subdir/gen.go b/subdir/gen.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/gen.go
+@@ -0,0 +1,1 @@
 +var _ = fmt.Sprintln()`)
 
+	head := []byte(`==> gen.go <==
+// Code generated by tool. DO NOT EDIT.
+
+package main
+
+==> main.go <==
+package main
+`)
+
 	analyser := &mockAnalyser{
 		ExecuteOut: [][]byte{
 			{},   // git clone
 			{},   // git fetch
 			diff, // git diff
+			{},   // cat .gopherci.yml
 			{},   // install-deps.sh
 			[]byte(`/go/src/gopherci`),                   // pwd
 			[]byte("main.go:1: error1"),                  // tool 1
-			[]byte("file is not generated"),              // isFileGenerated
 			[]byte("/go/src/gopherci/main.go:1: error2"), // tool 2 output abs paths
-			[]byte("file is not generated"),              // isFileGenerated
-			[]byte("main.go:1: error3"),                  // tool 3 tested a generated file
-			[]byte("file is generated"),                  // isFileGenerated
+			[]byte("gen.go:1: error3"),                   // tool 3 tested a generated file
+			head, // head
+			[]byte("==> main.go <==\npackage main\n"), // head source files
 		},
 		ExecuteErr: []error{
 			nil, // git clone
 			nil, // git fetch
 			nil, // git diff
+			&NonZeroError{ExitCode: 1}, // cat .gopherci.yml - no such file
 			nil, // install-deps.sh
 			nil, // pwd
 			nil, // tool 1
-			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
 			nil, // tool 2 output abs paths
-			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
 			nil, // tool 3 tested a generated file
-			nil, // isFileGenerated - generated
+			nil, // head
+			nil, // head source files
 		},
 	}
 
@@ -101,6 +134,7 @@ index 0000000..6362395
 		2: []db.Issue{{Path: "main.go", Line: 1, HunkPos: 1, Issue: "Name2: error2"}},
 		3: nil,
 	}
+	setFingerprints(want, map[string][]string{"main.go": {"package main"}})
 	for toolID, issues := range want {
 		if have := analysis.Tools[toolID].Issues; !reflect.DeepEqual(issues, have) {
 			t.Errorf("unexpected issues for toolID %v\nwant: %+v\nhave: %+v", toolID, issues, have)
@@ -118,19 +152,25 @@ index 0000000..6362395
 		{"git", "clone", "--depth", "1", "--branch", cfg.HeadRef, "--single-branch", cfg.HeadURL, "."},
 		{"git", "fetch", "--depth", "1", cfg.BaseURL, cfg.BaseRef},
 		{"git", "diff", fmt.Sprintf("FETCH_HEAD...%v", cfg.HeadRef)},
+		{"cat", ".gopherci.yml"},
 		{"install-deps.sh"},
 		{"pwd"},
 		{"tool1", "-flag", "FETCH_HEAD", "./..."},
-		{"isFileGenerated", "/go/src/gopherci", "main.go"},
 		{"tool2"},
-		{"isFileGenerated", "/go/src/gopherci", "main.go"},
 		{"tool3"},
-		{"isFileGenerated", "/go/src/gopherci", "main.go"},
+		{"head", "-v", "-c", "32768", "--", "gen.go", "main.go"},
+		{"head", "-v", "-c", "1048576", "--", "gen.go", "main.go"},
 	}
 
 	if !reflect.DeepEqual(analyser.Executed, expectedArgs) {
 		t.Errorf("\nhave %v\nwant %v", analyser.Executed, expectedArgs)
 	}
+
+	// Only cloning and installing dependencies is granted network access.
+	expectedNetworked := [][]string{expectedArgs[0], expectedArgs[1], expectedArgs[4]}
+	if !reflect.DeepEqual(analyser.Networked, expectedNetworked) {
+		t.Errorf("networked\nhave %v\nwant %v", analyser.Networked, expectedNetworked)
+	}
 }
 
 func TestAnalyse_push(t *testing.T) {
@@ -140,6 +180,9 @@ func TestAnalyse_push(t *testing.T) {
 		BaseRef:   "abcde~1",
 		HeadURL:   "head-url",
 		HeadRef:   "abcde",
+		// Tools are executed one at a time so mockAnalyser's outputs are
+		// returned in order.
+		ToolConcurrency: 1,
 	}
 
 	tools := []db.Tool{
@@ -154,34 +197,50 @@ index 0000000..6362395
 --- /dev/null
 +++ b/main.go
 @@ -0,0 +1,1 @@
++var _ = fmt.Sprintln()
+diff --git a/subdir/gen.go b/subdir/gen.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/gen.go
+@@ -0,0 +1,1 @@
 +var _ = fmt.Sprintln()`)
 
+	head := []byte(`==> gen.go <==
+// Code generated by tool. DO NOT EDIT.
+
+package main
+
+==> main.go <==
+package main
+`)
+
 	analyser := &mockAnalyser{
 		ExecuteOut: [][]byte{
 			{},   // git clone
 			{},   // git checkout
 			diff, // git diff
+			{},   // cat .gopherci.yml
 			{},   // install-deps.sh
 			[]byte(`/go/src/gopherci`),                   // pwd
 			[]byte("main.go:1: error1"),                  // tool 1
-			[]byte("file is not generated"),              // isFileGenerated
 			[]byte("/go/src/gopherci/main.go:1: error2"), // tool 2 output abs paths
-			[]byte("file is not generated"),              // isFileGenerated
-			[]byte("main.go:1: error3"),                  // tool 3 tested a generated file
-			[]byte("file is generated"),                  // isFileGenerated
+			[]byte("gen.go:1: error3"),                   // tool 3 tested a generated file
+			head, // head
+			[]byte("==> main.go <==\npackage main\n"), // head source files
 		},
 		ExecuteErr: []error{
 			nil, // git clone
 			nil, // git checkout
 			nil, // git diff
+			&NonZeroError{ExitCode: 1}, // cat .gopherci.yml - no such file
 			nil, // install-deps.sh
 			nil, // pwd
 			nil, // tool 1
-			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
 			nil, // tool 2 output abs paths
-			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
 			nil, // tool 3 tested a generated file
-			nil, // isFileGenerated - generated
+			nil, // head
+			nil, // head source files
 		},
 	}
 
@@ -198,6 +257,7 @@ index 0000000..6362395
 		2: []db.Issue{{Path: "main.go", Line: 1, HunkPos: 1, Issue: "Name2: error2"}},
 		3: nil,
 	}
+	setFingerprints(want, map[string][]string{"main.go": {"package main"}})
 	for toolID, issues := range want {
 		if have := analysis.Tools[toolID].Issues; !reflect.DeepEqual(issues, have) {
 			t.Errorf("unexpected issues for toolID %v\nwant: %+v\nhave: %+v", toolID, issues, have)
@@ -215,14 +275,14 @@ index 0000000..6362395
 		{"git", "clone", cfg.HeadURL, "."},
 		{"git", "checkout", cfg.HeadRef},
 		{"git", "diff", fmt.Sprintf("%v...%v", cfg.BaseRef, cfg.HeadRef)},
+		{"cat", ".gopherci.yml"},
 		{"install-deps.sh"},
 		{"pwd"},
 		{"tool1", "-flag", "abcde~1", "./..."},
-		{"isFileGenerated", "/go/src/gopherci", "main.go"},
 		{"tool2"},
-		{"isFileGenerated", "/go/src/gopherci", "main.go"},
 		{"tool3"},
-		{"isFileGenerated", "/go/src/gopherci", "main.go"},
+		{"head", "-v", "-c", "32768", "--", "gen.go", "main.go"},
+		{"head", "-v", "-c", "1048576", "--", "gen.go", "main.go"},
 	}
 
 	if !reflect.DeepEqual(analyser.Executed, expectedArgs) {
@@ -230,6 +290,659 @@ index 0000000..6362395
 	}
 }
 
+func TestAnalyse_fullScan(t *testing.T) {
+	cfg := Config{
+		EventType:       EventTypeFullScan,
+		BaseURL:         "base-url",
+		HeadURL:         "head-url",
+		HeadRef:         "abcde",
+		ToolConcurrency: 1,
+	}
+
+	tools := []db.Tool{
+		{ID: 1, Name: "Name1", Path: "tool1", Args: "-flag %BASE_BRANCH% ./..."},
+		{ID: 2, Name: "Name2", Path: "tool2"},
+		{ID: 3, Name: "Name3", Path: "tool3"},
+	}
+
+	head := []byte(`==> gen.go <==
+// Code generated by tool. DO NOT EDIT.
+
+package main
+
+==> main.go <==
+package main
+
+==> sub/b.go <==
+package sub
+`)
+
+	analyser := &mockAnalyser{
+		ExecuteOut: [][]byte{
+			{}, // git clone
+			{}, // git checkout
+			{}, // cat .gopherci.yml
+			{}, // install-deps.sh
+			[]byte(`/go/src/gopherci`), // pwd
+			[]byte("/go/src/gopherci/main.go:1:5: error2\n/go/src/other/dep.go:3: dep\nsub/b.go:2: error4"), // tool 2
+			[]byte("gen.go:1: error3"), // tool 3 tested a generated file
+			head, // head
+			[]byte("==> main.go <==\npackage main\n\n==> sub/b.go <==\npackage sub\n\nvar _ = 1\n"), // head source files
+		},
+		ExecuteErr: []error{
+			nil, // git clone
+			nil, // git checkout
+			&NonZeroError{ExitCode: 1}, // cat .gopherci.yml - no such file
+			nil, // install-deps.sh
+			nil, // pwd
+			nil, // tool 2
+			nil, // tool 3
+			nil, // head
+			nil, // head source files
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	err := Analyse(context.Background(), analyser, tools, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// tool 1 requires a base ref, so isn't used in a full scan
+	want := map[db.ToolID][]db.Issue{
+		2: []db.Issue{
+			{Path: "main.go", Line: 1, Issue: "Name2: error2"},
+			{Path: "sub/b.go", Line: 2, Issue: "Name2: error4"},
+		},
+		3: nil,
+	}
+	setFingerprints(want, map[string][]string{"main.go": {"package main"}, "sub/b.go": {"package sub", "", "var _ = 1"}})
+	for toolID, issues := range want {
+		if have := analysis.Tools[toolID].Issues; !reflect.DeepEqual(issues, have) {
+			t.Errorf("unexpected issues for toolID %v\nwant: %+v\nhave: %+v", toolID, issues, have)
+		}
+	}
+	if len(analysis.Tools) != len(want) {
+		t.Errorf("analysis has %v tools want %v", len(analysis.Tools), len(want))
+	}
+
+	expectedArgs := [][]string{
+		{"git", "clone", cfg.HeadURL, "."},
+		{"git", "checkout", cfg.HeadRef},
+		{"cat", ".gopherci.yml"},
+		{"install-deps.sh"},
+		{"pwd"},
+		{"tool2"},
+		{"tool3"},
+		{"head", "-v", "-c", "32768", "--", "gen.go", "main.go", "sub/b.go"},
+		{"head", "-v", "-c", "1048576", "--", "main.go", "sub/b.go"},
+	}
+
+	if !reflect.DeepEqual(analyser.Executed, expectedArgs) {
+		t.Errorf("\nhave %v\nwant %v", analyser.Executed, expectedArgs)
+	}
+}
+
+// setFingerprints sets the expected fingerprint of each of the issues, using
+// the lines of each file.
+func setFingerprints(issues map[db.ToolID][]db.Issue, files map[string][]string) {
+	for _, toolIssues := range issues {
+		for i, issue := range toolIssues {
+			toolIssues[i].Fingerprint = fingerprint(issue, files[issue.Path])
+		}
+	}
+}
+
+func TestAnalyse_toolTimeout(t *testing.T) {
+	cfg := Config{
+		EventType: EventTypePush,
+		BaseURL:   "base-url",
+		BaseRef:   "abcde~1",
+		HeadURL:   "head-url",
+		HeadRef:   "abcde",
+		// Tools are executed one at a time so mockAnalyser's outputs are
+		// returned in order.
+		ToolConcurrency: 1,
+	}
+
+	tools := []db.Tool{
+		{ID: 1, Name: "Name1", Path: "tool1"},
+		{ID: 2, Name: "Name2", Path: "tool2"},
+	}
+
+	diff := []byte(`diff --git a/subdir/main.go b/subdir/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++var _ = fmt.Sprintln()`)
+
+	analyser := &mockAnalyser{
+		ExecuteOut: [][]byte{
+			{},                              // git clone
+			{},                              // git checkout
+			diff,                            // git diff
+			{},                              // cat .gopherci.yml
+			{},                              // install-deps.sh
+			[]byte(`/go/src/gopherci`),      // pwd
+			{},                              // tool 1 timed out
+			[]byte("main.go:1: error2"),     // tool 2
+			[]byte("==> main.go <==\n"),    // head
+			[]byte("==> main.go <==\n"),    // head source files
+		},
+		ExecuteErr: []error{
+			nil,                        // git clone
+			nil,                        // git checkout
+			nil,                        // git diff
+			&NonZeroError{ExitCode: 1}, // cat .gopherci.yml - no such file
+			nil,                        // install-deps.sh
+			nil,                        // pwd
+			&TimeoutError{},            // tool 1 timed out
+			nil,                        // tool 2
+			nil,                        // head
+			nil,                        // head source files
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	err := Analyse(context.Background(), analyser, tools, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := map[db.ToolID]db.AnalysisToolStatus{
+		1: db.AnalysisToolStatusTimeout,
+		2: db.AnalysisToolStatusSuccess,
+	}
+	for toolID, status := range want {
+		if have := analysis.Tools[toolID].Status; have != status {
+			t.Errorf("unexpected status for toolID %v, have: %v want: %v", toolID, have, status)
+		}
+	}
+	if have := len(analysis.Tools[2].Issues); have != 1 {
+		t.Errorf("toolID 2 has %v issues want 1", have)
+	}
+}
+
+func TestAnalyse_toolFailure(t *testing.T) {
+	cfg := Config{
+		EventType: EventTypePush,
+		BaseURL:   "base-url",
+		BaseRef:   "abcde~1",
+		HeadURL:   "head-url",
+		HeadRef:   "abcde",
+		// Tools are executed one at a time so mockAnalyser's outputs are
+		// returned in order.
+		ToolConcurrency: 1,
+	}
+
+	tools := []db.Tool{
+		{ID: 1, Name: "Name1", Path: "tool1"},
+		{ID: 2, Name: "Name2", Path: "tool2", Regexp: "("},
+		{ID: 3, Name: "Name3", Path: "tool3"},
+	}
+
+	diff := []byte(`diff --git a/subdir/main.go b/subdir/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++var _ = fmt.Sprintln()`)
+
+	analyser := &mockAnalyser{
+		ExecuteOut: [][]byte{
+			{},                              // git clone
+			{},                              // git checkout
+			diff,                            // git diff
+			{},                              // cat .gopherci.yml
+			{},                              // install-deps.sh
+			[]byte(`/go/src/gopherci`),      // pwd
+			{},                              // tool 1 could not execute
+			[]byte("main.go:1: error2"),     // tool 2 invalid regexp
+			[]byte("main.go:1: error3"),     // tool 3
+			[]byte("==> main.go <==\n"),    // head
+			[]byte("==> main.go <==\n"),    // head source files
+		},
+		ExecuteErr: []error{
+			nil,                        // git clone
+			nil,                        // git checkout
+			nil,                        // git diff
+			&NonZeroError{ExitCode: 1}, // cat .gopherci.yml - no such file
+			nil,                        // install-deps.sh
+			nil,                        // pwd
+			errors.New("exec failed"),  // tool 1 could not execute
+			nil,                        // tool 2 invalid regexp
+			nil,                        // tool 3
+			nil,                        // head
+			nil,                        // head source files
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	err := Analyse(context.Background(), analyser, tools, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := map[db.ToolID]db.AnalysisToolStatus{
+		1: db.AnalysisToolStatusFailure,
+		2: db.AnalysisToolStatusFailure,
+		3: db.AnalysisToolStatusSuccess,
+	}
+	for toolID, status := range want {
+		if have := analysis.Tools[toolID].Status; have != status {
+			t.Errorf("unexpected status for toolID %v, have: %v want: %v", toolID, have, status)
+		}
+	}
+	if have := len(analysis.Tools[3].Issues); have != 1 {
+		t.Errorf("toolID 3 has %v issues want 1", have)
+	}
+}
+
+func TestAnalyse_toolSkipped(t *testing.T) {
+	cfg := Config{
+		EventType: EventTypePush,
+		BaseURL:   "base-url",
+		BaseRef:   "abcde~1",
+		HeadURL:   "head-url",
+		HeadRef:   "abcde",
+		// Tools are executed one at a time so mockAnalyser's outputs are
+		// returned in order.
+		ToolConcurrency: 1,
+	}
+
+	tools := []db.Tool{
+		{ID: 1, Name: "Name1", Path: "tool1"},
+	}
+
+	analyser := &mockAnalyser{
+		ExecuteOut: [][]byte{
+			{}, // git clone
+			{}, // git checkout
+			{}, // git diff
+			{}, // cat .gopherci.yml
+			{}, // install-deps.sh
+			{}, // pwd
+		},
+		ExecuteErr: []error{
+			nil, // git clone
+			nil, // git checkout
+			nil, // git diff
+			nil, // cat .gopherci.yml
+			nil, // install-deps.sh
+			nil, // pwd
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	// The mock executer ignores the context, so the analysis runs out of
+	// time just before the tools are executed.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Analyse(ctx, analyser, tools, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if have, want := analysis.Tools[1].Status, db.AnalysisToolStatusSkipped; have != want {
+		t.Errorf("unexpected status have: %v want: %v", have, want)
+	}
+}
+
+// cancelExecuter is an Executer which cancels the analysis' context while
+// executing a command, as if the analysis ran out of time.
+type cancelExecuter struct {
+	cancel context.CancelFunc
+}
+
+func (e *cancelExecuter) Execute(_ context.Context, args []string) ([]byte, error) {
+	e.cancel()
+	return nil, &TimeoutError{args: args}
+}
+
+func (e *cancelExecuter) Stop(_ context.Context) error {
+	return nil
+}
+
+func TestRunTool_analysisTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tool := db.Tool{ID: 1, Name: "Name1", Path: "tool1"}
+	result := runTool(ctx, &cancelExecuter{cancel: cancel}, tool, time.Minute, "", "", nil)
+
+	if have, want := result.Status, db.AnalysisToolStatusSkipped; have != want {
+		t.Errorf("unexpected status have: %v want: %v", have, want)
+	}
+}
+
+// concurrentExecuter is an Executer which responds based on the command
+// executed and records the maximum number of concurrent commands.
+type concurrentExecuter struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (e *concurrentExecuter) NewExecuter(_ context.Context, _ string) (Executer, error) {
+	return e, nil
+}
+
+func (e *concurrentExecuter) Execute(_ context.Context, args []string) ([]byte, error) {
+	e.mu.Lock()
+	e.running++
+	if e.running > e.max {
+		e.max = e.running
+	}
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		e.running--
+		e.mu.Unlock()
+	}()
+
+	switch args[0] {
+	case "git":
+		return []byte(`diff --git a/main.go b/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++var _ = fmt.Sprintln()`), nil
+	case "pwd":
+		return []byte("/go/src/gopherci"), nil
+	case "cat":
+		return nil, &NonZeroError{ExitCode: 1}
+	case "head":
+		return []byte("==> main.go <==\npackage main\n"), nil
+	case "install-deps.sh":
+		return nil, nil
+	}
+	// A tool, give other tools a chance to start.
+	time.Sleep(10 * time.Millisecond)
+	return []byte(fmt.Sprintf("main.go:1: %s", args[0])), nil
+}
+
+func (e *concurrentExecuter) Stop(_ context.Context) error { return nil }
+
+func TestAnalyse_concurrent(t *testing.T) {
+	cfg := Config{
+		EventType:       EventTypePush,
+		BaseURL:         "base-url",
+		BaseRef:         "abcde~1",
+		HeadURL:         "head-url",
+		HeadRef:         "abcde",
+		ToolConcurrency: 2,
+	}
+
+	var tools []db.Tool
+	for i := 1; i <= 5; i++ {
+		tools = append(tools, db.Tool{ID: db.ToolID(i), Name: fmt.Sprintf("Name%d", i), Path: fmt.Sprintf("tool%d", i)})
+	}
+
+	exec := &concurrentExecuter{}
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	err := Analyse(context.Background(), exec, tools, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if exec.max > cfg.ToolConcurrency {
+		t.Errorf("executed %v commands concurrently, want at most %v", exec.max, cfg.ToolConcurrency)
+	}
+
+	var want []db.Issue
+	for _, tool := range tools {
+		issue := db.Issue{Path: "main.go", Line: 1, HunkPos: 1, Issue: fmt.Sprintf("%s: %s", tool.Name, tool.Path)}
+		issue.Fingerprint = fingerprint(issue, []string{"package main"})
+		want = append(want, issue)
+	}
+	if have := analysis.Issues(); !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+// versionedAnalyser is a mockAnalyser which records the Go version requested.
+type versionedAnalyser struct {
+	*mockAnalyser
+	goVersion string
+}
+
+func (a *versionedAnalyser) NewVersionedExecuter(ctx context.Context, goSrcPath, goVersion string) (Executer, error) {
+	a.goVersion = goVersion
+	return a.NewExecuter(ctx, goSrcPath)
+}
+
+func TestAnalyse_goVersion(t *testing.T) {
+	cfg := Config{
+		EventType: EventTypePush,
+		HeadURL:   "head-url",
+		HeadRef:   "abcde",
+		GoVersion: "1.8",
+	}
+
+	analyser := &versionedAnalyser{mockAnalyser: &mockAnalyser{
+		ExecuteOut: [][]byte{{}},                          // git clone
+		ExecuteErr: []error{&NonZeroError{ExitCode: 128}}, // git clone
+	}}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	// Only the executer is of interest, so stop after the clone fails
+	if err := Analyse(context.Background(), analyser, nil, cfg, analysis); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if have, want := analyser.goVersion, "1.8"; have != want {
+		t.Errorf("goVersion have: %q want: %q", have, want)
+	}
+}
+
+// restrictedAnalyser is a versionedAnalyser which records whether a
+// restricted executer was requested.
+type restrictedAnalyser struct {
+	*versionedAnalyser
+	restricted bool
+}
+
+func (a *restrictedAnalyser) NewRestrictedExecuter(ctx context.Context, goSrcPath, goVersion string) (Executer, error) {
+	a.restricted = true
+	return a.NewVersionedExecuter(ctx, goSrcPath, goVersion)
+}
+
+func TestAnalyse_untrusted(t *testing.T) {
+	cfg := Config{
+		EventType: EventTypePullRequest,
+		BaseURL:   "base-url",
+		BaseRef:   "base-branch",
+		HeadURL:   "base-url",
+		HeadRef:   "refs/pull/1/head",
+		GoVersion: "1.8",
+		Untrusted: true,
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	// Untrusted code is not analysed by an analyser which can't restrict it.
+	if err := Analyse(context.Background(), &versionedAnalyser{mockAnalyser: &mockAnalyser{}}, nil, cfg, analysis); err == nil {
+		t.Fatal("expected error for unrestricted analyser, got nil")
+	}
+
+	analyser := &restrictedAnalyser{versionedAnalyser: &versionedAnalyser{mockAnalyser: &mockAnalyser{
+		ExecuteOut: [][]byte{{}, {}},                              // git init, git fetch
+		ExecuteErr: []error{nil, &NonZeroError{ExitCode: 128}}, // git init, git fetch
+	}}}
+
+	// Only the executer and clone are of interest, so stop after the fetch
+	// fails.
+	if err := Analyse(context.Background(), analyser, nil, cfg, analysis); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !analyser.restricted {
+		t.Errorf("expected restricted executer")
+	}
+	if have, want := analyser.goVersion, "1.8"; have != want {
+		t.Errorf("goVersion have: %q want: %q", have, want)
+	}
+	want := [][]string{
+		{"git", "init"},
+		{"git", "fetch", "--depth", "1", "base-url", "+refs/pull/1/head:refs/gopherci/head"},
+	}
+	if !reflect.DeepEqual(analyser.Executed, want) {
+		t.Errorf("\nhave %v\nwant %v", analyser.Executed, want)
+	}
+}
+
+func TestAnalyse_installationTools(t *testing.T) {
+	cfg := Config{
+		EventType: EventTypePush,
+		BaseURL:   "base-url",
+		BaseRef:   "abcdef~1",
+		HeadURL:   "base-url",
+		HeadRef:   "abcdef",
+	}
+	tools := []db.Tool{
+		{ID: 1, Name: "Name1", Path: "tool1"},
+		{ID: 2, InstallationID: 3, Name: "Name2", Path: "tool2"},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	// Installation tools are not executed by an analyser which can't
+	// restrict them, even if the code is trusted.
+	if err := Analyse(context.Background(), &versionedAnalyser{mockAnalyser: &mockAnalyser{}}, tools, cfg, analysis); err == nil {
+		t.Fatal("expected error for unrestricted analyser, got nil")
+	}
+
+	analyser := &restrictedAnalyser{versionedAnalyser: &versionedAnalyser{mockAnalyser: &mockAnalyser{
+		ExecuteOut: [][]byte{{}},                          // git clone
+		ExecuteErr: []error{&NonZeroError{ExitCode: 128}}, // git clone
+	}}}
+
+	// Only the executer and clone are of interest, so stop after the clone
+	// fails.
+	if err := Analyse(context.Background(), analyser, tools, cfg, analysis); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !analyser.restricted {
+		t.Errorf("expected restricted executer")
+	}
+	want := [][]string{{"git", "clone", "base-url", "."}}
+	if !reflect.DeepEqual(analyser.Networked, want) {
+		t.Errorf("networked\nhave %v\nwant %v", analyser.Networked, want)
+	}
+}
+
+// noDepsAnalyser wraps an Analyser so its executers don't install
+// dependencies, as install-deps.sh is only available in the analyser images.
+type noDepsAnalyser struct {
+	Analyser
+}
+
+func (a noDepsAnalyser) NewExecuter(ctx context.Context, goSrcPath string) (Executer, error) {
+	exec, err := a.Analyser.NewExecuter(ctx, goSrcPath)
+	return noDepsExecuter{exec}, err
+}
+
+type noDepsExecuter struct {
+	Executer
+}
+
+func (e noDepsExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	if args[0] == "install-deps.sh" {
+		return nil, nil
+	}
+	return e.Executer.Execute(ctx, args)
+}
+
+// TestAnalyse_forkPR analyses a pull request from a fork, whose head is only
+// available as a pull request ref, using git instead of mockAnalyser.
+func TestAnalyse_forkPR(t *testing.T) {
+	if _, err := osexec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "gopherci-fork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create the upstream repository, with the pull request's head only
+	// available as refs/pull/1/head.
+	upstream := filepath.Join(dir, "upstream")
+	git := func(args ...string) {
+		cmd := osexec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = upstream
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("could not execute git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(src string) {
+		if err := ioutil.WriteFile(filepath.Join(upstream, "main.go"), []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(upstream, 0700); err != nil {
+		t.Fatal(err)
+	}
+	git("init")
+	git("checkout", "-b", "master")
+	write("package main\n\nfunc main() {}\n")
+	git("add", "main.go")
+	git("commit", "-m", "base")
+	write("package main\n\nfunc main() { println() }\n")
+	git("commit", "-am", "head")
+	git("update-ref", "refs/pull/1/head", "HEAD")
+	git("reset", "--hard", "HEAD~1")
+
+	fs, err := NewFileSystem(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		EventType: EventTypePullRequest,
+		BaseURL:   "file://" + upstream,
+		BaseRef:   "master",
+		HeadURL:   "file://" + upstream,
+		HeadRef:   "refs/pull/1/head",
+	}
+	tools := []db.Tool{
+		{ID: 1, Name: "Name1", Path: "grep", Args: "-n -H println main.go"},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2)
+
+	err = Analyse(context.Background(), noDepsAnalyser{fs}, tools, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	issues := analysis.Tools[1].Issues
+	if len(issues) != 1 || issues[0].Path != "main.go" || issues[0].Line != 3 {
+		t.Errorf("unexpected issues, want main.go:3 only, have: %+v", issues)
+	}
+}
+
 func TestAnalyse_unknown(t *testing.T) {
 	cfg := Config{}
 	analyser := &mockAnalyser{}
@@ -305,3 +1018,42 @@ func TestGetPatch_diffError(t *testing.T) {
 		t.Errorf("unexpected patch\nhave %v\nwant %v", patch, wantPatch)
 	}
 }
+
+func TestSuppressIssues(t *testing.T) {
+	tools := map[db.ToolID]db.AnalysisTool{
+		1: {Issues: []db.Issue{{Issue: "a", Fingerprint: "a"}, {Issue: "b", Fingerprint: "b"}}},
+		2: {Issues: []db.Issue{{Issue: "a", Fingerprint: "a"}}},
+	}
+
+	suppressIssues(tools, map[string]bool{"a": true})
+
+	want := map[db.ToolID]db.AnalysisTool{
+		1: {Issues: []db.Issue{{Issue: "b", Fingerprint: "b"}}},
+		2: {Issues: nil},
+	}
+	if !reflect.DeepEqual(tools, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", tools, want)
+	}
+}
+
+func TestTimeoutCmd(t *testing.T) {
+	cmd := []string{"bash", "-c", "sleep 5"}
+
+	if have := timeoutCmd(context.Background(), cmd); !reflect.DeepEqual(have, cmd) {
+		t.Errorf("without deadline have: %v want: %v", have, cmd)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	want := []string{"timeout", "--kill-after=5s", "90s", "bash", "-c", "sleep 5"}
+	if have := timeoutCmd(ctx, cmd); !reflect.DeepEqual(have, want) {
+		t.Errorf("with deadline have: %v want: %v", have, want)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	want = []string{"timeout", "--kill-after=5s", "1s", "bash", "-c", "sleep 5"}
+	if have := timeoutCmd(ctx, cmd); !reflect.DeepEqual(have, want) {
+		t.Errorf("with short deadline have: %v want: %v", have, want)
+	}
+}
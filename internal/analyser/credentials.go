@@ -0,0 +1,152 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Secret is a credential, such as a token or password. The String and
+// GoString methods redact the secret, so it's not accidentally logged.
+type Secret string
+
+// String implements the fmt.Stringer interface.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// GoString implements the fmt.GoStringer interface.
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+// GitCredential authenticates git over HTTPS.
+type GitCredential struct {
+	// URL is the prefix of the repository URLs the credential is used for,
+	// such as https://github.com/owner. If empty, the credential is used for
+	// all URLs.
+	URL      string
+	Username string
+	Password Secret
+}
+
+// Deps configures the installation of private dependencies. It's only
+// provided to the command installing dependencies, in its environment.
+type Deps struct {
+	// GOPRIVATE is a comma separated list of glob patterns of private module
+	// path prefixes, see go help module-private. Optional.
+	GOPRIVATE string
+	// GOPROXY is the module proxy, its URLs may include credentials.
+	// Optional, if empty the executer's default is used.
+	GOPROXY Secret
+	// Credentials authenticate git when fetching private repositories.
+	// Optional.
+	Credentials []GitCredential
+}
+
+// gitCredentialHelper is a git credential helper which provides the username
+// and password in the environment variables with the suffix %[1]d to git.
+const gitCredentialHelper = `!f() { test "$1" = get && echo "username=$GOPHERCI_GIT_USERNAME_%[1]d" && echo "password=$GOPHERCI_GIT_PASSWORD_%[1]d"; }; f`
+
+// gitCredentialEnv returns the environment used to provide creds to git
+// commands. Any existing credential helpers are reset, so the credentials
+// cannot be stored by a helper configured in the executer's environment, and
+// the credentials are only passed in the environment, as git reads
+// GIT_CONFIG_PARAMETERS in the same way as -c arguments.
+func gitCredentialEnv(creds []GitCredential) []string {
+	var (
+		params = []string{"credential.helper="}
+		env    = []string{"GIT_TERMINAL_PROMPT=0"}
+		byPath bool
+	)
+	for i, cred := range creds {
+		key := "credential.helper"
+		if cred.URL != "" {
+			if !byPath {
+				// Match credentials by path, not just the host.
+				params = append(params, "credential.useHttpPath=true")
+				byPath = true
+			}
+			key = "credential." + cred.URL + ".helper"
+		}
+		params = append(params, key+"="+fmt.Sprintf(gitCredentialHelper, i))
+		env = append(env,
+			fmt.Sprintf("GOPHERCI_GIT_USERNAME_%d=%s", i, cred.Username),
+			fmt.Sprintf("GOPHERCI_GIT_PASSWORD_%d=%s", i, string(cred.Password)),
+		)
+	}
+	for i := range params {
+		params[i] = shellQuote(params[i])
+	}
+	return append([]string{"GIT_CONFIG_PARAMETERS=" + strings.Join(params, " ")}, env...)
+}
+
+// shellQuote single quotes s, in the form read from GIT_CONFIG_PARAMETERS.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellSafe are the characters which are never special to the shell.
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
+
+// shellJoin returns args as a single shell command, quoting each argument
+// which isn't shellSafe, so the shell executes args exactly as given, without
+// expanding variables or interpreting any other syntax.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.Trim(arg, shellSafe) != "" {
+			quoted[i] = shellQuote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// cloneEnvironment returns the environment used to clone the repository using token,
+// or nil if token is empty.
+func cloneEnvironment(token Secret) []string {
+	if token == "" {
+		return nil
+	}
+	return gitCredentialEnv([]GitCredential{{Username: "x-access-token", Password: token}})
+}
+
+// depsEnvironment returns the environment used to install dependencies, or nil if
+// deps is empty.
+func depsEnvironment(deps Deps) []string {
+	var env []string
+	if len(deps.Credentials) > 0 {
+		env = gitCredentialEnv(deps.Credentials)
+	}
+	if deps.GOPRIVATE != "" {
+		env = append(env, "GOPRIVATE="+deps.GOPRIVATE)
+	}
+	if deps.GOPROXY != "" {
+		env = append(env, "GOPROXY="+string(deps.GOPROXY))
+	}
+	return env
+}
+
+// executeEnv executes args using exec with a timeout, adding env to the
+// command's environment if it's not empty, which requires exec to be an
+// EnvExecuter.
+func executeEnv(ctx context.Context, exec Executer, timeout time.Duration, env []string, args []string) ([]byte, error) {
+	if len(env) == 0 {
+		return executeTimeout(ctx, exec, timeout, args)
+	}
+	envExec, ok := exec.(EnvExecuter)
+	if !ok {
+		return nil, errors.New("executer cannot provide credentials in the environment")
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return envExec.ExecuteEnv(ctx, args, env)
+}
@@ -0,0 +1,239 @@
+package analyser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/revgrep"
+)
+
+// directiveRegexp matches a //gopherci:ignore <tool>[/rule] reason directive,
+// the submatches are the text before the directive, the tool, the optional
+// rule and the optional reason.
+var directiveRegexp = regexp.MustCompile(`^(.*?)//gopherci:ignore[ \t]+([^\s/]+)(?:/(\S+))?[ \t]*(.*)$`)
+
+// directive is a //gopherci:ignore comment, which ignores the issues of a
+// tool, optionally only those matching a rule, within a range of lines.
+type directive struct {
+	path       string
+	line       int    // line is the line of the directive.
+	start, end int    // start and end are the first and last lines ignored.
+	tool       string // tool is the name of the tool whose issues are ignored.
+	rule       string // rule must be in an issue's message, if not empty.
+	used       bool   // used is true if the directive ignored an issue.
+}
+
+// matches returns true if the directive ignores an issue from the tool.
+func (d *directive) matches(tool db.Tool, issue db.Issue) bool {
+	if issue.Path != d.path || issue.Line < d.start || issue.Line > d.end || !strings.EqualFold(tool.Name, d.tool) {
+		return false
+	}
+	return d.rule == "" || strings.Contains(strings.TrimPrefix(issue.Issue, tool.Name+": "), d.rule)
+}
+
+// parseDirectives returns the directives in a file's source. A directive
+// after code on the same line ignores issues on that line. A directive on
+// its own line ignores issues in the declaration or statement starting on
+// the next line, such as an entire function, or if src can't be parsed, only
+// issues on the next line.
+func parseDirectives(path string, src []byte) []*directive {
+	var directives []*directive
+	for i, text := range strings.Split(string(src), "\n") {
+		m := directiveRegexp.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		line := i + 1
+		d := &directive{path: path, line: line, start: line, end: line, tool: m[2], rule: m[3]}
+		if strings.TrimSpace(m[1]) == "" {
+			d.start, d.end = line+1, line+1
+		}
+		directives = append(directives, d)
+	}
+
+	var ends map[int]int // ends is the last line of the nodes starting on each line
+	for _, d := range directives {
+		if d.start == d.line {
+			continue
+		}
+		if ends == nil {
+			ends = nodeEnds(path, src)
+		}
+		if end, ok := ends[d.start]; ok {
+			d.end = end
+		}
+	}
+	return directives
+}
+
+// nodeEnds parses src and returns a map of line to the last line of the
+// largest node starting on that line. Files which can't be parsed, such as
+// files which are not Go source, are partially or not at all included.
+func nodeEnds(path string, src []byte) map[int]int {
+	ends := make(map[int]int)
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if file == nil {
+		return ends
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		if _, ok := n.(*ast.CommentGroup); ok {
+			return false
+		}
+		start, end := fset.Position(n.Pos()).Line, fset.Position(n.End()).Line
+		if end > ends[start] {
+			ends[start] = end
+		}
+		return true
+	})
+	return ends
+}
+
+// applyDirectives removes the issues ignored by the //gopherci:ignore
+// directives in files, which is a map of path to source. Directives which
+// did not ignore any issues are reported as an issue of their tool. If patch
+// is not nil, only unused directives on lines changed in the patch are
+// reported. Unused directives for tools which did not succeed, or are not
+// one of tools, are not reported as it's unknown whether they're unused.
+func applyDirectives(tools []db.Tool, results map[db.ToolID]db.AnalysisTool, files map[string][]byte, patch []byte) {
+	var (
+		directives []*directive
+		paths      []string
+	)
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		directives = append(directives, parseDirectives(path, files[path])...)
+	}
+	if len(directives) == 0 {
+		return
+	}
+
+	for _, tool := range tools {
+		result, ok := results[tool.ID]
+		if !ok {
+			continue
+		}
+		var issues []db.Issue
+	issues:
+		for _, issue := range result.Issues {
+			for _, d := range directives {
+				if d.matches(tool, issue) {
+					d.used = true
+					continue issues
+				}
+			}
+			issues = append(issues, issue)
+		}
+		result.Issues = issues
+		results[tool.ID] = result
+	}
+
+	for _, issue := range unusedDirectives(tools, results, directives, patch) {
+		result := results[issue.toolID]
+		result.Issues = append(result.Issues, issue.Issue)
+		results[issue.toolID] = result
+	}
+}
+
+// toolIssue is an issue of a tool.
+type toolIssue struct {
+	db.Issue
+	toolID db.ToolID
+}
+
+// unusedDirectives returns an issue for each unused directive of a tool
+// which succeeded. If patch is not nil, only directives on lines changed in
+// the patch are returned, with their position in the patch.
+func unusedDirectives(tools []db.Tool, results map[db.ToolID]db.AnalysisTool, directives []*directive, patch []byte) []toolIssue {
+	var (
+		unused = make(map[string]toolIssue) // path:line: message -> issue
+		out    bytes.Buffer                 // output for revgrep, in the default format
+	)
+	for _, d := range directives {
+		if d.used {
+			continue
+		}
+		var tool *db.Tool
+		for i := range tools {
+			if strings.EqualFold(tools[i].Name, d.tool) {
+				tool = &tools[i]
+			}
+		}
+		if tool == nil {
+			log.Printf("%v:%v: ignore directive for unknown tool %q", d.path, d.line, d.tool)
+			continue
+		}
+		if results[tool.ID].Status != db.AnalysisToolStatusSuccess {
+			continue
+		}
+
+		name := d.tool
+		if d.rule != "" {
+			name += "/" + d.rule
+		}
+		msg := fmt.Sprintf("unused gopherci:ignore directive for %v", name)
+		key := fmt.Sprintf("%s:%d: %s", d.path, d.line, msg)
+		unused[key] = toolIssue{
+			Issue:  db.Issue{Path: d.path, Line: d.line, Issue: fmt.Sprintf("%s: %s", tool.Name, msg)},
+			toolID: tool.ID,
+		}
+		fmt.Fprintln(&out, key)
+	}
+
+	var keys []string
+	if patch == nil {
+		for key := range unused {
+			keys = append(keys, key)
+		}
+	} else {
+		checker := revgrep.Checker{Patch: bytes.NewReader(patch)}
+		revIssues, err := checker.Check(&out, ioutil.Discard)
+		if err != nil {
+			log.Printf("revgrep could not check unused directives: %v", err)
+			return nil
+		}
+		for _, ri := range revIssues {
+			key := fmt.Sprintf("%s:%d: %s", ri.File, ri.LineNo, ri.Message)
+			if issue, ok := unused[key]; ok {
+				issue.HunkPos = ri.HunkPos
+				unused[key] = issue
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var issues []toolIssue
+	for _, key := range keys {
+		issues = append(issues, unused[key])
+	}
+	return issues
+}
+
+// patchPaths returns the paths of the files changed in a unified diff.
+func patchPaths(patch []byte) []string {
+	var paths []string
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "+++ b/") {
+			paths = append(paths, strings.TrimPrefix(line, "+++ b/"))
+		}
+	}
+	return paths
+}
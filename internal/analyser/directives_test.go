@@ -0,0 +1,140 @@
+package analyser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+func TestParseDirectives(t *testing.T) {
+	src := []byte(`package main
+
+//gopherci:ignore golint generated names
+func main() {
+	x := 1
+	_ = x
+}
+
+func other() {
+	var _ = 1 //gopherci:ignore vet/shadow
+	//gopherci:ignore megacheck
+	var _ = 2
+}
+`)
+	tests := []struct {
+		name string
+		src  []byte
+		want []*directive
+	}{
+		{"go", src, []*directive{
+			{path: "main.go", line: 3, start: 4, end: 7, tool: "golint"},
+			{path: "main.go", line: 10, start: 10, end: 10, tool: "vet", rule: "shadow"},
+			{path: "main.go", line: 11, start: 12, end: 12, tool: "megacheck"},
+		}},
+		{"unparseable", []byte("not go\n//gopherci:ignore golint\nfunc main() {\n}\n"), []*directive{
+			{path: "main.go", line: 2, start: 3, end: 3, tool: "golint"},
+		}},
+		{"none", []byte("package main\n// gopherci:ignore golint\n"), nil},
+	}
+	for _, test := range tests {
+		have := parseDirectives("main.go", test.src)
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%v: have:", test.name)
+			for _, d := range have {
+				t.Errorf("%+v", d)
+			}
+		}
+	}
+}
+
+func TestApplyDirectives(t *testing.T) {
+	tools := []db.Tool{{ID: 1, Name: "golint"}, {ID: 2, Name: "vet"}, {ID: 3, Name: "errcheck"}}
+	files := map[string][]byte{
+		"main.go": []byte(`package main
+
+func main() {
+	_ = 1 //gopherci:ignore golint
+	_ = 2 //gopherci:ignore vet/shadow
+	_ = 3 //gopherci:ignore vet/unusedresult
+	_ = 4 //gopherci:ignore errcheck
+	_ = 5 //gopherci:ignore unknown
+}
+`),
+	}
+	patch := []byte(`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -5,0 +6,1 @@ func main() {
++	_ = 3 //gopherci:ignore vet/unusedresult
+`)
+
+	newResults := func() map[db.ToolID]db.AnalysisTool {
+		return map[db.ToolID]db.AnalysisTool{
+			1: {Status: db.AnalysisToolStatusSuccess, Issues: []db.Issue{
+				{Path: "main.go", Line: 4, Issue: "golint: ignored"},
+				{Path: "main.go", Line: 5, Issue: "golint: reported"},
+			}},
+			2: {Status: db.AnalysisToolStatusSuccess, Issues: []db.Issue{
+				{Path: "main.go", Line: 5, Issue: "vet: declaration of x shadows declaration"},
+				{Path: "main.go", Line: 6, Issue: "vet: result of fmt.Sprintf call not used"},
+			}},
+			3: {Status: db.AnalysisToolStatusFailure},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		patch []byte
+		want  map[db.ToolID][]db.Issue
+	}{
+		{"full", nil, map[db.ToolID][]db.Issue{
+			1: {{Path: "main.go", Line: 5, Issue: "golint: reported"}},
+			2: {
+				{Path: "main.go", Line: 6, Issue: "vet: result of fmt.Sprintf call not used"},
+				{Path: "main.go", Line: 6, Issue: "vet: unused gopherci:ignore directive for vet/unusedresult"},
+			},
+			3: nil,
+		}},
+		{"patch", patch, map[db.ToolID][]db.Issue{
+			1: {{Path: "main.go", Line: 5, Issue: "golint: reported"}},
+			2: {
+				{Path: "main.go", Line: 6, Issue: "vet: result of fmt.Sprintf call not used"},
+				{Path: "main.go", Line: 6, HunkPos: 1, Issue: "vet: unused gopherci:ignore directive for vet/unusedresult"},
+			},
+			3: nil,
+		}},
+	}
+	for _, test := range tests {
+		results := newResults()
+		applyDirectives(tools, results, files, test.patch)
+		for toolID, want := range test.want {
+			if have := results[toolID].Issues; !reflect.DeepEqual(have, want) {
+				t.Errorf("%v: tool %v\nhave: %+v\nwant: %+v", test.name, toolID, have, want)
+			}
+		}
+	}
+}
+
+func TestPatchPaths(t *testing.T) {
+	patch := []byte(`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package main
++package main // changed
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+diff --git a/sub/b.go b/sub/b.go
+--- /dev/null
++++ b/sub/b.go
+@@ -0,0 +1 @@
++package sub
+`)
+	want := []string{"main.go", "sub/b.go"}
+	if have := patchPaths(patch); !reflect.DeepEqual(have, want) {
+		t.Errorf("have: %v want: %v", have, want)
+	}
+}
@@ -1,7 +1,6 @@
 package analyser
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
@@ -18,21 +17,37 @@ const (
 	// DockerDefaultImage defines the default docker image that can be used
 	// to run checks.
 	DockerDefaultImage = "gopherci/gopherci-env:latest"
+	// DockerLabel is the label set on all containers created by the Docker
+	// analyser.
+	DockerLabel = "io.gopherci.executer"
 )
 
 // Docker is an Analyser that provides an Executer to build projects inside
 // Docker containers.
 type Docker struct {
-	image  string
-	client *docker.Client
+	image    string            // image is the default image
+	goImages map[string]string // goImages maps Go versions to images
+	client   *docker.Client
 }
 
-// Ensure Docker implements Analyser interface.
-var _ Analyser = (*Docker)(nil)
+// Ensure Docker implements Analyser, VersionedAnalyser, RestrictedAnalyser
+// and Reaper interfaces.
+var (
+	_ Analyser           = (*Docker)(nil)
+	_ VersionedAnalyser  = (*Docker)(nil)
+	_ RestrictedAnalyser = (*Docker)(nil)
+	_ Reaper             = (*Docker)(nil)
+)
+
+// dockerRestrictedPids is the maximum number of processes in a restricted
+// container.
+const dockerRestrictedPids = 1024
 
 // NewDocker returns a Docker which uses imageName as a container to build
-// projects.
-func NewDocker(imageName string) (*Docker, error) {
+// projects. goImages is the allowlist of images used for projects requiring a
+// specific version of Go, keyed by the Go version such as "1.8", and may be
+// nil. All images must already exist.
+func NewDocker(imageName string, goImages map[string]string) (*Docker, error) {
 	client, err := docker.NewClientFromEnv()
 	if err != nil {
 		return nil, err
@@ -44,15 +59,62 @@ func NewDocker(imageName string) (*Docker, error) {
 	}
 	log.Printf("Docker server %q version %q on %q", info.Name, info.ServerVersion, info.OperatingSystem)
 
-	// Check the image has been downloaded
+	// Check the images have been downloaded
+	images := []string{imageName}
+	for _, image := range goImages {
+		images = append(images, image)
+	}
+	for _, name := range images {
+		image, err := client.InspectImage(name)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("could not inspect %q", name))
+		}
+		log.Printf("Docker image %q (%v) created %v", name, image.ID, image.Created)
+	}
+
+	return &Docker{image: imageName, goImages: goImages, client: client}, nil
+}
+
+// imageFor returns the image for goVersion, if goVersion is not in the
+// allowlist and is a patch release, such as "1.8.3", the image for the minor
+// release "1.8" is used, otherwise the default image is used.
+func (d *Docker) imageFor(goVersion string) string {
+	if image, ok := d.goImages[goVersion]; ok {
+		return image
+	}
+	if parts := strings.SplitN(goVersion, ".", 3); len(parts) == 3 {
+		if image, ok := d.goImages[parts[0]+"."+parts[1]]; ok {
+			return image
+		}
+	}
+	if goVersion != "" {
+		log.Printf("Docker image for Go version %q not found, using default image %q", goVersion, d.image)
+	}
+	return d.image
+}
 
-	image, err := client.InspectImage(imageName)
+// Reap implements the Reaper interface by removing all containers with the
+// label DockerLabel created before the time before.
+func (d *Docker) Reap(ctx context.Context, before time.Time) (int, error) {
+	containers, err := d.client.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {DockerLabel}},
+		Context: ctx,
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("could not inspect %q", imageName))
+		return 0, errors.Wrap(err, "could not list containers")
 	}
-	log.Printf("Docker image %q (%v) created %v", imageName, image.ID, image.Created)
 
-	return &Docker{image: imageName, client: client}, nil
+	var reaped int
+	for _, container := range containers {
+		if !time.Unix(container.Created, 0).Before(before) {
+			continue
+		}
+		exec := &DockerExecuter{client: d.client, container: &docker.Container{ID: container.ID}}
+		exec.Stop(ctx)
+		reaped++
+	}
+	return reaped, nil
 }
 
 // DockerExecuter is an Executer that runs commands in a contained
@@ -63,9 +125,41 @@ type DockerExecuter struct {
 	projPath  string // path to project
 }
 
+// Ensure DockerExecuter implements Executer and EnvExecuter
+var _ EnvExecuter = (*DockerExecuter)(nil)
+
 // NewExecuter implements Analyser interface by creating and starting a
-// docker container.
+// docker container using the default image.
 func (d *Docker) NewExecuter(ctx context.Context, goSrcPath string) (Executer, error) {
+	return d.NewVersionedExecuter(ctx, goSrcPath, "")
+}
+
+// NewVersionedExecuter implements VersionedAnalyser interface by creating and
+// starting a docker container using the image for goVersion.
+func (d *Docker) NewVersionedExecuter(ctx context.Context, goSrcPath, goVersion string) (Executer, error) {
+	return d.newExecuter(ctx, goSrcPath, goVersion, nil)
+}
+
+// NewRestrictedExecuter implements RestrictedAnalyser interface by creating
+// and starting a docker container using the image for goVersion, without any
+// capabilities, the ability to gain privileges, or unlimited processes.
+func (d *Docker) NewRestrictedExecuter(ctx context.Context, goSrcPath, goVersion string) (Executer, error) {
+	return d.newExecuter(ctx, goSrcPath, goVersion, restrictedHostConfig())
+}
+
+// restrictedHostConfig returns the host config of a restricted container.
+func restrictedHostConfig() *docker.HostConfig {
+	pids := int64(dockerRestrictedPids)
+	return &docker.HostConfig{
+		CapDrop:     []string{"ALL"},
+		SecurityOpt: []string{"no-new-privileges"},
+		PidsLimit:   &pids,
+	}
+}
+
+// newExecuter creates and starts a docker container using the image for
+// goVersion and hostConfig, which may be nil.
+func (d *Docker) newExecuter(ctx context.Context, goSrcPath, goVersion string, hostConfig *docker.HostConfig) (Executer, error) {
 	exec := &DockerExecuter{
 		client:   d.client,
 		projPath: filepath.Join("$GOPATH", "src", goSrcPath),
@@ -74,9 +168,10 @@ func (d *Docker) NewExecuter(ctx context.Context, goSrcPath string) (Executer, e
 	name := fmt.Sprintf("goperci-%d", time.Now().UnixNano())
 
 	createOptions := docker.CreateContainerOptions{
-		Name:    name,
-		Config:  &docker.Config{Image: d.image},
-		Context: ctx,
+		Name:       name,
+		Config:     &docker.Config{Image: d.imageFor(goVersion), Labels: map[string]string{DockerLabel: "true"}},
+		HostConfig: hostConfig,
+		Context:    ctx,
 	}
 
 	// Create container
@@ -96,7 +191,7 @@ func (d *Docker) NewExecuter(ctx context.Context, goSrcPath string) (Executer, e
 
 	// Make required directories to clone into see bug in #16
 	args := []string{"mkdir", "-p", exec.projPath}
-	if out, err := exec.Execute(ctx, args); err != nil {
+	if out, err := exec.executeScript(ctx, "mkdir -p "+exec.projPath, args, nil); err != nil {
 		exec.Stop(ctx)
 		return nil, errors.Wrap(err, fmt.Sprintf("could not execute %v, output: %q", args, out))
 	}
@@ -105,16 +200,32 @@ func (d *Docker) NewExecuter(ctx context.Context, goSrcPath string) (Executer, e
 }
 
 // Execute implements the Executer interface and runs commands inside a
-// docker container.
+// docker container. Each command is a separate exec in the same container,
+// so Execute is safe to call concurrently.
 func (e *DockerExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
-	// "cd e.projPath; cmd" ignore the errors from cd as the first command
+	return e.ExecuteEnv(ctx, args, nil)
+}
+
+// ExecuteEnv implements the EnvExecuter interface, env is set in the exec's
+// environment and isn't logged. Args are quoted, so they're not interpreted by
+// the shell.
+func (e *DockerExecuter) ExecuteEnv(ctx context.Context, args []string, env []string) ([]byte, error) {
+	return e.executeScript(ctx, shellJoin(args), args, env)
+}
+
+// executeScript executes script with bash in the project's directory, args
+// are only used to report errors. The projPath isn't quoted, so $GOPATH is
+// expanded.
+func (e *DockerExecuter) executeScript(ctx context.Context, script string, args []string, env []string) ([]byte, error) {
+	// "cd e.projPath; script" ignore the errors from cd as the first command
 	// executed is the mkdir
-	cmd := []string{"bash", "-c", fmt.Sprintf(`cd %v; %v`, e.projPath, strings.Join(args, " "))}
+	cmd := timeoutCmd(ctx, []string{"bash", "-c", fmt.Sprintf(`cd %v; %v`, e.projPath, script)})
 	createOptions := docker.CreateExecOptions{
 		AttachStdout: true,
 		AttachStderr: true,
 		Cmd:          cmd,
 		Container:    e.container.ID,
+		Env:          env,
 	}
 
 	log.Printf("docker: creating exec for cmd: %v", cmd) // additional debug to troubleshoot unresponsive instance
@@ -124,15 +235,19 @@ func (e *DockerExecuter) Execute(ctx context.Context, args []string) ([]byte, er
 	}
 	log.Printf("docker: created exec id: %v for cmd: %v", exec, cmd)
 
-	var buf bytes.Buffer
+	buf := newLimitedBuffer(MaxOutputSize)
 	startOptions := docker.StartExecOptions{
-		OutputStream: &buf,
-		ErrorStream:  &buf,
+		OutputStream: buf,
+		ErrorStream:  buf,
 		Context:      ctx,
 	}
 
 	// Start exec and block
 	err = e.client.StartExec(exec.ID, startOptions)
+	if ctx.Err() == context.DeadlineExceeded {
+		// The exec's process is terminated by timeoutCmd.
+		return buf.Bytes(), &TimeoutError{args: args}
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("could not start exec, cmd: %v containerID %v", createOptions.Cmd, e.container.ID))
 	}
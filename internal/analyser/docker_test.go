@@ -8,7 +8,7 @@ import (
 )
 
 func TestDocker(t *testing.T) {
-	docker, err := NewDocker(DockerDefaultImage)
+	docker, err := NewDocker(DockerDefaultImage, nil)
 	if err != nil {
 		t.Fatalf("unexpected error initialising docker: %v", err)
 	}
@@ -30,7 +30,7 @@ func TestDocker(t *testing.T) {
 	}
 
 	// Ensure error codes are captured
-	out, err = exec.Execute(ctx, []string{">&2 echo error; false"})
+	out, err = exec.Execute(ctx, []string{"bash", "-c", ">&2 echo error; false"})
 	log.Printf("%q %q", string(out), err)
 	if want := "error\n"; want != string(out) {
 		t.Errorf("\nwant: %q\nhave: %q", want, out)
@@ -46,3 +46,30 @@ func TestDocker(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func TestDocker_imageFor(t *testing.T) {
+	d := &Docker{
+		image: "default",
+		goImages: map[string]string{
+			"1.7":   "go1.7",
+			"1.8":   "go1.8",
+			"1.8.1": "go1.8.1",
+		},
+	}
+
+	tests := map[string]string{
+		"":      "default",
+		"1.7":   "go1.7",
+		"1.8":   "go1.8",
+		"1.8.1": "go1.8.1",
+		"1.8.3": "go1.8",
+		"1.9":   "default",
+		"1.9.1": "default",
+	}
+
+	for goVersion, want := range tests {
+		if have := d.imageFor(goVersion); have != want {
+			t.Errorf("goVersion %q have: %q want: %q", goVersion, have, want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package analyser
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -24,8 +26,11 @@ type FileSystem struct {
 	base string // base is the base dir all projects have in common
 }
 
-// Ensure FileSystem implements Analyser
-var _ Analyser = (*FileSystem)(nil)
+// Ensure FileSystem implements Analyser and Reaper
+var (
+	_ Analyser = (*FileSystem)(nil)
+	_ Reaper   = (*FileSystem)(nil)
+)
 
 // NewFileSystem returns an FileSystem which uses the path base to build
 // contained environments on the file system.
@@ -46,6 +51,40 @@ func (fs *FileSystem) NewExecuter(_ context.Context, goSrcPath string) (Executer
 	return e, nil
 }
 
+// Reap implements the Reaper interface by removing each executer's GOPATH
+// created before the time before. The creation time is read from the
+// directory's name, so any other files or directories in base are ignored.
+func (fs *FileSystem) Reap(_ context.Context, before time.Time) (int, error) {
+	return reapDirs(fs.base, before)
+}
+
+// reapDirs removes the directories in base created by mktemp before the time
+// before.
+func reapDirs(base string, before time.Time) (int, error) {
+	files, err := ioutil.ReadDir(base)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not read directory %q", base)
+	}
+
+	var reaped int
+	for _, file := range files {
+		nsec, err := strconv.ParseInt(file.Name(), 10, 64)
+		if err != nil || !file.IsDir() {
+			continue // not created by mktemp
+		}
+		if !time.Unix(0, nsec).Before(before) {
+			continue
+		}
+		path := filepath.Join(base, file.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("could not remove %v: %v", path, err)
+			continue
+		}
+		reaped++
+	}
+	return reaped, nil
+}
+
 // FileSystemExecuter is an Executer that runs commands in a contained
 // environment.
 type FileSystemExecuter struct {
@@ -53,8 +92,8 @@ type FileSystemExecuter struct {
 	projpath string // projpath is gopath/src/<goSrcPath>
 }
 
-// Ensure FileSystemExecuter implements Executer
-var _ Executer = (*FileSystemExecuter)(nil)
+// Ensure FileSystemExecuter implements Executer and EnvExecuter
+var _ EnvExecuter = (*FileSystemExecuter)(nil)
 
 func (e *FileSystemExecuter) mktemp(base, goSrcPath string) error {
 	rand := strconv.Itoa(int(time.Now().UnixNano()))
@@ -67,17 +106,29 @@ func (e *FileSystemExecuter) mktemp(base, goSrcPath string) error {
 	return nil
 }
 
-// Execute implements the Executer interface
+// Execute implements the Executer interface. Each command is a separate
+// process, so Execute is safe to call concurrently.
 func (e *FileSystemExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	return e.ExecuteEnv(ctx, args, nil)
+}
+
+// ExecuteEnv implements the EnvExecuter interface.
+func (e *FileSystemExecuter) ExecuteEnv(ctx context.Context, args []string, env []string) ([]byte, error) {
 	cmd := exec.CommandContext(ctx, args[0])
 	cmd.Args = args
 	cmd.Dir = e.projpath
-	cmd.Env = []string{"GOPATH=" + e.gopath, "PATH=" + os.Getenv("PATH")}
-	out, err := cmd.CombinedOutput()
+	cmd.Env = append([]string{"GOPATH=" + e.gopath, "PATH=" + os.Getenv("PATH")}, env...)
+	out := newLimitedBuffer(MaxOutputSize)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return out.Bytes(), &TimeoutError{args: args}
+	}
 	if msg, ok := err.(*exec.ExitError); ok {
-		return out, &NonZeroError{ExitCode: msg.Sys().(syscall.WaitStatus).ExitStatus(), args: args}
+		return out.Bytes(), &NonZeroError{ExitCode: msg.Sys().(syscall.WaitStatus).ExitStatus(), args: args}
 	}
-	return out, err
+	return out.Bytes(), err
 }
 
 // Stop implements the Executer interface
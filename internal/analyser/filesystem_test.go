@@ -2,8 +2,12 @@ package analyser
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNewFileSystem_notExist(t *testing.T) {
@@ -61,6 +65,66 @@ func TestFileSystem(t *testing.T) {
 
 }
 
+func TestFileSystem_timeout(t *testing.T) {
+	fs, err := NewFileSystem(os.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exec, err := fs.NewExecuter(context.Background(), "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer exec.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = exec.Execute(ctx, []string{"sleep", "5"})
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Errorf("have error %#v, want %T", err, &TimeoutError{})
+	}
+}
+
+func TestFileSystem_reap(t *testing.T) {
+	base, err := ioutil.TempDir("", "gopherci-reap")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(base)
+
+	now := time.Now()
+	var (
+		old   = filepath.Join(base, strconv.FormatInt(now.Add(-2*time.Hour).UnixNano(), 10))
+		new   = filepath.Join(base, strconv.FormatInt(now.UnixNano(), 10))
+		other = filepath.Join(base, "other")
+	)
+	for _, dir := range []string{old, new, other} {
+		if err := os.MkdirAll(filepath.Join(dir, "src"), 0700); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	fs, err := NewFileSystem(base)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reaped, err := fs.Reap(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reaped != 1 {
+		t.Errorf("reaped %v, want 1", reaped)
+	}
+	if exists(old) {
+		t.Errorf("expected %q to be removed", old)
+	}
+	if !exists(new) || !exists(other) {
+		t.Errorf("expected %q and %q to exist", new, other)
+	}
+}
+
 func exists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil || !os.IsNotExist(err)
@@ -0,0 +1,63 @@
+package analyser
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+// fingerprintContext is the number of lines before and after an issue
+// included in its fingerprint.
+const fingerprintContext = 1
+
+// fingerprintNumbers matches numbers in an issue's message, which often refer
+// to positions that change as code is moved, such as "declared on line 10".
+var fingerprintNumbers = regexp.MustCompile(`\d+`)
+
+// fingerprintIssues sets the Fingerprint of each of the tools' issues, using
+// files, which is a map of path to source, to hash the code surrounding each
+// issue. Issues in files which are not in files are still fingerprinted but
+// without the surrounding code.
+func fingerprintIssues(tools map[db.ToolID]db.AnalysisTool, files map[string][]byte) {
+	lines := make(map[string][]string)
+	for path, src := range files {
+		lines[path] = strings.Split(string(bytes.TrimRight(src, "\n")), "\n")
+	}
+
+	for toolID, tool := range tools {
+		for i, issue := range tool.Issues {
+			tool.Issues[i].Fingerprint = fingerprint(issue, lines[issue.Path])
+		}
+		tools[toolID] = tool
+	}
+}
+
+// fingerprint returns a stable identifier for an issue, which is the same for
+// the same issue in different commits, even if the issue's line has moved.
+// The fingerprint is a hash of the issue's path, its message (which includes
+// the tool's name and, if reported by the tool, its rule) with numbers
+// removed, and the code surrounding the issue in the file's lines.
+func fingerprint(issue db.Issue, lines []string) string {
+	h := sha1.New()
+	io.WriteString(h, issue.Path)
+	io.WriteString(h, "\x00")
+	io.WriteString(h, normalizeMessage(issue.Issue))
+	for l := issue.Line - fingerprintContext; l <= issue.Line+fingerprintContext; l++ {
+		io.WriteString(h, "\x00")
+		if l >= 1 && l <= len(lines) {
+			io.WriteString(h, strings.TrimSpace(lines[l-1]))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// normalizeMessage removes numbers and repeated whitespace from an issue's
+// message.
+func normalizeMessage(msg string) string {
+	return strings.Join(strings.Fields(fingerprintNumbers.ReplaceAllString(msg, "N")), " ")
+}
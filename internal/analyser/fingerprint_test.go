@@ -0,0 +1,58 @@
+package analyser
+
+import (
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+func TestFingerprint(t *testing.T) {
+	lines := []string{"package main", "", "func main() {", "\tx := 1", "}"}
+	issue := db.Issue{Path: "main.go", Line: 4, Issue: "golint: x declared at line 4 and not used"}
+	want := fingerprint(issue, lines)
+
+	// Code added above the issue, moving it down a line.
+	moved := db.Issue{Path: "main.go", Line: 5, Issue: "golint: x declared at line 5 and not used"}
+	movedLines := []string{"package main", "", "// main does things.", "func main() {", "  x := 1", "}"}
+	if have := fingerprint(moved, movedLines); have != want {
+		t.Errorf("moved issue fingerprint have: %v want: %v", have, want)
+	}
+
+	tests := []struct {
+		name  string
+		issue db.Issue
+		lines []string
+	}{
+		{"path", db.Issue{Path: "other.go", Line: 4, Issue: issue.Issue}, lines},
+		{"message", db.Issue{Path: "main.go", Line: 4, Issue: "golint: y declared and not used"}, lines},
+		{"code", issue, []string{"package main", "", "func main() {", "\tx := 2", "}"}},
+		{"context", issue, []string{"package main", "", "func other() {", "\tx := 1", "}"}},
+	}
+	for _, test := range tests {
+		if have := fingerprint(test.issue, test.lines); have == want {
+			t.Errorf("%v: expected fingerprint to change", test.name)
+		}
+	}
+}
+
+func TestFingerprintIssues(t *testing.T) {
+	files := map[string][]byte{"a.go": []byte("package a\n\nvar _ = 1\n")} // b.go could not be read
+
+	tools := map[db.ToolID]db.AnalysisTool{
+		1: {Issues: []db.Issue{{Path: "a.go", Line: 3, Issue: "issue"}, {Path: "b.go", Line: 1, Issue: "issue"}}},
+		2: {Issues: []db.Issue{{Path: "a.go", Line: 3, Issue: "issue"}}},
+	}
+
+	fingerprintIssues(tools, files)
+
+	a := tools[1].Issues[0].Fingerprint
+	if want := fingerprint(tools[1].Issues[0], []string{"package a", "", "var _ = 1"}); a != want {
+		t.Errorf("a.go fingerprint have: %v want: %v", a, want)
+	}
+	if b := tools[1].Issues[1].Fingerprint; b == "" || b == a {
+		t.Errorf("unexpected b.go fingerprint: %q", b)
+	}
+	if have := tools[2].Issues[0].Fingerprint; have != a {
+		t.Errorf("same issue from another tool have: %v want: %v", have, a)
+	}
+}
@@ -0,0 +1,154 @@
+package analyser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// readBatchSize is the maximum number of files read by a single command.
+	readBatchSize = 100
+	// generatedHeaderSize is the number of bytes read from the start of each
+	// file when detecting generated files, which needs to contain the file's
+	// header up to the package clause.
+	generatedHeaderSize = 32 << 10 // 32 KiB
+	// sourceFileSize is the number of bytes read from the start of each file
+	// with issues, or changed, to find directives and fingerprint issues.
+	// Issues after this are not ignored by directives and have no
+	// surrounding code in their fingerprint.
+	sourceFileSize = 1 << 20 // 1 MiB
+)
+
+// generatedFiles reads each of the paths (relative to the executer's working
+// directory) and returns a map of path to whether the file is generated. Each
+// path is only read once and files are read in batches, so only a few
+// commands are executed regardless of the number of issues.
+func generatedFiles(ctx context.Context, exec Executer, paths []string) (map[string]bool, error) {
+	files, err := readFiles(ctx, exec, paths, generatedHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	generated := make(map[string]bool)
+	for _, path := range paths {
+		generated[path] = isGenerated(files[path])
+	}
+	return generated, nil
+}
+
+// readFiles reads up to size bytes from the start of each of the paths
+// (relative to the executer's working directory) and returns a map of path to
+// the file's contents. Each path is only read once and files are read in
+// batches of up to readBatchSize, and small enough that the batch's output is
+// not truncated at MaxOutputSize. Files which could not be read are not
+// included in the map.
+func readFiles(ctx context.Context, exec Executer, paths []string, size int) (map[string][]byte, error) {
+	var (
+		seen = make(map[string]bool)
+		uniq []string
+	)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		uniq = append(uniq, path)
+	}
+	sort.Strings(uniq)
+
+	files := make(map[string][]byte)
+	for len(uniq) > 0 {
+		batch := readBatch(uniq, size)
+		uniq = uniq[len(batch):]
+
+		// head -v prints a header before each file, so multiple files can be
+		// read by one command.
+		args := append([]string{"head", "-v", "-c", fmt.Sprint(size), "--"}, batch...)
+		out, err := exec.Execute(ctx, args)
+		switch err.(type) {
+		case nil, *NonZeroError:
+			// Ignore non-zero exit codes, a file may have been removed and
+			// the remaining files are still read.
+		default:
+			return nil, errors.Wrapf(err, "could not execute %v", args)
+		}
+
+		for path, src := range splitHead(out, batch) {
+			files[path] = src
+		}
+	}
+	return files, nil
+}
+
+// readBatch returns the first of paths to read in a single command, when
+// reading up to size bytes of each. At least one path is returned.
+func readBatch(paths []string, size int) []string {
+	var outSize int
+	for i, path := range paths {
+		// head -v separates each file with a blank line and a header.
+		outSize += len(fmt.Sprintf("\n==> %s <==\n", path)) + size
+		if i == readBatchSize || (i > 0 && outSize > MaxOutputSize) {
+			return paths[:i]
+		}
+	}
+	return paths
+}
+
+// splitHead splits the output of head -v for paths and returns a map of path
+// to the file's contents. Paths which were not found in the output are not
+// included in the map.
+func splitHead(out []byte, paths []string) map[string][]byte {
+	type header struct {
+		path       string
+		start, end int // start and end of header in out
+	}
+
+	var (
+		headers []header
+		pos     int
+	)
+	for _, path := range paths {
+		h := []byte(fmt.Sprintf("==> %s <==\n", path))
+		i := bytes.Index(out[pos:], h)
+		if i < 0 {
+			continue
+		}
+		headers = append(headers, header{path: path, start: pos + i, end: pos + i + len(h)})
+		pos += i + len(h)
+	}
+
+	files := make(map[string][]byte)
+	for i, h := range headers {
+		end := len(out)
+		if i+1 < len(headers) {
+			end = headers[i+1].start
+		}
+		files[h.path] = out[h.end:end]
+	}
+	return files
+}
+
+// isGenerated returns true if the source contains a comment before the
+// package clause marking the file as generated. This includes the standard
+// "// Code generated ... DO NOT EDIT." comment (https://golang.org/s/generatedcode)
+// as well as any other comment containing "DO NOT EDIT", which is used by
+// generators that predate the standard.
+func isGenerated(src []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "//") && strings.Contains(line, "DO NOT EDIT"):
+			return true
+		case strings.HasPrefix(line, "package "):
+			return false
+		}
+	}
+	return false
+}
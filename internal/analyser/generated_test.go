@@ -0,0 +1,122 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGeneratedFiles(t *testing.T) {
+	var paths []string
+	for i := 0; i < readBatchSize+1; i++ {
+		paths = append(paths, fmt.Sprintf("file%03d.go", i))
+	}
+	paths = append(paths, "file000.go") // duplicate path
+
+	analyser := &mockAnalyser{
+		ExecuteOut: [][]byte{
+			[]byte("==> file000.go <==\n// Code generated by tool. DO NOT EDIT.\npackage foo\n\n==> file001.go <==\npackage foo\n"),
+			[]byte("==> file100.go <==\n// Code generated by tool. DO NOT EDIT.\npackage foo\n"),
+		},
+		ExecuteErr: []error{
+			&NonZeroError{ExitCode: 1}, // some files did not exist
+			nil,
+		},
+	}
+
+	generated, err := generatedFiles(context.Background(), analyser, paths)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if have, want := len(analyser.Executed), 2; have != want {
+		t.Errorf("executed %v commands, want %v", have, want)
+	}
+	if have, want := len(analyser.Executed[0]), readBatchSize+5; have != want {
+		t.Errorf("first batch has %v args, want %v", have, want)
+	}
+	if have, want := len(generated), readBatchSize+1; have != want {
+		t.Errorf("have %v paths, want %v", have, want)
+	}
+
+	for path, want := range map[string]bool{"file000.go": true, "file001.go": false, "file002.go": false, "file100.go": true} {
+		if have := generated[path]; have != want {
+			t.Errorf("path %v generated have: %v want: %v", path, have, want)
+		}
+	}
+}
+
+func TestReadBatch(t *testing.T) {
+	defer func(max int) { MaxOutputSize = max }(MaxOutputSize)
+	MaxOutputSize = 100
+
+	var paths []string
+	for i := 0; i < readBatchSize+1; i++ {
+		paths = append(paths, fmt.Sprintf("file%03d.go", i))
+	}
+
+	tests := []struct {
+		size int
+		want int // want is the number of paths in the batch
+	}{
+		{0, 5},    // each header is 20 bytes
+		{30, 2},   // each file's output is 50 bytes
+		{31, 1},   // each file's output is 51 bytes
+		{1000, 1}, // larger than MaxOutputSize, but still read
+	}
+	for _, test := range tests {
+		if have := len(readBatch(paths, test.size)); have != test.want {
+			t.Errorf("size %v have %v paths, want %v", test.size, have, test.want)
+		}
+	}
+
+	MaxOutputSize = 1 << 20
+	if have, want := len(readBatch(paths, 0)), readBatchSize; have != want {
+		t.Errorf("have %v paths, want %v", have, want)
+	}
+	if have, want := len(readBatch(paths[:3], 0)), 3; have != want {
+		t.Errorf("have %v paths, want %v", have, want)
+	}
+}
+
+func TestSplitHead(t *testing.T) {
+	out := []byte(`==> a.go <==
+package a
+
+==> b.go <==
+head: cannot open 'c.go' for reading: No such file or directory
+==> d.go <==
+package d
+`)
+	want := map[string][]byte{
+		"a.go": []byte("package a\n\n"),
+		"b.go": []byte("head: cannot open 'c.go' for reading: No such file or directory\n"),
+		"d.go": []byte("package d\n"),
+	}
+
+	have := splitHead(out, []string{"a.go", "b.go", "c.go", "d.go"})
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"// Code generated by protoc-gen-go. DO NOT EDIT.\npackage foo", true},
+		{"// Copyright\n\n// Code generated by tool. DO NOT EDIT.\n\npackage foo", true},
+		{"// automatically generated - DO NOT EDIT\npackage foo", true},
+		{"package foo\n// Code generated by tool. DO NOT EDIT.\n", false},
+		{"// Package foo does things.\npackage foo", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if have := isGenerated([]byte(test.src)); have != test.want {
+			t.Errorf("src: %q have: %v want: %v", test.src, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+const (
+	// KubernetesDefaultNamespace is the default namespace pods are created in.
+	KubernetesDefaultNamespace = "default"
+	// KubernetesPodLabel is the label set on all pods created by the
+	// Kubernetes analyser, with the value KubernetesPodLabelValue.
+	KubernetesPodLabel = "app"
+	// KubernetesPodLabelValue is the value of KubernetesPodLabel.
+	KubernetesPodLabelValue = "gopherci-analysis"
+	// kubernetesContainer is the name of the single container in the pod.
+	kubernetesContainer = "analysis"
+	// podStartTimeout is the maximum time to wait for a pod to be running,
+	// which includes the time to schedule the pod and pull the image.
+	podStartTimeout = 5 * time.Minute
+	// podPollInterval is how often a pod's status is checked while waiting
+	// for it to start.
+	podPollInterval = time.Second
+)
+
+// podExecFunc executes cmd in the container of the pod, writing the
+// command's output to stdout and stderr. If stdin is not nil, it's provided
+// as the command's input.
+type podExecFunc func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+// Kubernetes is an Analyser that provides an Executer to build projects
+// inside pods in a Kubernetes cluster.
+type Kubernetes struct {
+	client    kubernetes.Interface
+	exec      podExecFunc
+	namespace string
+	image     string
+	requests  corev1.ResourceList
+}
+
+// Ensure Kubernetes implements Analyser, RestrictedAnalyser and Reaper
+// interfaces.
+var (
+	_ Analyser           = (*Kubernetes)(nil)
+	_ RestrictedAnalyser = (*Kubernetes)(nil)
+	_ Reaper             = (*Kubernetes)(nil)
+)
+
+// NewKubernetes returns a Kubernetes which creates pods using image in
+// namespace to build projects. Each pod's container requests the resources in
+// requests, which may be nil.
+func NewKubernetes(config *rest.Config, namespace, image string, requests corev1.ResourceList) (*Kubernetes, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create kubernetes client")
+	}
+
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get kubernetes server version")
+	}
+	log.Printf("Kubernetes server %q version %q on %q", config.Host, version.GitVersion, version.Platform)
+
+	return newKubernetes(client, restPodExec(client, config), namespace, image, requests), nil
+}
+
+// newKubernetes returns a Kubernetes using client to manage pods and exec to
+// execute commands within them.
+func newKubernetes(client kubernetes.Interface, exec podExecFunc, namespace, image string, requests corev1.ResourceList) *Kubernetes {
+	return &Kubernetes{
+		client:    client,
+		exec:      exec,
+		namespace: namespace,
+		image:     image,
+		requests:  requests,
+	}
+}
+
+// restPodExec returns a podExecFunc which uses the exec API to execute
+// commands in a pod.
+func restPodExec(client kubernetes.Interface, config *rest.Config) podExecFunc {
+	return func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		req := client.CoreV1().RESTClient().Post().
+			Resource("pods").
+			Namespace(pod.Namespace).
+			Name(pod.Name).
+			SubResource("exec").
+			VersionedParams(&corev1.PodExecOptions{
+				Container: kubernetesContainer,
+				Command:   cmd,
+				Stdin:     stdin != nil,
+				Stdout:    true,
+				Stderr:    true,
+			}, scheme.ParameterCodec)
+
+		executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+		if err != nil {
+			return errors.Wrap(err, "could not create executor")
+		}
+		return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+	}
+}
+
+// Reap implements the Reaper interface by deleting all pods in the namespace
+// with the label KubernetesPodLabel created before the time before.
+func (k *Kubernetes) Reap(ctx context.Context, before time.Time) (int, error) {
+	pods, err := k.client.CoreV1().Pods(k.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: KubernetesPodLabel + "=" + KubernetesPodLabelValue,
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not list pods")
+	}
+
+	var reaped int
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !pod.CreationTimestamp.Time.Before(before) {
+			continue
+		}
+		exec := &KubernetesExecuter{client: k.client, pod: pod}
+		exec.Stop(ctx)
+		reaped++
+	}
+	return reaped, nil
+}
+
+// KubernetesExecuter is an Executer that runs commands in a pod for a single
+// project.
+type KubernetesExecuter struct {
+	client   kubernetes.Interface
+	exec     podExecFunc
+	pod      *corev1.Pod
+	projPath string // path to project
+}
+
+// Ensure KubernetesExecuter implements Executer and EnvExecuter
+var _ EnvExecuter = (*KubernetesExecuter)(nil)
+
+// NewExecuter implements Analyser interface by creating a pod and waiting
+// for it to be running.
+func (k *Kubernetes) NewExecuter(ctx context.Context, goSrcPath string) (Executer, error) {
+	return k.newExecuter(ctx, goSrcPath, nil)
+}
+
+// NewRestrictedExecuter implements RestrictedAnalyser interface by creating a
+// pod whose container has no capabilities and cannot gain privileges, and
+// waiting for it to be running. Kubernetes does not provide different
+// versions of Go, so goVersion is ignored.
+func (k *Kubernetes) NewRestrictedExecuter(ctx context.Context, goSrcPath, _ string) (Executer, error) {
+	return k.newExecuter(ctx, goSrcPath, &corev1.SecurityContext{
+		AllowPrivilegeEscalation: new(bool),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	})
+}
+
+// newExecuter creates a pod whose container has the securityContext, which
+// may be nil, and waits for it to be running.
+func (k *Kubernetes) newExecuter(ctx context.Context, goSrcPath string, securityContext *corev1.SecurityContext) (Executer, error) {
+	exec := &KubernetesExecuter{
+		client:   k.client,
+		exec:     k.exec,
+		projPath: filepath.Join("$GOPATH", "src", goSrcPath),
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("gopherci-%d", time.Now().UnixNano()),
+			Namespace: k.namespace,
+			Labels:    map[string]string{KubernetesPodLabel: KubernetesPodLabelValue},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			AutomountServiceAccountToken:  new(bool),
+			TerminationGracePeriodSeconds: new(int64),
+			Containers: []corev1.Container{{
+				Name:  kubernetesContainer,
+				Image: k.image,
+				// Keep the container running, commands are executed via the
+				// exec API and the pod is deleted when the executer is stopped.
+				Command:         []string{"sleep", "infinity"},
+				Resources:       corev1.ResourceRequirements{Requests: k.requests},
+				SecurityContext: securityContext,
+			}},
+		},
+	}
+
+	// Create pod
+	var err error
+	exec.pod, err = k.client.CoreV1().Pods(k.namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create pod")
+	}
+	log.Printf("Created pod %q in namespace %q", exec.pod.Name, exec.pod.Namespace)
+
+	// Wait for pod to be running
+	if err := exec.waitRunning(ctx); err != nil {
+		exec.Stop(ctx)
+		return nil, errors.Wrapf(err, "pod %q did not start", exec.pod.Name)
+	}
+	log.Printf("Started pod %q", exec.pod.Name)
+
+	// Make required directories to clone into
+	args := []string{"mkdir", "-p", exec.projPath}
+	if out, err := exec.executeScript(ctx, "mkdir -p "+exec.projPath, args, nil); err != nil {
+		exec.Stop(ctx)
+		return nil, errors.Wrap(err, fmt.Sprintf("could not execute %v, output: %q", args, out))
+	}
+
+	return exec, nil
+}
+
+// waitRunning polls the pod's status until it's running, or returns an error
+// if the pod has terminated, podStartTimeout elapses or ctx is done.
+func (e *KubernetesExecuter) waitRunning(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, podStartTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(podPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pod, err := e.client.CoreV1().Pods(e.pod.Namespace).Get(ctx, e.pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrap(err, "could not get pod")
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			e.pod = pod
+			return nil
+		case corev1.PodSucceeded, corev1.PodFailed:
+			return fmt.Errorf("pod terminated with phase %v: %v", pod.Status.Phase, pod.Status.Message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Execute implements the Executer interface and runs commands inside a pod.
+// Each command is a separate exec in the same pod, so Execute is safe to
+// call concurrently.
+func (e *KubernetesExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	return e.ExecuteEnv(ctx, args, nil)
+}
+
+// ExecuteEnv implements the EnvExecuter interface. The exec API cannot set
+// the environment, so env is written to the command's stdin, one variable
+// per line, and exported before the command is executed. Args are quoted, so
+// they're not interpreted by the shell.
+func (e *KubernetesExecuter) ExecuteEnv(ctx context.Context, args []string, env []string) ([]byte, error) {
+	return e.executeScript(ctx, shellJoin(args), args, env)
+}
+
+// executeScript executes script with bash in the project's directory, args
+// are only used to report errors. The projPath isn't quoted, so $GOPATH is
+// expanded.
+func (e *KubernetesExecuter) executeScript(ctx context.Context, script string, args []string, env []string) ([]byte, error) {
+	// "cd e.projPath; script" ignore the errors from cd as the first command
+	// executed is the mkdir
+	cmd := []string{"bash", "-c", fmt.Sprintf(`cd %v; %v`, e.projPath, script)}
+
+	var stdin io.Reader
+	if len(env) > 0 {
+		cmd[2] = `while IFS= read -r env; do export "$env"; done; ` + cmd[2]
+		stdin = strings.NewReader(strings.Join(env, "\n") + "\n")
+	}
+
+	cmd = timeoutCmd(ctx, cmd)
+
+	buf := newLimitedBuffer(MaxOutputSize)
+	err := e.exec(ctx, e.pod, cmd, stdin, buf, buf)
+	if ctx.Err() == context.DeadlineExceeded {
+		// The exec's process is terminated by timeoutCmd.
+		return buf.Bytes(), &TimeoutError{args: args}
+	}
+	if exitErr, ok := err.(utilexec.ExitError); ok {
+		return buf.Bytes(), &NonZeroError{ExitCode: exitErr.ExitStatus(), args: args}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not exec cmd: %v in pod %v", cmd, e.pod.Name))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Stop deletes the pod ignoring any errors.
+func (e *KubernetesExecuter) Stop(ctx context.Context) error {
+	err := e.client.CoreV1().Pods(e.pod.Namespace).Delete(ctx, e.pod.Name, metav1.DeleteOptions{
+		GracePeriodSeconds: new(int64),
+	})
+	if err != nil {
+		log.Printf("could not delete pod %v: %v", e.pod.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// runningReactor sets the phase of created pods to phase.
+func runningReactor(phase corev1.PodPhase) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status.Phase = phase
+		return false, nil, nil // continue to the default reactor to store pod
+	}
+}
+
+func TestKubernetes(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", runningReactor(corev1.PodRunning))
+
+	var executed [][]string
+	exec := func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		executed = append(executed, cmd)
+		switch {
+		case strings.HasSuffix(cmd[2], "pwd"):
+			fmt.Fprintln(stdout, "/go/src/github.com/gopherci/gopherci")
+		case strings.HasSuffix(cmd[2], "false'"):
+			fmt.Fprintln(stderr, "error")
+			return utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+		}
+		return nil
+	}
+
+	requests := corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}
+	k8s := newKubernetes(client, exec, "gopherci", DockerDefaultImage, requests)
+	ctx := context.Background()
+
+	executer, err := k8s.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+
+	pods, err := client.CoreV1().Pods("gopherci").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing pods: %v", err)
+	}
+	if len(pods.Items) != 1 {
+		t.Fatalf("have %v pods, want 1", len(pods.Items))
+	}
+	pod := pods.Items[0]
+	if have := pod.Labels[KubernetesPodLabel]; have != KubernetesPodLabelValue {
+		t.Errorf("pod label have: %q want: %q", have, KubernetesPodLabelValue)
+	}
+	if have := pod.Spec.Containers[0].Image; have != DockerDefaultImage {
+		t.Errorf("pod image have: %q want: %q", have, DockerDefaultImage)
+	}
+	if have := pod.Spec.Containers[0].Resources.Requests; !reflect.DeepEqual(have, requests) {
+		t.Errorf("pod requests have: %v want: %v", have, requests)
+	}
+	if have := pod.Spec.Containers[0].SecurityContext; have != nil {
+		t.Errorf("pod security context have: %+v want: nil", have)
+	}
+
+	out, err := executer.Execute(ctx, []string{"pwd"})
+	if err != nil {
+		t.Errorf("unexpected error executing pwd: %v", err)
+	}
+	if want := "/go/src/github.com/gopherci/gopherci\n"; want != string(out) {
+		t.Errorf("\nwant %q\nhave %q", want, out)
+	}
+
+	// Ensure error codes are captured
+	out, err = executer.Execute(ctx, []string{"bash", "-c", ">&2 echo error; false"})
+	if want := "error\n"; want != string(out) {
+		t.Errorf("\nwant: %q\nhave: %q", want, out)
+	}
+	if nzErr, ok := err.(*NonZeroError); !ok || nzErr.ExitCode != 1 {
+		t.Errorf("have err: %#v, want NonZeroError with exit code 1", err)
+	}
+
+	want := [][]string{
+		{"bash", "-c", "cd $GOPATH/src/github.com/gopherci/gopherci; mkdir -p $GOPATH/src/github.com/gopherci/gopherci"},
+		{"bash", "-c", "cd $GOPATH/src/github.com/gopherci/gopherci; pwd"},
+		{"bash", "-c", "cd $GOPATH/src/github.com/gopherci/gopherci; bash -c '>&2 echo error; false'"},
+	}
+	if !reflect.DeepEqual(executed, want) {
+		t.Errorf("\nhave: %q\nwant: %q", executed, want)
+	}
+
+	err = executer.Stop(ctx)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	pods, err = client.CoreV1().Pods("gopherci").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing pods: %v", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("have %v pods after stop, want 0", len(pods.Items))
+	}
+}
+
+func TestKubernetes_restricted(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", runningReactor(corev1.PodRunning))
+	exec := func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		return nil
+	}
+	k8s := newKubernetes(client, exec, "gopherci", DockerDefaultImage, nil)
+	ctx := context.Background()
+
+	if _, err := k8s.NewRestrictedExecuter(ctx, "github.com/gopherci/gopherci", "1.8"); err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+
+	pods, err := client.CoreV1().Pods("gopherci").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing pods: %v", err)
+	}
+	if len(pods.Items) != 1 {
+		t.Fatalf("have %v pods, want 1", len(pods.Items))
+	}
+	sc := pods.Items[0].Spec.Containers[0].SecurityContext
+	switch {
+	case sc == nil:
+		t.Fatal("expected pod security context")
+	case sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation:
+		t.Errorf("expected privilege escalation to be disallowed")
+	case sc.Capabilities == nil || !reflect.DeepEqual(sc.Capabilities.Drop, []corev1.Capability{"ALL"}):
+		t.Errorf("expected all capabilities to be dropped, have: %+v", sc.Capabilities)
+	}
+}
+
+func TestKubernetes_env(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", runningReactor(corev1.PodRunning))
+
+	var (
+		executed []string
+		input    []byte
+	)
+	exec := func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		executed = cmd
+		if stdin != nil {
+			input, _ = ioutil.ReadAll(stdin)
+		}
+		return nil
+	}
+	k8s := newKubernetes(client, exec, "gopherci", DockerDefaultImage, nil)
+
+	executer, err := k8s.NewExecuter(context.Background(), "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+
+	_, err = executer.(EnvExecuter).ExecuteEnv(context.Background(), []string{"git", "clone"}, []string{"A=1", "B=two words"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `while IFS= read -r env; do export "$env"; done; cd $GOPATH/src/github.com/gopherci/gopherci; git clone`; executed[2] != want {
+		t.Errorf("cmd have: %q want: %q", executed[2], want)
+	}
+	if have, want := string(input), "A=1\nB=two words\n"; have != want {
+		t.Errorf("stdin have: %q want: %q", have, want)
+	}
+}
+
+func TestKubernetes_output(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", runningReactor(corev1.PodRunning))
+
+	// The exec API writes stdout and stderr from separate goroutines.
+	const lines = 100
+	exec := func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		var wg sync.WaitGroup
+		for _, w := range []io.Writer{stdout, stderr} {
+			wg.Add(1)
+			go func(w io.Writer) {
+				defer wg.Done()
+				for i := 0; i < lines; i++ {
+					fmt.Fprintln(w, "output")
+				}
+			}(w)
+		}
+		wg.Wait()
+		return nil
+	}
+	k8s := newKubernetes(client, exec, "gopherci", DockerDefaultImage, nil)
+
+	executer, err := k8s.NewExecuter(context.Background(), "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+
+	out, err := executer.Execute(context.Background(), []string{"tool"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, want := strings.Count(string(out), "output\n"), 2*lines; have != want {
+		t.Errorf("have %v lines of output, want %v", have, want)
+	}
+}
+
+func TestKubernetes_podFailed(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", runningReactor(corev1.PodFailed))
+
+	exec := func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		t.Errorf("unexpected exec: %v", cmd)
+		return nil
+	}
+
+	k8s := newKubernetes(client, exec, "gopherci", DockerDefaultImage, nil)
+	ctx := context.Background()
+
+	if _, err := k8s.NewExecuter(ctx, "github.com/gopherci/gopherci"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// Ensure pod was cleaned up
+	pods, err := client.CoreV1().Pods("gopherci").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing pods: %v", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("have %v pods, want 0", len(pods.Items))
+	}
+}
+
+func TestKubernetes_timeout(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", runningReactor(corev1.PodRunning))
+
+	exec := func(ctx context.Context, pod *corev1.Pod, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		if strings.HasSuffix(cmd[len(cmd)-1], "sleep 5") {
+			if cmd[0] != "timeout" {
+				t.Errorf("cmd have: %q, want wrapped with timeout", cmd)
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	k8s := newKubernetes(client, exec, "gopherci", DockerDefaultImage, nil)
+
+	executer, err := k8s.NewExecuter(context.Background(), "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = executer.Execute(ctx, []string{"sleep", "5"})
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Errorf("have err: %#v, want TimeoutError", err)
+	}
+}
+
+func TestKubernetes_reap(t *testing.T) {
+	now := time.Now()
+	pod := func(name string, created time.Time, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "gopherci",
+			Labels:            labels,
+			CreationTimestamp: metav1.NewTime(created),
+		}}
+	}
+	label := map[string]string{KubernetesPodLabel: KubernetesPodLabelValue}
+
+	client := fake.NewSimpleClientset(
+		pod("old", now.Add(-2*time.Hour), label),
+		pod("new", now, label),
+		pod("other", now.Add(-2*time.Hour), nil),
+	)
+	k8s := newKubernetes(client, nil, "gopherci", DockerDefaultImage, nil)
+	ctx := context.Background()
+
+	reaped, err := k8s.Reap(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reaped != 1 {
+		t.Errorf("reaped %v, want 1", reaped)
+	}
+
+	pods, err := client.CoreV1().Pods("gopherci").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing pods: %v", err)
+	}
+	var names []string
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"new", "other"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("have pods %v, want %v", names, want)
+	}
+}
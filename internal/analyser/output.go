@@ -0,0 +1,109 @@
+package analyser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// MaxOutputSize is the maximum number of bytes of combined stdout and stderr
+// an Executer captures from a single command, any further output is discarded
+// and a truncation marker is appended.
+var MaxOutputSize = 16 << 20 // 16 MiB
+
+// limitedBuffer is an io.Writer which buffers up to max bytes and discards
+// the remainder, recording the number of discarded bytes. It's safe to use
+// concurrently, so the same limitedBuffer can be used for stdout and stderr.
+type limitedBuffer struct {
+	mu        sync.Mutex // protects all fields below
+	buf       bytes.Buffer
+	max       int
+	discarded int
+}
+
+// newLimitedBuffer returns a limitedBuffer that buffers up to max bytes.
+func newLimitedBuffer(max int) *limitedBuffer {
+	return &limitedBuffer{max: max}
+}
+
+// Write implements the io.Writer interface. Write never returns an error, as
+// the command producing the output should not fail because of the limit.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	if remain := b.max - b.buf.Len(); remain < len(p) {
+		if remain < 0 {
+			remain = 0
+		}
+		b.discarded += len(p) - remain
+		p = p[:remain]
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// Bytes returns the buffered output, if any output was discarded a truncation
+// marker is appended.
+func (b *limitedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.discarded == 0 {
+		return b.buf.Bytes()
+	}
+	return append(b.buf.Bytes(), fmt.Sprintf("\n[output truncated, %d bytes discarded]\n", b.discarded)...)
+}
+
+// DefaultToolRegexp is the regexp used to parse a tool's output when the tool
+// does not define its own, matching output such as "file.go:1:2: message".
+const DefaultToolRegexp = `([^:]+):(\d+):(\d+)?:?\s*(.*)`
+
+// OutputIssue is an issue parsed from a single line of a tool's output.
+type OutputIssue struct {
+	File    string
+	Line    int
+	Col     int
+	Message string
+}
+
+// ParseOutput parses each line of a tool's output using the toolRegexp, or
+// DefaultToolRegexp if empty, in the same way issues are detected during an
+// analysis. The regexp's first four groups are the file, line, column and
+// message, lines which do not match or have an invalid line are skipped.
+func ParseOutput(toolRegexp string, output []byte) ([]OutputIssue, error) {
+	if toolRegexp == "" {
+		toolRegexp = DefaultToolRegexp
+	}
+	re, err := regexp.Compile(toolRegexp)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []OutputIssue
+	s := bufio.NewScanner(bytes.NewReader(output))
+	// Lines may be longer than the scanner's default limit, but not longer
+	// than the output limit, one more byte is needed to read the last line if
+	// it's the entire output.
+	s.Buffer(nil, MaxOutputSize+1)
+	for s.Scan() {
+		m := re.FindSubmatch(s.Bytes())
+		if len(m) < 3 {
+			continue
+		}
+		issue := OutputIssue{File: string(m[1])}
+		if issue.Line, err = strconv.Atoi(string(m[2])); err != nil {
+			continue
+		}
+		if len(m) > 3 {
+			issue.Col, _ = strconv.Atoi(string(m[3]))
+		}
+		if len(m) > 4 {
+			issue.Message = string(m[4])
+		}
+		issues = append(issues, issue)
+	}
+	return issues, s.Err()
+}
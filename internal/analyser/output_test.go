@@ -0,0 +1,95 @@
+package analyser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		max    int
+		writes []string
+		want   string
+	}{
+		{10, []string{"abc", "def"}, "abcdef"},
+		{6, []string{"abc", "def"}, "abcdef"},
+		{4, []string{"abc", "def"}, "abcd\n[output truncated, 2 bytes discarded]\n"},
+		{2, []string{"abc", "def"}, "ab\n[output truncated, 4 bytes discarded]\n"},
+		{0, []string{"abc"}, "\n[output truncated, 3 bytes discarded]\n"},
+	}
+
+	for _, test := range tests {
+		buf := newLimitedBuffer(test.max)
+		for _, w := range test.writes {
+			n, err := buf.Write([]byte(w))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if n != len(w) {
+				t.Errorf("wrote %v bytes want %v", n, len(w))
+			}
+		}
+		if have := string(buf.Bytes()); have != test.want {
+			t.Errorf("max: %v have: %q want: %q", test.max, have, test.want)
+		}
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	output := []byte("main.go:1:2: first\nignored line\nfoo/bar.go:10: second\n")
+
+	tests := []struct {
+		regexp string
+		want   []OutputIssue
+	}{
+		{"", []OutputIssue{
+			{File: "main.go", Line: 1, Col: 2, Message: "first"},
+			{File: "foo/bar.go", Line: 10, Message: "second"},
+		}},
+		{`^(foo/.+):(\d+)`, []OutputIssue{
+			{File: "foo/bar.go", Line: 10},
+		}},
+		{`^nomatch:(\d+)`, nil},
+	}
+
+	for _, test := range tests {
+		have, err := ParseOutput(test.regexp, output)
+		if err != nil {
+			t.Errorf("regexp %q unexpected error: %v", test.regexp, err)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("regexp %q\nhave: %+v\nwant: %+v", test.regexp, have, test.want)
+		}
+	}
+
+	if _, err := ParseOutput("(", output); err == nil {
+		t.Error("expected error for invalid regexp")
+	}
+}
+
+func TestParseOutput_longLines(t *testing.T) {
+	defer func(max int) { MaxOutputSize = max }(MaxOutputSize)
+	MaxOutputSize = 128 << 10
+
+	// Lines longer than bufio.Scanner's default limit are parsed.
+	long := "main.go:1: " + strings.Repeat("a", 100<<10)
+	have, err := ParseOutput("", []byte(long+"\nmain.go:2: short\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(have) != 2 || have[1].Line != 2 {
+		t.Errorf("unexpected issues parsed from long line: %v", len(have))
+	}
+
+	// Output limited to MaxOutputSize is parsed entirely.
+	output := "main.go:1: " + strings.Repeat("a", MaxOutputSize-len("main.go:1: "))
+	if have, err := ParseOutput("", []byte(output)); err != nil || len(have) != 1 {
+		t.Errorf("have %v issues, error: %v, want 1 issue", len(have), err)
+	}
+
+	// Lines longer than MaxOutputSize are reported.
+	if _, err := ParseOutput("", []byte(output+"a")); err == nil {
+		t.Error("expected error for line longer than MaxOutputSize")
+	}
+}
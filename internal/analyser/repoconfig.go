@@ -0,0 +1,106 @@
+package analyser
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RepoConfigFile is the name of the optional configuration file in the root
+// of a repository.
+const RepoConfigFile = ".gopherci.yml"
+
+// defaultIgnoredPaths are always ignored, as issues in these paths are not
+// the repository's own code.
+var defaultIgnoredPaths = []string{"vendor", "testdata"}
+
+// RepoConfig is the configuration read from a repository's RepoConfigFile.
+type RepoConfig struct {
+	// GeneratedPaths are globs matching generated files, which don't contain
+	// the standard generated code header. Issues in these paths are ignored.
+	GeneratedPaths []string `yaml:"generated"`
+	// IgnoredPaths are globs matching paths whose issues are ignored.
+	IgnoredPaths []string `yaml:"ignored"`
+	// GoVersion is the version of Go required to build the repository, such
+	// as "1.8". Optional, see Config.GoVersion.
+	GoVersion string `yaml:"go"`
+}
+
+// ParseRepoConfig parses the contents of a RepoConfigFile.
+func ParseRepoConfig(data []byte) (RepoConfig, error) {
+	var cfg RepoConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, errors.Wrapf(err, "could not parse %v", RepoConfigFile)
+	}
+	return cfg, nil
+}
+
+// GoModVersion returns the Go version from the go directive in the contents
+// of a go.mod file, or an empty string if there's no go directive.
+func GoModVersion(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "go" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// readRepoConfig reads RepoConfigFile from the executer's working directory,
+// if the file does not exist a zero RepoConfig is returned.
+func readRepoConfig(ctx context.Context, exec Executer) (RepoConfig, error) {
+	args := []string{"cat", RepoConfigFile}
+	out, err := exec.Execute(ctx, args)
+	switch err.(type) {
+	case nil:
+	case *NonZeroError:
+		// File does not exist (or cannot be read), use defaults.
+		return RepoConfig{}, nil
+	default:
+		return RepoConfig{}, errors.Wrapf(err, "could not execute %v", args)
+	}
+	return ParseRepoConfig(out)
+}
+
+// isIgnored returns true if issues in the file at path should be ignored.
+func (c RepoConfig) isIgnored(file string) bool {
+	for _, patterns := range [][]string{defaultIgnoredPaths, c.GeneratedPaths, c.IgnoredPaths} {
+		for _, pattern := range patterns {
+			if matchPath(pattern, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPath reports whether the slash separated file matches the glob
+// pattern, using the same syntax as path.Match. Similar to .gitignore, a
+// pattern without a slash matches any single element of the path, such as
+// "vendor" matching "a/vendor/b.go", and a pattern with a slash matches
+// relative to the root of the repository, either the file itself or any of
+// its parent directories, such as "a/*" matching "a/b/c.go".
+func matchPath(pattern, file string) bool {
+	pattern = strings.Trim(pattern, "/")
+	elems := strings.Split(file, "/")
+
+	if !strings.Contains(pattern, "/") {
+		for _, elem := range elems {
+			if ok, _ := path.Match(pattern, elem); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := range elems {
+		if ok, _ := path.Match(pattern, strings.Join(elems[:i+1], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
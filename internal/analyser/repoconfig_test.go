@@ -0,0 +1,89 @@
+package analyser
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestReadRepoConfig(t *testing.T) {
+	analyser := &mockAnalyser{
+		ExecuteOut: [][]byte{[]byte("generated:\n  - \"*.pb.go\"\nignored:\n  - internal/legacy\ngo: \"1.8\"\n")},
+		ExecuteErr: []error{nil},
+	}
+
+	have, err := readRepoConfig(context.Background(), analyser)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := RepoConfig{
+		GeneratedPaths: []string{"*.pb.go"},
+		IgnoredPaths:   []string{"internal/legacy"},
+		GoVersion:      "1.8",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestReadRepoConfig_notExist(t *testing.T) {
+	analyser := &mockAnalyser{
+		ExecuteOut: [][]byte{[]byte("cat: .gopherci.yml: No such file or directory")},
+		ExecuteErr: []error{&NonZeroError{ExitCode: 1}},
+	}
+
+	have, err := readRepoConfig(context.Background(), analyser)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if want := (RepoConfig{}); !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestGoModVersion(t *testing.T) {
+	tests := []struct {
+		gomod string
+		want  string
+	}{
+		{"module github.com/owner/repo\n\ngo 1.12\n\nrequire github.com/pkg/errors v0.8.1\n", "1.12"},
+		{"module github.com/owner/repo\ngo 1.21.3", "1.21.3"},
+		{"module github.com/owner/repo\n", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if have := GoModVersion([]byte(test.gomod)); have != test.want {
+			t.Errorf("gomod: %q have: %q want: %q", test.gomod, have, test.want)
+		}
+	}
+}
+
+func TestRepoConfig_isIgnored(t *testing.T) {
+	cfg := RepoConfig{
+		GeneratedPaths: []string{"*.pb.go"},
+		IgnoredPaths:   []string{"internal/legacy", "cmd/*/main.go"},
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"main.go", false},
+		{"vendor/foo/foo.go", true},
+		{"sub/vendor/foo.go", true},
+		{"testdata/foo.go", true},
+		{"api/api.pb.go", true},
+		{"internal/legacy/foo.go", true},
+		{"other/internal/legacy/foo.go", false},
+		{"cmd/tool/main.go", true},
+		{"cmd/tool/other.go", false},
+	}
+
+	for _, test := range tests {
+		if have := cfg.isIgnored(test.path); have != test.want {
+			t.Errorf("path: %v have: %v want: %v", test.path, have, test.want)
+		}
+	}
+}
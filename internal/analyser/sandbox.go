@@ -0,0 +1,167 @@
+package analyser
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sandboxGopath is the GOPATH inside the sandbox, the executer's GOPATH on
+// the host is mounted here. This matches the GOPATH of DockerDefaultImage.
+const sandboxGopath = "/go"
+
+// SandboxDefaultBinds are the host paths mounted read only inside each
+// sandbox, if they exist, to provide the tools and libraries needed to build
+// projects.
+var SandboxDefaultBinds = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/etc"}
+
+// Sandbox is an Analyser that provides an Executer to build projects on the
+// file system, with each command isolated using Linux namespaces via
+// bubblewrap (https://github.com/projectatomic/bubblewrap). Unlike Docker, no
+// daemon or root privileges are required, but unprivileged user namespaces
+// must be enabled.
+//
+// Each command can only see the read only binds, the project's GOPATH and a
+// private /tmp, and runs in its own PID, IPC, UTS and user namespaces, and
+// unless it's granted network access to clone the repository or install its
+// dependencies, its own network namespace with only a loopback interface.
+//
+// Sandbox is safe to use concurrently, as all directories are created with
+// random file names.
+type Sandbox struct {
+	base  string   // base is the base dir all projects have in common
+	bwrap string   // bwrap is the path to the bubblewrap binary
+	binds []string // binds are host paths mounted read only
+}
+
+// Ensure Sandbox implements Analyser, RestrictedAnalyser and Reaper
+var (
+	_ Analyser           = (*Sandbox)(nil)
+	_ RestrictedAnalyser = (*Sandbox)(nil)
+	_ Reaper             = (*Sandbox)(nil)
+)
+
+// NewSandbox returns a Sandbox which uses the path base to store each
+// project's GOPATH, and mounts SandboxDefaultBinds and binds read only inside
+// each sandbox. Binds should include the Go installation if it's not within
+// SandboxDefaultBinds, such as /usr/local/go.
+func NewSandbox(base string, binds []string) (*Sandbox, error) {
+	fs, err := NewFileSystem(base)
+	if err != nil {
+		return nil, err
+	}
+
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find bubblewrap")
+	}
+
+	return &Sandbox{
+		base:  fs.base,
+		bwrap: bwrap,
+		binds: append(append([]string(nil), SandboxDefaultBinds...), binds...),
+	}, nil
+}
+
+// NewExecuter implements the Analyser interface
+func (s *Sandbox) NewExecuter(_ context.Context, goSrcPath string) (Executer, error) {
+	e := &SandboxExecuter{
+		bwrap:    s.bwrap,
+		binds:    s.binds,
+		projpath: filepath.Join(sandboxGopath, "src", goSrcPath),
+	}
+	if err := e.fs.mktemp(s.base, goSrcPath); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// NewRestrictedExecuter implements the RestrictedAnalyser interface, each
+// command runs without any capabilities, even within its user namespace.
+// The Sandbox does not provide different versions of Go, so goVersion is
+// ignored.
+func (s *Sandbox) NewRestrictedExecuter(ctx context.Context, goSrcPath, _ string) (Executer, error) {
+	exec, err := s.NewExecuter(ctx, goSrcPath)
+	if err != nil {
+		return nil, err
+	}
+	exec.(*SandboxExecuter).restricted = true
+	return exec, nil
+}
+
+// Reap implements the Reaper interface by removing each executer's GOPATH
+// created before the time before.
+func (s *Sandbox) Reap(_ context.Context, before time.Time) (int, error) {
+	return reapDirs(s.base, before)
+}
+
+// SandboxExecuter is an Executer that runs commands in a sandbox.
+type SandboxExecuter struct {
+	fs         FileSystemExecuter // fs manages the GOPATH on the host
+	bwrap      string
+	binds      []string
+	projpath   string // projpath is the project path inside the sandbox
+	restricted bool   // restricted drops all capabilities
+}
+
+// Ensure SandboxExecuter implements Executer and EnvExecuter
+var _ EnvExecuter = (*SandboxExecuter)(nil)
+
+// Execute implements the Executer interface. Each command is a separate
+// sandbox sharing only the GOPATH, so Execute is safe to call concurrently.
+func (e *SandboxExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	return e.ExecuteEnv(ctx, args, nil)
+}
+
+// ExecuteEnv implements the EnvExecuter interface. Bubblewrap passes its
+// environment to the command, so env isn't visible in bubblewrap's arguments.
+func (e *SandboxExecuter) ExecuteEnv(ctx context.Context, args []string, env []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, e.bwrap)
+	cmd.Args = append([]string{e.bwrap}, e.bwrapArgs(networkGranted(ctx), args)...)
+	cmd.Env = append([]string{"GOPATH=" + sandboxGopath, "HOME=/tmp", "PATH=" + os.Getenv("PATH")}, env...)
+	out := newLimitedBuffer(MaxOutputSize)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return out.Bytes(), &TimeoutError{args: args}
+	}
+	if msg, ok := err.(*exec.ExitError); ok {
+		return out.Bytes(), &NonZeroError{ExitCode: msg.Sys().(syscall.WaitStatus).ExitStatus(), args: args}
+	}
+	return out.Bytes(), err
+}
+
+// bwrapArgs returns the arguments to bubblewrap to execute args inside the
+// sandbox, sharing the host's network if network is true.
+func (e *SandboxExecuter) bwrapArgs(network bool, args []string) []string {
+	bwrapArgs := []string{"--unshare-all", "--die-with-parent", "--new-session"}
+	if e.restricted {
+		bwrapArgs = append(bwrapArgs, "--cap-drop", "ALL")
+	}
+	if network {
+		bwrapArgs = append(bwrapArgs, "--share-net")
+	}
+	for _, bind := range e.binds {
+		bwrapArgs = append(bwrapArgs, "--ro-bind-try", bind, bind)
+	}
+	bwrapArgs = append(bwrapArgs,
+		"--bind", e.fs.gopath, sandboxGopath,
+		"--proc", "/proc",
+		"--dev", "/dev",
+		"--tmpfs", "/tmp",
+		"--chdir", e.projpath,
+		"--",
+	)
+	return append(bwrapArgs, args...)
+}
+
+// Stop implements the Executer interface
+func (e *SandboxExecuter) Stop(ctx context.Context) error {
+	return e.fs.Stop(ctx)
+}
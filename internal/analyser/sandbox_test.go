@@ -0,0 +1,118 @@
+package analyser
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestSandboxExecuter_bwrapArgs(t *testing.T) {
+	e := &SandboxExecuter{
+		fs:       FileSystemExecuter{gopath: "/tmp/123"},
+		binds:    []string{"/usr", "/usr/local/go"},
+		projpath: "/go/src/github.com/gopherci/gopherci",
+	}
+
+	tests := []struct {
+		network bool
+		args    []string
+		want    []string
+	}{
+		{
+			args: []string{"golint", "./..."},
+			want: []string{
+				"--unshare-all", "--die-with-parent", "--new-session",
+				"--ro-bind-try", "/usr", "/usr", "--ro-bind-try", "/usr/local/go", "/usr/local/go",
+				"--bind", "/tmp/123", "/go", "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp",
+				"--chdir", "/go/src/github.com/gopherci/gopherci", "--", "golint", "./...",
+			},
+		},
+		{
+			// Commands are only granted network access explicitly.
+			args: []string{"git", "clone", "https://github.com/gopherci/gopherci", "."},
+			want: []string{
+				"--unshare-all", "--die-with-parent", "--new-session",
+				"--ro-bind-try", "/usr", "/usr", "--ro-bind-try", "/usr/local/go", "/usr/local/go",
+				"--bind", "/tmp/123", "/go", "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp",
+				"--chdir", "/go/src/github.com/gopherci/gopherci", "--", "git", "clone", "https://github.com/gopherci/gopherci", ".",
+			},
+		},
+		{
+			network: true,
+			args:    []string{"git", "clone", "https://github.com/gopherci/gopherci", "."},
+			want: []string{
+				"--unshare-all", "--die-with-parent", "--new-session", "--share-net",
+				"--ro-bind-try", "/usr", "/usr", "--ro-bind-try", "/usr/local/go", "/usr/local/go",
+				"--bind", "/tmp/123", "/go", "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp",
+				"--chdir", "/go/src/github.com/gopherci/gopherci", "--", "git", "clone", "https://github.com/gopherci/gopherci", ".",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		have := e.bwrapArgs(test.network, test.args)
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("network: %v args: %q\nhave: %q\nwant: %q", test.network, test.args, have, test.want)
+		}
+	}
+
+	// Restricted executers drop all capabilities.
+	e.restricted = true
+	have := e.bwrapArgs(false, []string{"golint"})
+	if want := []string{"--unshare-all", "--die-with-parent", "--new-session", "--cap-drop", "ALL"}; !reflect.DeepEqual(have[:len(want)], want) {
+		t.Errorf("restricted\nhave: %q\nwant prefix: %q", have, want)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		t.Skip("bubblewrap is not installed")
+	}
+
+	sandbox, err := NewSandbox(os.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	exec, err := sandbox.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gopath := exec.(*SandboxExecuter).fs.gopath
+
+	out, err := exec.Execute(ctx, []string{"pwd"})
+	if err != nil {
+		t.Errorf("unexpected error: %v, output: %s", err, out)
+	}
+
+	// Ensure current working directory is project path inside the sandbox
+	if want := "/go/src/github.com/gopherci/gopherci\n"; want != string(out) {
+		t.Errorf("\nwant %q\nhave %q", want, out)
+	}
+
+	// Ensure files written inside the sandbox are visible to later commands
+	if out, err := exec.Execute(ctx, []string{"touch", "file"}); err != nil {
+		t.Errorf("unexpected error: %v, output: %s", err, out)
+	}
+	if !exists(gopath + "/src/github.com/gopherci/gopherci/file") {
+		t.Errorf("expected file to exist in %q", gopath)
+	}
+
+	// Ensure the host's file system outside the binds is not visible
+	_, err = exec.Execute(ctx, []string{"ls", gopath})
+	if _, ok := err.(*NonZeroError); !ok {
+		t.Errorf("have error %#v, want %T", err, &NonZeroError{})
+	}
+
+	err = exec.Stop(ctx)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if exists(gopath) {
+		t.Errorf("expected %q to be removed", gopath)
+	}
+}
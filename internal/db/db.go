@@ -4,6 +4,9 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -16,9 +19,39 @@ type DB interface {
 	// GetGHInstallation returns an installation for a given installationID, returns
 	// nil if no installation was found, or an error occurs.
 	GetGHInstallation(installationID int) (*GHInstallation, error)
-	// ListTools returns all tools. Returns nil if no tools were found, error will
-	// be non-nil if an error occurs.
-	ListTools() ([]Tool, error)
+	// ListUnapprovedGHInstallations returns the installations which are
+	// awaiting approval or have been denied, oldest first.
+	ListUnapprovedGHInstallations() ([]GHInstallation, error)
+	// ApproveGHInstallation enables the installation with installationID, so
+	// its repositories are analysed.
+	ApproveGHInstallation(installationID int) error
+	// DenyGHInstallation disables the installation with installationID, so
+	// its repositories are not analysed and it's no longer awaiting approval.
+	DenyGHInstallation(installationID int) error
+	// ListTools returns all enabled global tools and the enabled tools scoped
+	// to the installation with the ID ghInstallationID (not the GitHub
+	// installation ID), if ghInstallationID is 0 only global tools are
+	// returned. Tools are ordered by position. Returns nil if no tools were
+	// found, error will be non-nil if an error occurs.
+	ListTools(ghInstallationID int) ([]Tool, error)
+	// ListAllTools returns all tools, including disabled tools and tools
+	// scoped to any installation, but not removed tools, ordered by position.
+	ListAllTools() ([]Tool, error)
+	// ReorderTools sets the position of each tool to its index in toolIDs.
+	ReorderTools(toolIDs []ToolID) error
+	// ToolUsage returns the usage of each tool which has been used by at
+	// least one analysis.
+	ToolUsage() (map[ToolID]ToolUsage, error)
+	// GetTool returns a tool for a given toolID, returns nil if no tool was
+	// found, or an error occurs.
+	GetTool(toolID ToolID) (*Tool, error)
+	// AddTool validates and records a new tool, setting the tool's ID.
+	AddTool(tool *Tool) error
+	// UpdateTool validates and updates an existing tool.
+	UpdateTool(tool Tool) error
+	// RemoveTool removes a tool, so it's no longer listed or used, but the
+	// results of analyses which used it are kept.
+	RemoveTool(toolID ToolID) error
 	// StartAnalysis records a new analysis.
 	StartAnalysis(ghInstallationID, repositoryID int) (*Analysis, error)
 	// FinishAnalysis marks a status as finished.
@@ -26,6 +59,151 @@ type DB interface {
 	// GetAnalysis returns an analysis for a given analysisID, returns nil if no
 	// analysis was found, or an error occurs.
 	GetAnalysis(analysisID int) (*Analysis, error)
+	// GetLatestFullScan returns the latest successful full scan analysis of
+	// a repository, returns nil if the repository has not been fully scanned,
+	// or an error occurs.
+	GetLatestFullScan(repositoryID int) (*Analysis, error)
+	// GetPreviousAnalysis returns the latest successful analysis before
+	// analysis of the same kind, repository and ref, or for pull requests,
+	// the same pull request. Returns nil if there's no previous analysis, or
+	// an error occurs.
+	GetPreviousAnalysis(analysis *Analysis) (*Analysis, error)
+	// ListSchedules returns the schedules of the installation with the ID
+	// ghInstallationID (not the GitHub installation ID).
+	ListSchedules(ghInstallationID int) ([]Schedule, error)
+	// SetSchedule validates and records a schedule, replacing any existing
+	// schedule for the same installation and repository, and sets the
+	// schedule's ID. New schedules are due immediately.
+	SetSchedule(schedule *Schedule) error
+	// RemoveSchedule removes the schedule with scheduleID, if it belongs to
+	// the installation with the ID ghInstallationID.
+	RemoveSchedule(ghInstallationID, scheduleID int) error
+	// DueSchedules returns the schedules of enabled installations which are
+	// due to run at now.
+	DueSchedules(now time.Time) ([]Schedule, error)
+	// ClaimSchedule sets the next run of a schedule returned by DueSchedules
+	// to next, returning false if the schedule has already been claimed,
+	// such as by another instance.
+	ClaimSchedule(schedule Schedule, next time.Time) (bool, error)
+	// AddSuppression validates and records a suppression, setting its ID and
+	// CreatedAt. If the issue is already suppressed in the repository, the
+	// existing suppression is returned in suppression instead.
+	AddSuppression(suppression *Suppression) error
+	// ListSuppressions returns the suppressions of the installation with
+	// the ID ghInstallationID (not the GitHub installation ID), including
+	// revoked suppressions, newest first. If repositoryID is not 0, only
+	// the repository's suppressions are returned.
+	ListSuppressions(ghInstallationID, repositoryID int) ([]Suppression, error)
+	// RevokeSuppression revokes the suppression with suppressionID, if it
+	// belongs to the installation with the ID ghInstallationID and has not
+	// already been revoked, recording the GitHub user ID who revoked it.
+	// Returns ErrNotFound if no such suppression could be revoked.
+	RevokeSuppression(ghInstallationID, suppressionID, revokedBy int) error
+	// SuppressedFingerprints returns the fingerprints of the issues which
+	// are suppressed, and not revoked, in a repository.
+	SuppressedFingerprints(repositoryID int) (map[string]bool, error)
+	// AddIssueComments records the comments written for issues on a pull
+	// request, setting their ID and CreatedAt.
+	AddIssueComments(comments []IssueComment) error
+	// OpenIssueComments returns the comments written for issues on a pull
+	// request which have not been fixed, oldest first.
+	OpenIssueComments(repositoryID, requestNumber int) ([]IssueComment, error)
+	// FixIssueComment marks the comment with issueCommentID as fixed in the
+	// commit.
+	FixIssueComment(issueCommentID int, commit string) error
+	// GetSummaryComment returns the GitHub comment ID of a pull request's
+	// summary comment, or 0 if it has none.
+	GetSummaryComment(repositoryID, requestNumber int) (int, error)
+	// SetSummaryComment records the GitHub comment ID of a pull request's
+	// summary comment, replacing any existing comment ID.
+	SetSummaryComment(ghInstallationID, repositoryID, requestNumber, commentID int) error
+	// ApproveFork records the head commit sha of a pull request from a fork
+	// as approved for analysis.
+	ApproveFork(ghInstallationID, repositoryID, requestNumber int, sha string) error
+	// ForkApproved returns true if the head commit sha of a pull request from
+	// a fork was approved for analysis.
+	ForkApproved(repositoryID, requestNumber int, sha string) (bool, error)
+	// SetGHInstallationSettings validates and records the settings of the
+	// installation with the ID ghInstallationID (not the GitHub installation
+	// ID).
+	SetGHInstallationSettings(ghInstallationID int, settings InstallationSettings) error
+	// GetDepsCredentials returns the credentials used to install private
+	// dependencies of the installation with the ID ghInstallationID (not the
+	// GitHub installation ID), returns nil if the installation has none.
+	GetDepsCredentials(ghInstallationID int) (*DepsCredentials, error)
+	// SetDepsCredentials records the credentials used to install private
+	// dependencies of the installation with the ID ghInstallationID,
+	// replacing any existing credentials, if creds is nil they're removed.
+	SetDepsCredentials(ghInstallationID int, creds *DepsCredentials) error
+	// SetRepository records a repository, replacing the existing record of
+	// the repository, if any. If the repository was renamed or transferred,
+	// its schedules are updated.
+	SetRepository(repo Repository) error
+	// GetRepository returns the repository with repositoryID, returns nil if
+	// the repository has not been recorded, or an error occurs.
+	GetRepository(repositoryID int) (*Repository, error)
+	// ListRepositories returns the repositories covered by the installation
+	// with the ID ghInstallationID (not the GitHub installation ID).
+	ListRepositories(ghInstallationID int) ([]Repository, error)
+	// RemoveRepository records the repository with repositoryID is no longer
+	// covered by the installation with the ID ghInstallationID (not the
+	// GitHub installation ID), if it's currently covered by the installation.
+	RemoveRepository(ghInstallationID, repositoryID int) error
+	// PurgeRepository removes the repository with repositoryID and all its
+	// data, including analyses, comments, suppressions, schedules and webhook
+	// deliveries.
+	PurgeRepository(repositoryID int) error
+	// ReserveWebhookDelivery records a webhook delivery with a GUID as
+	// pending, before it's handled, and sets its ID. Returns false if a
+	// delivery with the same GUID was already recorded, unless it failed due
+	// to an internal error, or has been pending for longer than timeout, so
+	// concurrent redeliveries are only handled once.
+	ReserveWebhookDelivery(delivery *WebhookDelivery, timeout time.Duration) (bool, error)
+	// RecordWebhookDelivery records a webhook delivery and sets its ID. If a
+	// delivery with the same GUID was recorded, such as a redelivery or a
+	// replay, it's replaced and its attempts are incremented.
+	RecordWebhookDelivery(delivery *WebhookDelivery) error
+	// GetWebhookDelivery returns the webhook delivery with guid, including its
+	// payload, returns nil if the delivery has not been recorded, or an
+	// error occurs.
+	GetWebhookDelivery(guid string) (*WebhookDelivery, error)
+	// ListWebhookDeliveries returns the latest limit webhook deliveries, most
+	// recent first, without their payloads.
+	ListWebhookDeliveries(limit int) ([]WebhookDelivery, error)
+	// PruneWebhookDeliveries removes all webhook deliveries created before
+	// the time before, returning the number of deliveries removed.
+	PruneWebhookDeliveries(before time.Time) (int, error)
+	// ExpireAnalyses marks all pending analyses created before the time before
+	// as errored, returning the number of analyses marked.
+	ExpireAnalyses(before time.Time) (int, error)
+}
+
+// DeliveryResult represents a result in the webhook_deliveries table.
+type DeliveryResult string
+
+// DeliveryResult type/enum mappings to the webhook_deliveries table.
+const (
+	DeliveryResultPending   DeliveryResult = "Pending"   // Delivery is being handled.
+	DeliveryResultQueued    DeliveryResult = "Queued"    // Delivery's event was added to the queue.
+	DeliveryResultProcessed DeliveryResult = "Processed" // Delivery's event was handled immediately, such as an installation event.
+	DeliveryResultIgnored   DeliveryResult = "Ignored"   // Delivery's event is not handled.
+	DeliveryResultInvalid   DeliveryResult = "Invalid"   // Delivery failed validation or could not be parsed.
+	DeliveryResultError     DeliveryResult = "Error"     // Delivery's event failed due to an internal error.
+)
+
+// WebhookDelivery represents a row from the webhook_deliveries table.
+type WebhookDelivery struct {
+	ID           int            `db:"id"`
+	GUID         string         `db:"guid"`          // GUID is the X-GitHub-Delivery header, empty for invalid deliveries as it cannot be trusted.
+	Event        string         `db:"event"`         // Event is the X-GitHub-Event header.
+	RepositoryID int            `db:"repository_id"` // RepositoryID is the GitHub ID of the repository in the payload, 0 if none.
+	Payload      []byte         `db:"payload"`       // Payload is the request's body, nil for invalid deliveries.
+	Result       DeliveryResult `db:"result"`        // Result is how the delivery was handled.
+	Error        string         `db:"error"`         // Error is why the delivery was invalid or failed, if any.
+	Duration     Duration       `db:"duration"`      // Duration is the wall clock time taken to handle the delivery.
+	Attempts     int            `db:"attempts"`      // Attempts is the number of times the delivery was handled, including redeliveries and replays.
+	CreatedAt    time.Time      `db:"created_at"`
+	UpdatedAt    time.Time      `db:"updated_at"`
 }
 
 // AnalysisStatus represents a status in the analysis table.
@@ -68,7 +246,62 @@ type GHInstallation struct {
 	InstallationID int
 	AccountID      int
 	SenderID       int
+	GoVersion      string    // GoVersion is the default version of Go for repositories, if not empty.
+	SingleReview   bool      // SingleReview submits a pull request's issues as a single review.
+	ForkApproval   bool      // ForkApproval requires approval to analyse forks from first time contributors.
+	CreatedAt      time.Time // CreatedAt is when the installation was added.
 	enabledAt      time.Time
+	deniedAt       time.Time
+}
+
+// InstallationSettings are the settings of an installation, see
+// GHInstallation.
+type InstallationSettings struct {
+	GoVersion    string
+	SingleReview bool
+	ForkApproval bool
+}
+
+// goVersionRegexp matches a Go version such as 1.8 or 1.8.3.
+var goVersionRegexp = regexp.MustCompile(`^[1-9][0-9]*\.[0-9]+(\.[0-9]+)?$`)
+
+// Validate returns a ValidationError if the settings are invalid.
+func (s InstallationSettings) Validate() error {
+	if s.GoVersion != "" && !goVersionRegexp.MatchString(s.GoVersion) {
+		return &ValidationError{Field: "go_version", Msg: "must be a version of Go such as 1.8, or empty"}
+	}
+	return nil
+}
+
+// DepsCredentials are an installation's settings and credentials used to
+// install private dependencies. They're stored encrypted, and must not be
+// logged.
+type DepsCredentials struct {
+	// OrgToken provides the installation's access token to fetch private
+	// repositories of the analysed repository's owner.
+	OrgToken bool `json:"org_token"`
+	// GOPRIVATE is a comma separated list of glob patterns of private module
+	// path prefixes, see go help module-private.
+	GOPRIVATE string `json:"goprivate"`
+	// GOPROXY is the module proxy, its URLs may include credentials.
+	GOPROXY string `json:"goproxy"`
+	// Netrc is the contents of a .netrc file with credentials for hosts of
+	// private repositories.
+	Netrc string `json:"netrc"`
+}
+
+// Repository represents a row from the repositories table.
+type Repository struct {
+	ID             int    `db:"id"`                 // ID is the GitHub repository ID.
+	InstallationID int    `db:"gh_installation_id"` // InstallationID is the ID of the installation (not the GitHub installation ID) covering the repository, 0 if none.
+	Owner          string `db:"owner"`
+	Name           string `db:"name"`
+	Private        bool   `db:"private"`
+}
+
+// FullName returns the repository's owner and name, such as owner/repo.
+func (r Repository) FullName() string {
+	return r.Owner + "/" + r.Name
 }
 
 // IsEnabled returns true if the installation is enabled.
@@ -76,17 +309,184 @@ func (i GHInstallation) IsEnabled() bool {
 	return i.enabledAt.Before(time.Now()) && !i.enabledAt.IsZero()
 }
 
+// IsDenied returns true if the installation was denied by an operator.
+func (i GHInstallation) IsDenied() bool {
+	return !i.deniedAt.IsZero()
+}
+
 // ToolID is the primary key on the tools table.
 type ToolID int
 
 // Tool represents a single tool in the tools table.
 type Tool struct {
-	ID     ToolID `db:"id"`
-	Name   string `db:"name"`
-	URL    string `db:"url"`
-	Path   string `db:"path"`
-	Args   string `db:"args"`
-	Regexp string `db:"regexp"`
+	ID             ToolID   `db:"id"`
+	InstallationID int      `db:"gh_installation_id"` // InstallationID is the ID of the installation the tool is scoped to, 0 for global tools.
+	Name           string   `db:"name"`
+	URL            string   `db:"url"`
+	Path           string   `db:"path"`
+	Args           string   `db:"args"`
+	Regexp         string   `db:"regexp"`
+	Timeout        Duration `db:"timeout"`  // Timeout is the maximum duration of the tool, 0 uses the analyser's default.
+	Position       int      `db:"position"` // Position orders the tools, lowest first.
+	Disabled       bool     `db:"disabled"` // Disabled tools are not used by any analyses.
+}
+
+// ToolUsage summarises the analyses which have used a tool.
+type ToolUsage struct {
+	Analyses int       `db:"analyses"`  // Analyses is the number of analyses which used the tool.
+	Issues   int       `db:"issues"`    // Issues is the number of issues found by the tool.
+	Failures int       `db:"failures"`  // Failures is the number of analyses in which the tool did not succeed.
+	LastUsed time.Time `db:"last_used"` // LastUsed is when the tool was last used.
+}
+
+// Maximum lengths of a tool's fields, as defined by the tools table.
+const (
+	maxToolName   = 64
+	maxToolURL    = 128
+	maxToolPath   = 64
+	maxToolArgs   = 128
+	maxToolRegexp = 128
+)
+
+// ErrNotFound is returned when a value to be changed doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ValidationError is returned when a value is invalid and could not be
+// recorded.
+type ValidationError struct {
+	Field string // Field is the name of the invalid field.
+	Msg   string // Msg describes why the field is invalid.
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v %v", e.Field, e.Msg)
+}
+
+// Validate returns a ValidationError if the tool is invalid.
+func (t Tool) Validate() error {
+	for _, field := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"name", t.Name, maxToolName},
+		{"url", t.URL, maxToolURL},
+		{"path", t.Path, maxToolPath},
+		{"args", t.Args, maxToolArgs},
+		{"regexp", t.Regexp, maxToolRegexp},
+	} {
+		if len(field.value) > field.max {
+			return &ValidationError{Field: field.name, Msg: fmt.Sprintf("must be at most %d characters", field.max)}
+		}
+	}
+
+	switch {
+	case strings.TrimSpace(t.Name) == "":
+		return &ValidationError{Field: "name", Msg: "is required"}
+	case strings.TrimSpace(t.Path) == "":
+		return &ValidationError{Field: "path", Msg: "is required"}
+	case strings.ContainsAny(t.Path, " \t\n"):
+		return &ValidationError{Field: "path", Msg: "must not contain whitespace"}
+	case t.URL != "" && !strings.HasPrefix(t.URL, "https://") && !strings.HasPrefix(t.URL, "http://"):
+		return &ValidationError{Field: "url", Msg: "must be a http or https URL"}
+	case t.Timeout < 0:
+		return &ValidationError{Field: "timeout", Msg: "must not be negative"}
+	}
+
+	if _, err := regexp.Compile(t.Regexp); err != nil {
+		return &ValidationError{Field: "regexp", Msg: fmt.Sprintf("is invalid: %v", err)}
+	}
+	return nil
+}
+
+// MinScheduleInterval is the minimum interval between scheduled analyses.
+const MinScheduleInterval = time.Hour
+
+// Maximum lengths of a schedule's fields, as defined by the schedules table.
+const (
+	maxScheduleOwner = 255
+	maxScheduleRepo  = 255
+)
+
+// Schedule is a periodic full scan of a repository's default branch.
+type Schedule struct {
+	ID               int           // ID is the schedule's ID.
+	InstallationID   int           // InstallationID is the ID of the installation (not the GitHub installation ID).
+	GHInstallationID int           // GHInstallationID is the GitHub installation ID.
+	Owner            string        // Owner is the repository's owner.
+	Repo             string        // Repo is the repository's name.
+	Interval         time.Duration // Interval is the duration between each analysis.
+	NextRunAt        time.Time     // NextRunAt is when the next analysis is due.
+}
+
+// Validate returns a ValidationError if the schedule is invalid.
+func (s Schedule) Validate() error {
+	switch {
+	case strings.TrimSpace(s.Owner) == "":
+		return &ValidationError{Field: "owner", Msg: "is required"}
+	case strings.TrimSpace(s.Repo) == "":
+		return &ValidationError{Field: "repo", Msg: "is required"}
+	case len(s.Owner) > maxScheduleOwner:
+		return &ValidationError{Field: "owner", Msg: fmt.Sprintf("must be at most %d characters", maxScheduleOwner)}
+	case len(s.Repo) > maxScheduleRepo:
+		return &ValidationError{Field: "repo", Msg: fmt.Sprintf("must be at most %d characters", maxScheduleRepo)}
+	case s.Interval < MinScheduleInterval:
+		return &ValidationError{Field: "interval", Msg: fmt.Sprintf("must be at least %v", MinScheduleInterval)}
+	}
+	return nil
+}
+
+// maxSuppressionReason is the maximum length of a suppression's reason, as
+// defined by the suppressions table.
+const maxSuppressionReason = 1024
+
+// suppressionFingerprint matches a valid fingerprint.
+var suppressionFingerprint = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Suppression marks an issue in a repository as a false positive, so it's
+// no longer reported. Suppressions are never removed, only revoked, so
+// they can be audited.
+type Suppression struct {
+	ID             int        // ID is the suppression's ID.
+	InstallationID int        // InstallationID is the ID of the installation (not the GitHub installation ID).
+	RepositoryID   int        // RepositoryID is the GitHub repository ID.
+	Fingerprint    string     // Fingerprint is the suppressed issue's fingerprint.
+	Issue          string     // Issue is the suppressed issue, for reference.
+	Reason         string     // Reason is why the issue was suppressed, if given.
+	CreatedBy      int        // CreatedBy is the ID of the GitHub user who suppressed the issue.
+	CreatedAt      time.Time  // CreatedAt is when the issue was suppressed.
+	RevokedBy      int        // RevokedBy is the ID of the GitHub user who revoked the suppression, if revoked.
+	RevokedAt      *time.Time // RevokedAt is when the suppression was revoked, nil if not revoked.
+}
+
+// Validate returns a ValidationError if the suppression is invalid.
+func (s Suppression) Validate() error {
+	switch {
+	case s.RepositoryID == 0:
+		return &ValidationError{Field: "repository_id", Msg: "is required"}
+	case !suppressionFingerprint.MatchString(s.Fingerprint):
+		return &ValidationError{Field: "fingerprint", Msg: "must be 40 hexadecimal characters"}
+	case len(s.Reason) > maxSuppressionReason:
+		return &ValidationError{Field: "reason", Msg: fmt.Sprintf("must be at most %d characters", maxSuppressionReason)}
+	}
+	return nil
+}
+
+// IssueComment is a pull request comment written for an issue, which is
+// tracked so the comment can be updated once the issue is fixed.
+type IssueComment struct {
+	ID             int        // ID is the issue comment's ID.
+	InstallationID int        // InstallationID is the ID of the installation (not the GitHub installation ID).
+	RepositoryID   int        // RepositoryID is the GitHub repository ID.
+	RequestNumber  int        // RequestNumber is the pull request's number.
+	ToolID         ToolID     // ToolID is the ID of the tool which reported the issue.
+	CommentID      int        // CommentID is the GitHub pull request comment ID.
+	Fingerprint    string     // Fingerprint is the issue's fingerprint.
+	Issue          string     // Issue is the issue, as written in the comment.
+	CreatedAt      time.Time  // CreatedAt is when the comment was recorded.
+	FixedIn        string     // FixedIn is the commit in which the issue was fixed, if fixed.
+	FixedAt        *time.Time // FixedAt is when the issue was fixed, nil if not fixed.
 }
 
 // Duration is similar to a time.Duration but with extra methods to better
@@ -123,7 +523,10 @@ type Analysis struct {
 	RepositoryID   int            `db:"repository_id"`
 	CommitFrom     string         `db:"commit_from"`
 	CommitTo       string         `db:"commit_to"`
+	Ref            string         `db:"ref"` // Ref is the branch analysed, if known.
 	RequestNumber  int            `db:"request_number"`
+	FullScan       bool           `db:"full_scan"`            // FullScan is true if all issues in the repository at CommitTo were recorded.
+	PreviousID     int            `db:"previous_analysis_id"` // PreviousID is the analysis issues were tracked against, if any.
 	Status         AnalysisStatus `db:"status"`
 	CreatedAt      time.Time      `db:"created_at"`
 
@@ -141,11 +544,17 @@ func NewAnalysis() *Analysis {
 	}
 }
 
-// Issues returns all the issues by each tool as a slice.
+// Issues returns all the issues by each tool as a slice, ordered by ToolID.
 func (a *Analysis) Issues() []Issue {
+	var toolIDs []int
+	for toolID := range a.Tools {
+		toolIDs = append(toolIDs, int(toolID))
+	}
+	sort.Ints(toolIDs)
+
 	var issues []Issue
-	for _, tool := range a.Tools {
-		issues = append(issues, tool.Issues...)
+	for _, toolID := range toolIDs {
+		issues = append(issues, a.Tools[ToolID(toolID)].Issues...)
 	}
 	return issues
 }
@@ -161,12 +570,91 @@ func (a *Analysis) IsPush() bool {
 	return a.RequestNumber == 0
 }
 
+// Track sets the State of each of the analysis' issues, relative to the
+// previous analysis. An issue is existing if an issue with the same
+// fingerprint was in the previous analysis, otherwise it's new. If previous
+// is nil, all issues are new.
+func (a *Analysis) Track(previous *Analysis) {
+	seen := make(map[string]int)
+	if previous != nil {
+		a.PreviousID = previous.ID
+		for _, issue := range previous.Issues() {
+			seen[issue.Fingerprint]++
+		}
+	}
+
+	for toolID, tool := range a.Tools {
+		for i, issue := range tool.Issues {
+			tool.Issues[i].State = IssueStateNew
+			if issue.Fingerprint != "" && seen[issue.Fingerprint] > 0 {
+				seen[issue.Fingerprint]--
+				tool.Issues[i].State = IssueStateExisting
+			}
+		}
+		a.Tools[toolID] = tool
+	}
+}
+
+// FixedIssues returns the issues in the previous analysis which are not in
+// this analysis.
+func (a *Analysis) FixedIssues(previous *Analysis) []Issue {
+	seen := make(map[string]int)
+	for _, issue := range a.Issues() {
+		seen[issue.Fingerprint]++
+	}
+
+	var fixed []Issue
+	for _, issue := range previous.Issues() {
+		if issue.Fingerprint != "" && seen[issue.Fingerprint] > 0 {
+			seen[issue.Fingerprint]--
+			continue
+		}
+		fixed = append(fixed, issue)
+	}
+	return fixed
+}
+
+// AnalysisToolStatus represents a status in the analysis_tool table.
+type AnalysisToolStatus string
+
+// AnalysisToolStatus type/enum mappings to the analysis_tool table.
+const (
+	AnalysisToolStatusSuccess AnalysisToolStatus = "Success" // Tool ran and its issues were recorded.
+	AnalysisToolStatusFailure AnalysisToolStatus = "Failure" // Tool could not be executed or its output could not be read.
+	AnalysisToolStatusTimeout AnalysisToolStatus = "Timeout" // Tool did not finish before its timeout.
+	AnalysisToolStatusSkipped AnalysisToolStatus = "Skipped" // Tool was not ran as the analysis ran out of time.
+)
+
+var errUnknownAnalysisTool = errors.New("unknown analysis tool status")
+
+// Scan implements the sql.Scanner interface.
+func (s *AnalysisToolStatus) Scan(value interface{}) error {
+	if value == nil {
+		*s = AnalysisToolStatusSuccess
+		return nil
+	}
+	switch string(value.([]uint8)) {
+	case "Success":
+		*s = AnalysisToolStatusSuccess
+	case "Failure":
+		*s = AnalysisToolStatusFailure
+	case "Timeout":
+		*s = AnalysisToolStatusTimeout
+	case "Skipped":
+		*s = AnalysisToolStatusSkipped
+	default:
+		return errUnknownAnalysisTool
+	}
+	return nil
+}
+
 // AnalysisTool contains the timing and result of an individual tool's analysis.
 type AnalysisTool struct {
-	Tool     *Tool    // Tool is the tool.
-	ToolID   ToolID   // ToolID is the ID of the tool.
-	Duration Duration // Duration is the wall clock time taken to run the tool.
-	Issues   []Issue  // Issues maybe nil if no issues found.
+	Tool     *Tool              // Tool is the tool.
+	ToolID   ToolID             // ToolID is the ID of the tool.
+	Status   AnalysisToolStatus // Status is the result of running the tool.
+	Duration Duration           // Duration is the wall clock time taken to run the tool.
+	Issues   []Issue            // Issues maybe nil if no issues found.
 }
 
 // Issue contains file, position and string describing a single issue.
@@ -181,4 +669,19 @@ type Issue struct {
 	HunkPos int
 	// Issue is the issue.
 	Issue string // maybe this should be issue
+	// Fingerprint identifies the same issue in different analyses, even if
+	// its line has moved.
+	Fingerprint string
+	// State is whether the issue was in the previous analysis, empty if the
+	// issue was not tracked.
+	State IssueState
 }
+
+// IssueState represents a state in the issues table.
+type IssueState string
+
+// IssueState type/enum mappings to the issues table.
+const (
+	IssueStateNew      IssueState = "New"      // Issue was not in the previous analysis.
+	IssueStateExisting IssueState = "Existing" // Issue was in the previous analysis.
+)
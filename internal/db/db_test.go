@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -33,6 +34,32 @@ func TestAnalysisStatus_scan(t *testing.T) {
 	}
 }
 
+func TestAnalysisToolStatus_scan(t *testing.T) {
+	tests := []struct {
+		input interface{}
+		want  AnalysisToolStatus
+		err   error
+	}{
+		{nil, AnalysisToolStatusSuccess, nil},
+		{[]uint8("Success"), AnalysisToolStatusSuccess, nil},
+		{[]uint8("Failure"), AnalysisToolStatusFailure, nil},
+		{[]uint8("Timeout"), AnalysisToolStatusTimeout, nil},
+		{[]uint8("Skipped"), AnalysisToolStatusSkipped, nil},
+		{[]uint8("NA"), "", errUnknownAnalysisTool},
+	}
+
+	for _, test := range tests {
+		var status AnalysisToolStatus
+		err := status.Scan(test.input)
+		if err != test.err {
+			t.Errorf("unexpected error: have: %v want: %v", err, test.err)
+		}
+		if status != test.want {
+			t.Errorf("input: %#v have: %#v want %#v", test.input, status, test.want)
+		}
+	}
+}
+
 func TestDuration_scan(t *testing.T) {
 	tests := []struct {
 		input   interface{}
@@ -91,6 +118,58 @@ func TestAnalysis_issues(t *testing.T) {
 	}
 }
 
+func TestAnalysis_track(t *testing.T) {
+	previous := NewAnalysis()
+	previous.ID = 5
+	previous.Tools[1] = AnalysisTool{
+		Issues: []Issue{{Issue: "a", Fingerprint: "a"}, {Issue: "b", Fingerprint: "b"}, {Issue: "fixed", Fingerprint: "c"}},
+	}
+
+	analysis := NewAnalysis()
+	analysis.Tools[1] = AnalysisTool{
+		Issues: []Issue{{Issue: "a", Fingerprint: "a"}, {Issue: "a again", Fingerprint: "a"}, {Issue: "no fingerprint"}},
+	}
+	analysis.Tools[2] = AnalysisTool{
+		Issues: []Issue{{Issue: "b", Fingerprint: "b"}},
+	}
+
+	analysis.Track(previous)
+
+	if analysis.PreviousID != previous.ID {
+		t.Errorf("PreviousID have: %v want: %v", analysis.PreviousID, previous.ID)
+	}
+
+	want := []IssueState{IssueStateExisting, IssueStateNew, IssueStateNew, IssueStateExisting}
+	var have []IssueState
+	for _, issue := range analysis.Issues() {
+		have = append(have, issue.State)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("states\nhave: %v\nwant: %v", have, want)
+	}
+
+	fixed := []Issue{{Issue: "fixed", Fingerprint: "c"}}
+	if have := analysis.FixedIssues(previous); !reflect.DeepEqual(have, fixed) {
+		t.Errorf("fixed\nhave: %#v\nwant: %#v", have, fixed)
+	}
+}
+
+func TestAnalysis_trackNoPrevious(t *testing.T) {
+	analysis := NewAnalysis()
+	analysis.Tools[1] = AnalysisTool{
+		Issues: []Issue{{Issue: "a", Fingerprint: "a"}},
+	}
+
+	analysis.Track(nil)
+
+	if analysis.PreviousID != 0 {
+		t.Errorf("PreviousID have: %v want: 0", analysis.PreviousID)
+	}
+	if have := analysis.Issues()[0].State; have != IssueStateNew {
+		t.Errorf("state have: %v want: %v", have, IssueStateNew)
+	}
+}
+
 func TestAnalysis_htmlurl(t *testing.T) {
 	analysis := NewAnalysis()
 	analysis.ID = 10
@@ -122,3 +201,91 @@ func TestAnalysis_isPush(t *testing.T) {
 		}
 	}
 }
+
+func TestTool_validate(t *testing.T) {
+	valid := Tool{Name: "golint", URL: "https://github.com/golang/lint", Path: "golint", Args: "./...", Regexp: `(.*):(\d+):(.*)`}
+
+	tests := []struct {
+		modify func(*Tool)
+		field  string // field of ValidationError, empty if valid
+	}{
+		{func(t *Tool) {}, ""},
+		{func(t *Tool) { t.URL = "" }, ""},
+		{func(t *Tool) { t.Name = " " }, "name"},
+		{func(t *Tool) { t.Name = strings.Repeat("a", maxToolName+1) }, "name"},
+		{func(t *Tool) { t.Path = "" }, "path"},
+		{func(t *Tool) { t.Path = "go vet" }, "path"},
+		{func(t *Tool) { t.URL = "javascript:alert(1)" }, "url"},
+		{func(t *Tool) { t.Args = strings.Repeat("a", maxToolArgs+1) }, "args"},
+		{func(t *Tool) { t.Regexp = "(" }, "regexp"},
+		{func(t *Tool) { t.Timeout = -1 }, "timeout"},
+	}
+
+	for _, test := range tests {
+		tool := valid
+		test.modify(&tool)
+		err := tool.Validate()
+		switch verr, ok := err.(*ValidationError); {
+		case test.field == "" && err != nil:
+			t.Errorf("tool: %+v unexpected error: %v", tool, err)
+		case test.field != "" && (!ok || verr.Field != test.field):
+			t.Errorf("tool: %+v have error: %#v, want ValidationError for %v", tool, err, test.field)
+		}
+	}
+}
+
+func TestSchedule_validate(t *testing.T) {
+	valid := Schedule{Owner: "owner", Repo: "repo", Interval: 24 * time.Hour}
+
+	tests := []struct {
+		modify func(*Schedule)
+		field  string // field expected in ValidationError, empty if valid
+	}{
+		{func(s *Schedule) {}, ""},
+		{func(s *Schedule) { s.Interval = MinScheduleInterval }, ""},
+		{func(s *Schedule) { s.Owner = "" }, "owner"},
+		{func(s *Schedule) { s.Repo = " " }, "repo"},
+		{func(s *Schedule) { s.Repo = strings.Repeat("a", maxScheduleRepo+1) }, "repo"},
+		{func(s *Schedule) { s.Interval = time.Minute }, "interval"},
+	}
+
+	for _, test := range tests {
+		schedule := valid
+		test.modify(&schedule)
+		err := schedule.Validate()
+		switch verr, ok := err.(*ValidationError); {
+		case test.field == "" && err != nil:
+			t.Errorf("schedule: %+v unexpected error: %v", schedule, err)
+		case test.field != "" && (!ok || verr.Field != test.field):
+			t.Errorf("schedule: %+v have error: %#v, want ValidationError for %v", schedule, err, test.field)
+		}
+	}
+}
+
+func TestSuppression_validate(t *testing.T) {
+	valid := Suppression{RepositoryID: 1, Fingerprint: strings.Repeat("a1", 20), Issue: "golint: issue"}
+
+	tests := []struct {
+		modify func(*Suppression)
+		field  string // field expected in ValidationError, empty if valid
+	}{
+		{func(s *Suppression) {}, ""},
+		{func(s *Suppression) { s.Reason = strings.Repeat("a", maxSuppressionReason) }, ""},
+		{func(s *Suppression) { s.RepositoryID = 0 }, "repository_id"},
+		{func(s *Suppression) { s.Fingerprint = "" }, "fingerprint"},
+		{func(s *Suppression) { s.Fingerprint = strings.Repeat("A", 40) }, "fingerprint"},
+		{func(s *Suppression) { s.Reason = strings.Repeat("a", maxSuppressionReason+1) }, "reason"},
+	}
+
+	for _, test := range tests {
+		suppression := valid
+		test.modify(&suppression)
+		err := suppression.Validate()
+		switch verr, ok := err.(*ValidationError); {
+		case test.field == "" && err != nil:
+			t.Errorf("suppression: %+v unexpected error: %v", suppression, err)
+		case test.field != "" && (!ok || verr.Field != test.field):
+			t.Errorf("suppression: %+v have error: %#v, want ValidationError for %v", suppression, err, test.field)
+		}
+	}
+}
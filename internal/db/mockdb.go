@@ -1,6 +1,9 @@
 package db
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // MockDB is an in-memory database repository implementing the DB interface
 // used for testing
@@ -8,6 +11,17 @@ type MockDB struct {
 	installations map[int]GHInstallation // installationID -> exists
 	err           error
 	Tools         []Tool
+	RemovedTools  []Tool // RemovedTools are the tools removed by RemoveTool.
+	Usage         map[ToolID]ToolUsage
+	Schedules     []Schedule
+	Suppressions  []Suppression
+	IssueComments []IssueComment
+	Summaries     map[[2]int]int          // Summaries are the summary comment IDs, keyed by repository ID and request number.
+	Approvals     map[[2]int][]string     // Approvals are the approved head commits of forks, keyed by repository ID and request number.
+	Analyses      map[int]*Analysis       // Analyses are returned by GetAnalysis.
+	Deps          map[int]DepsCredentials // Deps are the deps credentials, keyed by installation ID.
+	Repositories  map[int]Repository      // Repositories are keyed by repository ID.
+	Deliveries    []WebhookDelivery       // Deliveries are the webhook deliveries, oldest first.
 }
 
 // Ensure MockDB implements DB
@@ -24,9 +38,11 @@ func (db *MockDB) ForceError(err error) {
 	db.err = err
 }
 
-// AddGHInstallation implements DB interface
+// AddGHInstallation implements DB interface, the installation's ID is the
+// same as installationID.
 func (db *MockDB) AddGHInstallation(installationID, accountID, senderID int) error {
 	db.installations[installationID] = GHInstallation{
+		ID:             installationID,
 		InstallationID: installationID,
 		AccountID:      accountID,
 		SenderID:       senderID,
@@ -48,6 +64,38 @@ func (db *MockDB) EnableGHInstallation(installationID int) error {
 	return db.err
 }
 
+// ListUnapprovedGHInstallations implements the DB interface.
+func (db *MockDB) ListUnapprovedGHInstallations() ([]GHInstallation, error) {
+	var installations []GHInstallation
+	for _, install := range db.installations {
+		if install.enabledAt.IsZero() {
+			installations = append(installations, install)
+		}
+	}
+	sort.Slice(installations, func(i, j int) bool {
+		return installations[i].ID < installations[j].ID
+	})
+	return installations, db.err
+}
+
+// ApproveGHInstallation implements the DB interface.
+func (db *MockDB) ApproveGHInstallation(installationID int) error {
+	if install, ok := db.installations[installationID]; ok {
+		install.enabledAt, install.deniedAt = time.Unix(1, 0), time.Time{}
+		db.installations[installationID] = install
+	}
+	return db.err
+}
+
+// DenyGHInstallation implements the DB interface.
+func (db *MockDB) DenyGHInstallation(installationID int) error {
+	if install, ok := db.installations[installationID]; ok {
+		install.enabledAt, install.deniedAt = time.Time{}, time.Unix(1, 0)
+		db.installations[installationID] = install
+	}
+	return db.err
+}
+
 // GetGHInstallation implements DB interface
 func (db *MockDB) GetGHInstallation(installationID int) (*GHInstallation, error) {
 	if installation, ok := db.installations[installationID]; ok {
@@ -57,14 +105,98 @@ func (db *MockDB) GetGHInstallation(installationID int) (*GHInstallation, error)
 }
 
 // ListTools implements DB interface
-func (db *MockDB) ListTools() ([]Tool, error) {
-	return db.Tools, nil
+func (db *MockDB) ListTools(ghInstallationID int) ([]Tool, error) {
+	var tools []Tool
+	for _, tool := range db.Tools {
+		if !tool.Disabled && (tool.InstallationID == 0 || tool.InstallationID == ghInstallationID) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools, db.err
+}
+
+// ListAllTools implements DB interface
+func (db *MockDB) ListAllTools() ([]Tool, error) {
+	tools := append([]Tool(nil), db.Tools...)
+	sort.SliceStable(tools, func(i, j int) bool { return tools[i].Position < tools[j].Position })
+	return tools, db.err
+}
+
+// ReorderTools implements DB interface
+func (db *MockDB) ReorderTools(toolIDs []ToolID) error {
+	for position, toolID := range toolIDs {
+		for i := range db.Tools {
+			if db.Tools[i].ID == toolID {
+				db.Tools[i].Position = position
+			}
+		}
+	}
+	return db.err
+}
+
+// ToolUsage implements DB interface
+func (db *MockDB) ToolUsage() (map[ToolID]ToolUsage, error) {
+	return db.Usage, db.err
+}
+
+// GetTool implements DB interface
+func (db *MockDB) GetTool(toolID ToolID) (*Tool, error) {
+	for _, tool := range db.Tools {
+		if tool.ID == toolID {
+			return &tool, db.err
+		}
+	}
+	return nil, db.err
+}
+
+// AddTool implements DB interface
+func (db *MockDB) AddTool(tool *Tool) error {
+	if err := tool.Validate(); err != nil {
+		return err
+	}
+	// Like an auto increment, removed tools' IDs aren't reused.
+	tool.ID = 1
+	for _, tools := range [][]Tool{db.Tools, db.RemovedTools} {
+		for _, t := range tools {
+			if t.ID >= tool.ID {
+				tool.ID = t.ID + 1
+			}
+		}
+	}
+	db.Tools = append(db.Tools, *tool)
+	return db.err
+}
+
+// UpdateTool implements DB interface
+func (db *MockDB) UpdateTool(tool Tool) error {
+	if err := tool.Validate(); err != nil {
+		return err
+	}
+	for i, t := range db.Tools {
+		if t.ID == tool.ID {
+			db.Tools[i] = tool
+		}
+	}
+	return db.err
+}
+
+// RemoveTool implements DB interface
+func (db *MockDB) RemoveTool(toolID ToolID) error {
+	for i, t := range db.Tools {
+		if t.ID == toolID {
+			db.RemovedTools = append(db.RemovedTools, t)
+			db.Tools = append(db.Tools[:i], db.Tools[i+1:]...)
+			break
+		}
+	}
+	return db.err
 }
 
 // StartAnalysis implements the DB interface.
 func (db *MockDB) StartAnalysis(ghInstallationID, repositoryID int) (*Analysis, error) {
 	analysis := NewAnalysis()
 	analysis.ID = 99
+	analysis.RepositoryID = repositoryID
 	return analysis, nil
 }
 
@@ -75,5 +207,419 @@ func (db *MockDB) FinishAnalysis(analysisID int, status AnalysisStatus, analysis
 
 // GetAnalysis implements the DB interface.
 func (db *MockDB) GetAnalysis(analysisID int) (*Analysis, error) {
+	return db.Analyses[analysisID], db.err
+}
+
+// GetPreviousAnalysis implements the DB interface.
+func (db *MockDB) GetPreviousAnalysis(analysis *Analysis) (*Analysis, error) {
 	return nil, nil
 }
+
+// GetLatestFullScan implements the DB interface.
+func (db *MockDB) GetLatestFullScan(repositoryID int) (*Analysis, error) {
+	var latest *Analysis
+	for _, analysis := range db.Analyses {
+		if analysis.RepositoryID == repositoryID && analysis.FullScan && analysis.Status == AnalysisStatusSuccess && (latest == nil || analysis.ID > latest.ID) {
+			latest = analysis
+		}
+	}
+	return latest, db.err
+}
+
+// ListSchedules implements the DB interface.
+func (db *MockDB) ListSchedules(ghInstallationID int) ([]Schedule, error) {
+	var schedules []Schedule
+	for _, schedule := range db.Schedules {
+		if schedule.InstallationID == ghInstallationID {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, db.err
+}
+
+// SetSchedule implements the DB interface.
+func (db *MockDB) SetSchedule(schedule *Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	for _, install := range db.installations {
+		if install.ID == schedule.InstallationID {
+			schedule.GHInstallationID = install.InstallationID
+		}
+	}
+	for i, s := range db.Schedules {
+		if s.InstallationID == schedule.InstallationID && s.Owner == schedule.Owner && s.Repo == schedule.Repo {
+			schedule.ID, schedule.NextRunAt = s.ID, s.NextRunAt
+			db.Schedules[i] = *schedule
+			return db.err
+		}
+	}
+	schedule.ID = len(db.Schedules) + 1
+	schedule.NextRunAt = time.Now()
+	db.Schedules = append(db.Schedules, *schedule)
+	return db.err
+}
+
+// RemoveSchedule implements the DB interface.
+func (db *MockDB) RemoveSchedule(ghInstallationID, scheduleID int) error {
+	for i, s := range db.Schedules {
+		if s.InstallationID == ghInstallationID && s.ID == scheduleID {
+			db.Schedules = append(db.Schedules[:i], db.Schedules[i+1:]...)
+			break
+		}
+	}
+	return db.err
+}
+
+// DueSchedules implements the DB interface.
+func (db *MockDB) DueSchedules(now time.Time) ([]Schedule, error) {
+	var schedules []Schedule
+	for _, schedule := range db.Schedules {
+		if !schedule.NextRunAt.After(now) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, db.err
+}
+
+// ClaimSchedule implements the DB interface.
+func (db *MockDB) ClaimSchedule(schedule Schedule, next time.Time) (bool, error) {
+	for i, s := range db.Schedules {
+		if s.ID == schedule.ID && s.NextRunAt.Equal(schedule.NextRunAt) {
+			db.Schedules[i].NextRunAt = next
+			return true, db.err
+		}
+	}
+	return false, db.err
+}
+
+// AddSuppression implements the DB interface.
+func (db *MockDB) AddSuppression(suppression *Suppression) error {
+	if err := suppression.Validate(); err != nil {
+		return err
+	}
+	for _, s := range db.Suppressions {
+		if s.RepositoryID == suppression.RepositoryID && s.Fingerprint == suppression.Fingerprint && s.RevokedAt == nil {
+			*suppression = s
+			return db.err
+		}
+	}
+	suppression.ID = len(db.Suppressions) + 1
+	suppression.CreatedAt = time.Now()
+	db.Suppressions = append(db.Suppressions, *suppression)
+	return db.err
+}
+
+// ListSuppressions implements the DB interface.
+func (db *MockDB) ListSuppressions(ghInstallationID, repositoryID int) ([]Suppression, error) {
+	var suppressions []Suppression
+	for i := len(db.Suppressions) - 1; i >= 0; i-- {
+		s := db.Suppressions[i]
+		if s.InstallationID == ghInstallationID && (repositoryID == 0 || s.RepositoryID == repositoryID) {
+			suppressions = append(suppressions, s)
+		}
+	}
+	return suppressions, db.err
+}
+
+// RevokeSuppression implements the DB interface.
+func (db *MockDB) RevokeSuppression(ghInstallationID, suppressionID, revokedBy int) error {
+	for i, s := range db.Suppressions {
+		if s.InstallationID == ghInstallationID && s.ID == suppressionID && s.RevokedAt == nil {
+			now := time.Now()
+			db.Suppressions[i].RevokedBy, db.Suppressions[i].RevokedAt = revokedBy, &now
+			return db.err
+		}
+	}
+	return ErrNotFound
+}
+
+// SuppressedFingerprints implements the DB interface.
+func (db *MockDB) SuppressedFingerprints(repositoryID int) (map[string]bool, error) {
+	suppressed := make(map[string]bool)
+	for _, s := range db.Suppressions {
+		if s.RepositoryID == repositoryID && s.RevokedAt == nil {
+			suppressed[s.Fingerprint] = true
+		}
+	}
+	return suppressed, db.err
+}
+
+// AddIssueComments implements the DB interface.
+func (db *MockDB) AddIssueComments(comments []IssueComment) error {
+	for i := range comments {
+		comments[i].ID = len(db.IssueComments) + 1
+		comments[i].CreatedAt = time.Now()
+		db.IssueComments = append(db.IssueComments, comments[i])
+	}
+	return db.err
+}
+
+// OpenIssueComments implements the DB interface.
+func (db *MockDB) OpenIssueComments(repositoryID, requestNumber int) ([]IssueComment, error) {
+	var comments []IssueComment
+	for _, c := range db.IssueComments {
+		if c.RepositoryID == repositoryID && c.RequestNumber == requestNumber && c.FixedAt == nil {
+			comments = append(comments, c)
+		}
+	}
+	return comments, db.err
+}
+
+// FixIssueComment implements the DB interface.
+func (db *MockDB) FixIssueComment(issueCommentID int, commit string) error {
+	for i, c := range db.IssueComments {
+		if c.ID == issueCommentID && c.FixedAt == nil {
+			now := time.Now()
+			db.IssueComments[i].FixedIn, db.IssueComments[i].FixedAt = commit, &now
+		}
+	}
+	return db.err
+}
+
+// GetSummaryComment implements the DB interface.
+func (db *MockDB) GetSummaryComment(repositoryID, requestNumber int) (int, error) {
+	return db.Summaries[[2]int{repositoryID, requestNumber}], db.err
+}
+
+// SetSummaryComment implements the DB interface.
+func (db *MockDB) SetSummaryComment(ghInstallationID, repositoryID, requestNumber, commentID int) error {
+	if db.Summaries == nil {
+		db.Summaries = make(map[[2]int]int)
+	}
+	db.Summaries[[2]int{repositoryID, requestNumber}] = commentID
+	return db.err
+}
+
+// ApproveFork implements the DB interface.
+func (db *MockDB) ApproveFork(ghInstallationID, repositoryID, requestNumber int, sha string) error {
+	if db.Approvals == nil {
+		db.Approvals = make(map[[2]int][]string)
+	}
+	key := [2]int{repositoryID, requestNumber}
+	db.Approvals[key] = append(db.Approvals[key], sha)
+	return db.err
+}
+
+// ForkApproved implements the DB interface.
+func (db *MockDB) ForkApproved(repositoryID, requestNumber int, sha string) (bool, error) {
+	for _, approved := range db.Approvals[[2]int{repositoryID, requestNumber}] {
+		if approved == sha {
+			return true, db.err
+		}
+	}
+	return false, db.err
+}
+
+// GetDepsCredentials implements the DB interface.
+func (db *MockDB) GetDepsCredentials(ghInstallationID int) (*DepsCredentials, error) {
+	creds, ok := db.Deps[ghInstallationID]
+	if !ok {
+		return nil, db.err
+	}
+	return &creds, db.err
+}
+
+// SetGHInstallationSettings implements the DB interface.
+func (db *MockDB) SetGHInstallationSettings(ghInstallationID int, settings InstallationSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	for installationID, install := range db.installations {
+		if install.ID == ghInstallationID {
+			install.GoVersion, install.SingleReview, install.ForkApproval = settings.GoVersion, settings.SingleReview, settings.ForkApproval
+			db.installations[installationID] = install
+		}
+	}
+	return db.err
+}
+
+// SetDepsCredentials implements the DB interface.
+func (db *MockDB) SetDepsCredentials(ghInstallationID int, creds *DepsCredentials) error {
+	if db.Deps == nil {
+		db.Deps = make(map[int]DepsCredentials)
+	}
+	delete(db.Deps, ghInstallationID)
+	if creds != nil {
+		db.Deps[ghInstallationID] = *creds
+	}
+	return db.err
+}
+
+// SetRepository implements the DB interface.
+func (db *MockDB) SetRepository(repo Repository) error {
+	if db.Repositories == nil {
+		db.Repositories = make(map[int]Repository)
+	}
+	if existing, ok := db.Repositories[repo.ID]; ok {
+		for i, schedule := range db.Schedules {
+			if schedule.InstallationID == existing.InstallationID && schedule.Owner == existing.Owner && schedule.Repo == existing.Name {
+				db.Schedules[i].Owner, db.Schedules[i].Repo = repo.Owner, repo.Name
+			}
+		}
+	}
+	db.Repositories[repo.ID] = repo
+	return db.err
+}
+
+// GetRepository implements the DB interface.
+func (db *MockDB) GetRepository(repositoryID int) (*Repository, error) {
+	repo, ok := db.Repositories[repositoryID]
+	if !ok {
+		return nil, db.err
+	}
+	return &repo, db.err
+}
+
+// ListRepositories implements the DB interface.
+func (db *MockDB) ListRepositories(ghInstallationID int) ([]Repository, error) {
+	var repos []Repository
+	for _, repo := range db.Repositories {
+		if repo.InstallationID == ghInstallationID {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].FullName() < repos[j].FullName()
+	})
+	return repos, db.err
+}
+
+// RemoveRepository implements the DB interface.
+func (db *MockDB) RemoveRepository(ghInstallationID, repositoryID int) error {
+	if repo, ok := db.Repositories[repositoryID]; ok && repo.InstallationID == ghInstallationID {
+		repo.InstallationID = 0
+		db.Repositories[repositoryID] = repo
+	}
+	return db.err
+}
+
+// PurgeRepository implements the DB interface.
+func (db *MockDB) PurgeRepository(repositoryID int) error {
+	repo := db.Repositories[repositoryID]
+	var schedules []Schedule
+	for _, schedule := range db.Schedules {
+		if schedule.InstallationID != repo.InstallationID || schedule.Owner != repo.Owner || schedule.Repo != repo.Name {
+			schedules = append(schedules, schedule)
+		}
+	}
+	db.Schedules = schedules
+	for analysisID, analysis := range db.Analyses {
+		if analysis.RepositoryID == repositoryID {
+			delete(db.Analyses, analysisID)
+		}
+	}
+	var comments []IssueComment
+	for _, comment := range db.IssueComments {
+		if comment.RepositoryID != repositoryID {
+			comments = append(comments, comment)
+		}
+	}
+	db.IssueComments = comments
+	for key := range db.Summaries {
+		if key[0] == repositoryID {
+			delete(db.Summaries, key)
+		}
+	}
+	for key := range db.Approvals {
+		if key[0] == repositoryID {
+			delete(db.Approvals, key)
+		}
+	}
+	var suppressions []Suppression
+	for _, suppression := range db.Suppressions {
+		if suppression.RepositoryID != repositoryID {
+			suppressions = append(suppressions, suppression)
+		}
+	}
+	db.Suppressions = suppressions
+	var deliveries []WebhookDelivery
+	for _, delivery := range db.Deliveries {
+		if delivery.RepositoryID != repositoryID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	db.Deliveries = deliveries
+	delete(db.Repositories, repositoryID)
+	return db.err
+}
+
+// ReserveWebhookDelivery implements the DB interface.
+func (db *MockDB) ReserveWebhookDelivery(delivery *WebhookDelivery, timeout time.Duration) (bool, error) {
+	for i, existing := range db.Deliveries {
+		if existing.GUID == delivery.GUID {
+			abandoned := existing.Result == DeliveryResultPending && time.Since(existing.UpdatedAt) > timeout
+			if existing.Result != DeliveryResultError && !abandoned {
+				return false, db.err
+			}
+			db.Deliveries[i].Result, db.Deliveries[i].UpdatedAt = DeliveryResultPending, time.Now()
+			delivery.ID, delivery.Result = existing.ID, DeliveryResultPending
+			return true, db.err
+		}
+	}
+	delivery.ID, delivery.Result = len(db.Deliveries)+1, DeliveryResultPending
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	if delivery.UpdatedAt.IsZero() {
+		delivery.UpdatedAt = time.Now()
+	}
+	db.Deliveries = append(db.Deliveries, *delivery)
+	return true, db.err
+}
+
+// RecordWebhookDelivery implements the DB interface.
+func (db *MockDB) RecordWebhookDelivery(delivery *WebhookDelivery) error {
+	for i, existing := range db.Deliveries {
+		if delivery.GUID != "" && existing.GUID == delivery.GUID {
+			delivery.ID, delivery.Attempts, delivery.CreatedAt = existing.ID, existing.Attempts+1, existing.CreatedAt
+			db.Deliveries = append(append(db.Deliveries[:i:i], db.Deliveries[i+1:]...), *delivery)
+			return db.err
+		}
+	}
+	delivery.ID, delivery.Attempts = len(db.Deliveries)+1, 1
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	db.Deliveries = append(db.Deliveries, *delivery)
+	return db.err
+}
+
+// GetWebhookDelivery implements the DB interface.
+func (db *MockDB) GetWebhookDelivery(guid string) (*WebhookDelivery, error) {
+	for _, delivery := range db.Deliveries {
+		if delivery.GUID == guid {
+			return &delivery, db.err
+		}
+	}
+	return nil, db.err
+}
+
+// ListWebhookDeliveries implements the DB interface.
+func (db *MockDB) ListWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	for i := len(db.Deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		delivery := db.Deliveries[i]
+		delivery.Payload = nil
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, db.err
+}
+
+// PruneWebhookDeliveries implements the DB interface.
+func (db *MockDB) PruneWebhookDeliveries(before time.Time) (int, error) {
+	var deliveries []WebhookDelivery
+	for _, delivery := range db.Deliveries {
+		if !delivery.CreatedAt.Before(before) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	pruned := len(db.Deliveries) - len(deliveries)
+	db.Deliveries = deliveries
+	return pruned, db.err
+}
+
+// ExpireAnalyses implements the DB interface.
+func (db *MockDB) ExpireAnalyses(before time.Time) (int, error) {
+	return 0, db.err
+}
@@ -20,6 +20,7 @@ func TestMockDB(t *testing.T) {
 	}
 
 	want := &GHInstallation{
+		ID:             installationID,
 		InstallationID: installationID,
 		AccountID:      accountID,
 		SenderID:       senderID,
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SecretKeySize is the size in bytes of the key used to encrypt secrets.
+const SecretKeySize = 32
+
+// ErrNoSecretKey is returned when reading or writing a secret without a key.
+var ErrNoSecretKey = errors.New("no secret key configured to encrypt secrets")
+
+// secretBox encrypts and decrypts secrets stored in the database using
+// AES-256-GCM, each ciphertext is prefixed with its random nonce.
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// newSecretBox returns a secretBox using key, which must be SecretKeySize
+// bytes.
+func newSecretBox(key []byte) (*secretBox, error) {
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("secret key must be %d bytes, have %d bytes", SecretKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+// seal encrypts plaintext.
+func (b *secretBox) seal(plaintext []byte) ([]byte, error) {
+	if b == nil {
+		return nil, ErrNoSecretKey
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts ciphertext encrypted by seal.
+func (b *secretBox) open(ciphertext []byte) ([]byte, error) {
+	if b == nil {
+		return nil, ErrNoSecretKey
+	}
+	if len(ciphertext) < b.aead.NonceSize() {
+		return nil, errors.New("secret is too short")
+	}
+	nonce, ciphertext := ciphertext[:b.aead.NonceSize()], ciphertext[b.aead.NonceSize():]
+	return b.aead.Open(nil, nonce, ciphertext, nil)
+}
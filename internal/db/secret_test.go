@@ -0,0 +1,55 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSecretBox(t *testing.T) {
+	if _, err := newSecretBox([]byte("short")); err == nil {
+		t.Error("expected error for short key, got nil")
+	}
+
+	box, err := newSecretBox(bytes.Repeat([]byte{1}, SecretKeySize))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	plaintext := []byte("machine example.com password secret")
+	ciphertext, err := box.seal(plaintext)
+	if err != nil {
+		t.Fatalf("unexpected error sealing: %v", err)
+	}
+	if bytes.Contains(ciphertext, []byte("secret")) {
+		t.Errorf("ciphertext contains plaintext: %q", ciphertext)
+	}
+	if again, _ := box.seal(plaintext); bytes.Equal(again, ciphertext) {
+		t.Errorf("expected unique nonces, have the same ciphertext")
+	}
+
+	have, err := box.open(ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected error opening: %v", err)
+	}
+	if !bytes.Equal(have, plaintext) {
+		t.Errorf("have: %q want: %q", have, plaintext)
+	}
+
+	// Modified ciphertexts and short ciphertexts are rejected.
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := box.open(ciphertext); err == nil {
+		t.Error("expected error for modified ciphertext, got nil")
+	}
+	if _, err := box.open([]byte{1}); err == nil {
+		t.Error("expected error for short ciphertext, got nil")
+	}
+
+	// Without a key, secrets cannot be sealed or opened.
+	var none *secretBox
+	if _, err := none.seal(plaintext); err != ErrNoSecretKey {
+		t.Errorf("have err: %v want: %v", err, ErrNoSecretKey)
+	}
+	if _, err := none.open(ciphertext); err != ErrNoSecretKey {
+		t.Errorf("have err: %v want: %v", err, ErrNoSecretKey)
+	}
+}
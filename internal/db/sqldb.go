@@ -2,24 +2,36 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
 // SQLDB is a sql database repository implementing the DB interface.
 type SQLDB struct {
-	sqlx *sqlx.DB
+	sqlx    *sqlx.DB
+	secrets *secretBox // secrets encrypts secrets, nil if there's no secret key
 }
 
 // Ensure SQLDB implements DB.
 var _ DB = (*SQLDB)(nil)
 
-// NewSQLDB returns an SQLDB.
-func NewSQLDB(sqlDB *sql.DB, driverName string) (*SQLDB, error) {
+// NewSQLDB returns an SQLDB. Secrets, such as credentials, are encrypted using
+// secretKey, which must be SecretKeySize bytes. If secretKey is nil, secrets
+// cannot be stored or read.
+func NewSQLDB(sqlDB *sql.DB, driverName string, secretKey []byte) (*SQLDB, error) {
 	db := &SQLDB{
 		sqlx: sqlx.NewDb(sqlDB, driverName),
 	}
+	if secretKey != nil {
+		var err error
+		if db.secrets, err = newSecretBox(secretKey); err != nil {
+			return nil, err
+		}
+	}
 	if err := db.sqlx.Ping(); err != nil {
 		return nil, err
 	}
@@ -41,41 +53,187 @@ func (db *SQLDB) RemoveGHInstallation(installationID int) error {
 	return err
 }
 
+// ghInstallationRow is a row from the gh_installations table.
+type ghInstallationRow struct {
+	ID             int            `db:"id"`
+	InstallationID int            `db:"installation_id"`
+	AccountID      int            `db:"account_id"`
+	SenderID       int            `db:"sender_id"`
+	GoVersion      sql.NullString `db:"go_version"`
+	SingleReview   bool           `db:"single_review"`
+	ForkApproval   bool           `db:"fork_approval"`
+	CreatedAt      time.Time      `db:"created_at"`
+	EnabledAt      mysql.NullTime `db:"enabled_at"`
+	DeniedAt       mysql.NullTime `db:"denied_at"`
+}
+
+// ghInstallationColumns are the columns selected to scan into a
+// ghInstallationRow.
+const ghInstallationColumns = "id, installation_id, account_id, sender_id, go_version, single_review, fork_approval, created_at, enabled_at, denied_at"
+
+func (row ghInstallationRow) ghInstallation() GHInstallation {
+	ghi := GHInstallation{
+		ID:             row.ID,
+		InstallationID: row.InstallationID,
+		AccountID:      row.AccountID,
+		SenderID:       row.SenderID,
+		GoVersion:      row.GoVersion.String,
+		SingleReview:   row.SingleReview,
+		ForkApproval:   row.ForkApproval,
+		CreatedAt:      row.CreatedAt,
+	}
+	if row.EnabledAt.Valid {
+		ghi.enabledAt = row.EnabledAt.Time
+	}
+	if row.DeniedAt.Valid {
+		ghi.deniedAt = row.DeniedAt.Time
+	}
+	return ghi
+}
+
 // GetGHInstallation implements the DB interface.
 func (db *SQLDB) GetGHInstallation(installationID int) (*GHInstallation, error) {
-	var row struct {
-		ID             int            `db:"id"`
-		InstallationID int            `db:"installation_id"`
-		AccountID      int            `db:"account_id"`
-		SenderID       int            `db:"sender_id"`
-		EnabledAt      mysql.NullTime `db:"enabled_at"`
-	}
-	err := db.sqlx.Get(&row, "SELECT id, installation_id, account_id, sender_id, enabled_at FROM gh_installations WHERE installation_id = ?", installationID)
+	var row ghInstallationRow
+	err := db.sqlx.Get(&row, "SELECT "+ghInstallationColumns+" FROM gh_installations WHERE installation_id = ?", installationID)
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, nil
 	case err != nil:
 		return nil, err
 	}
-	ghi := &GHInstallation{
-		ID:             row.ID,
-		InstallationID: row.InstallationID,
-		AccountID:      row.AccountID,
-		SenderID:       row.SenderID,
+	ghi := row.ghInstallation()
+	return &ghi, nil
+}
+
+// ListUnapprovedGHInstallations implements the DB interface.
+func (db *SQLDB) ListUnapprovedGHInstallations() ([]GHInstallation, error) {
+	var rows []ghInstallationRow
+	err := db.sqlx.Select(&rows, "SELECT "+ghInstallationColumns+" FROM gh_installations WHERE enabled_at IS NULL ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
 	}
-	if row.EnabledAt.Valid {
-		ghi.enabledAt = row.EnabledAt.Time
+	var installations []GHInstallation
+	for _, row := range rows {
+		installations = append(installations, row.ghInstallation())
 	}
-	return ghi, nil
+	return installations, nil
+}
+
+// ApproveGHInstallation implements the DB interface.
+func (db *SQLDB) ApproveGHInstallation(installationID int) error {
+	_, err := db.sqlx.Exec("UPDATE gh_installations SET enabled_at = NOW(), denied_at = NULL WHERE installation_id = ?", installationID)
+	return err
 }
 
+// DenyGHInstallation implements the DB interface.
+func (db *SQLDB) DenyGHInstallation(installationID int) error {
+	_, err := db.sqlx.Exec("UPDATE gh_installations SET enabled_at = NULL, denied_at = NOW() WHERE installation_id = ?", installationID)
+	return err
+}
+
+// toolColumns are the columns selected to scan into a Tool.
+const toolColumns = "id, IFNULL(gh_installation_id, 0) gh_installation_id, name, url, path, args, `regexp`, timeout, position, disabled"
+
 // ListTools implements the DB interface.
-func (db *SQLDB) ListTools() ([]Tool, error) {
+func (db *SQLDB) ListTools(ghInstallationID int) ([]Tool, error) {
 	var tools []Tool
-	err := db.sqlx.Select(&tools, "SELECT id, name, path, args, `regexp` FROM tools")
+	err := db.sqlx.Select(&tools, "SELECT "+toolColumns+" FROM tools WHERE deleted_at IS NULL AND NOT disabled AND (gh_installation_id IS NULL OR gh_installation_id = ?) ORDER BY position, id", ghInstallationID)
 	return tools, err
 }
 
+// ListAllTools implements the DB interface.
+func (db *SQLDB) ListAllTools() ([]Tool, error) {
+	var tools []Tool
+	err := db.sqlx.Select(&tools, "SELECT "+toolColumns+" FROM tools WHERE deleted_at IS NULL ORDER BY position, id")
+	return tools, err
+}
+
+// ReorderTools implements the DB interface.
+func (db *SQLDB) ReorderTools(toolIDs []ToolID) error {
+	tx, err := db.sqlx.Beginx()
+	if err != nil {
+		return err
+	}
+	for position, toolID := range toolIDs {
+		if _, err := tx.Exec("UPDATE tools SET position = ? WHERE id = ? AND deleted_at IS NULL", position, toolID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ToolUsage implements the DB interface.
+func (db *SQLDB) ToolUsage() (map[ToolID]ToolUsage, error) {
+	var rows []struct {
+		ToolID ToolID `db:"tool_id"`
+		ToolUsage
+	}
+	err := db.sqlx.Select(&rows, `
+   SELECT at.tool_id, COUNT(DISTINCT at.id) analyses, COUNT(i.id) issues,
+          COUNT(DISTINCT IF(at.status != "Success", at.id, NULL)) failures, MAX(a.created_at) last_used
+     FROM analysis_tool at
+     JOIN analysis a ON (at.analysis_id = a.id)
+LEFT JOIN issues i ON (i.analysis_tool_id = at.id)
+ GROUP BY at.tool_id`)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[ToolID]ToolUsage)
+	for _, row := range rows {
+		usage[row.ToolID] = row.ToolUsage
+	}
+	return usage, nil
+}
+
+// GetTool implements the DB interface.
+func (db *SQLDB) GetTool(toolID ToolID) (*Tool, error) {
+	var tool Tool
+	err := db.sqlx.Get(&tool, "SELECT "+toolColumns+" FROM tools WHERE id = ? AND deleted_at IS NULL", toolID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return &tool, nil
+}
+
+// AddTool implements the DB interface.
+func (db *SQLDB) AddTool(tool *Tool) error {
+	if err := tool.Validate(); err != nil {
+		return err
+	}
+	result, err := db.sqlx.Exec("INSERT INTO tools (gh_installation_id, name, url, path, args, `regexp`, timeout, position, disabled) VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, NULLIF(SEC_TO_TIME(?), 0), ?, ?)",
+		tool.InstallationID, tool.Name, tool.URL, tool.Path, tool.Args, tool.Regexp, tool.Timeout, tool.Position, tool.Disabled,
+	)
+	if err != nil {
+		return err
+	}
+	toolID, err := result.LastInsertId()
+	tool.ID = ToolID(toolID)
+	return err
+}
+
+// UpdateTool implements the DB interface.
+func (db *SQLDB) UpdateTool(tool Tool) error {
+	if err := tool.Validate(); err != nil {
+		return err
+	}
+	_, err := db.sqlx.Exec("UPDATE tools SET gh_installation_id = NULLIF(?, 0), name = ?, url = ?, path = ?, args = ?, `regexp` = ?, timeout = NULLIF(SEC_TO_TIME(?), 0), position = ?, disabled = ? WHERE id = ? AND deleted_at IS NULL",
+		tool.InstallationID, tool.Name, tool.URL, tool.Path, tool.Args, tool.Regexp, tool.Timeout, tool.Position, tool.Disabled, tool.ID,
+	)
+	return err
+}
+
+// RemoveTool implements the DB interface.
+func (db *SQLDB) RemoveTool(toolID ToolID) error {
+	// Tools are kept, as deleting them would delete their analyses' results.
+	_, err := db.sqlx.Exec("UPDATE tools SET deleted_at = NOW() WHERE id = ? AND deleted_at IS NULL", toolID)
+	return err
+}
+
 // StartAnalysis implements the DB interface.
 func (db *SQLDB) StartAnalysis(ghInstallationID, repositoryID int) (*Analysis, error) {
 	analysis := NewAnalysis()
@@ -85,6 +243,7 @@ func (db *SQLDB) StartAnalysis(ghInstallationID, repositoryID int) (*Analysis, e
 	}
 	analysisID, err := result.LastInsertId()
 	analysis.ID = int(analysisID)
+	analysis.RepositoryID = repositoryID
 	return analysis, err
 }
 
@@ -94,15 +253,15 @@ func (db *SQLDB) FinishAnalysis(analysisID int, status AnalysisStatus, analysis
 		_, err := db.sqlx.Exec("UPDATE analysis SET status = ? WHERE id = ?", string(status), analysisID)
 		return err
 	}
-	_, err := db.sqlx.Exec("UPDATE analysis SET status = ?, clone_duration = SEC_TO_TIME(?), deps_duration = SEC_TO_TIME(?), total_duration = SEC_TO_TIME(?) WHERE id = ?",
-		string(status), analysis.CloneDuration, analysis.DepsDuration, analysis.TotalDuration, analysisID,
+	_, err := db.sqlx.Exec("UPDATE analysis SET status = ?, clone_duration = SEC_TO_TIME(?), deps_duration = SEC_TO_TIME(?), total_duration = SEC_TO_TIME(?), ref = NULLIF(?, ''), previous_analysis_id = NULLIF(?, 0) WHERE id = ?",
+		string(status), analysis.CloneDuration, analysis.DepsDuration, analysis.TotalDuration, analysis.Ref, analysis.PreviousID, analysisID,
 	)
 	if err != nil {
 		return err
 	}
 
 	if analysis.IsPush() {
-		_, err = db.sqlx.Exec("UPDATE analysis SET commit_from = ?, commit_to = ? WHERE id = ?", analysis.CommitFrom, analysis.CommitTo, analysisID)
+		_, err = db.sqlx.Exec("UPDATE analysis SET commit_from = ?, commit_to = ?, full_scan = ? WHERE id = ?", analysis.CommitFrom, analysis.CommitTo, analysis.FullScan, analysisID)
 	} else {
 		_, err = db.sqlx.Exec("UPDATE analysis SET request_number = ? WHERE id = ?", analysis.RequestNumber, analysisID)
 	}
@@ -111,7 +270,9 @@ func (db *SQLDB) FinishAnalysis(analysisID int, status AnalysisStatus, analysis
 	}
 
 	for toolID, tool := range analysis.Tools {
-		toolResult, err := db.sqlx.Exec("INSERT INTO analysis_tool (analysis_id, tool_id, duration) VALUES (?, ?, SEC_TO_TIME(?))", analysisID, toolID, tool.Duration)
+		toolResult, err := db.sqlx.Exec("INSERT INTO analysis_tool (analysis_id, tool_id, status, duration) VALUES (?, ?, ?, SEC_TO_TIME(?))",
+			analysisID, toolID, string(tool.Status), tool.Duration,
+		)
 		if err != nil {
 			return err
 		}
@@ -122,8 +283,8 @@ func (db *SQLDB) FinishAnalysis(analysisID int, status AnalysisStatus, analysis
 		}
 
 		for _, issue := range tool.Issues {
-			_, err := db.sqlx.Exec("INSERT INTO issues (analysis_tool_id, path, line, hunk_pos, issue) VALUES(?, ?, ?, ?, ?)",
-				toolAnalysisID, issue.Path, issue.Line, issue.HunkPos, issue.Issue,
+			_, err := db.sqlx.Exec("INSERT INTO issues (analysis_tool_id, path, line, hunk_pos, issue, fingerprint, state) VALUES(?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))",
+				toolAnalysisID, issue.Path, issue.Line, issue.HunkPos, issue.Issue, issue.Fingerprint, string(issue.State),
 			)
 			if err != nil {
 				return err
@@ -140,7 +301,8 @@ func (db *SQLDB) GetAnalysis(analysisID int) (*Analysis, error) {
 
 	err := db.sqlx.Get(analysis, `
    SELECT a.id, a.repository_id, IFNULL(a.commit_from, "") commit_from, IFNULL(a.commit_to, "") commit_to,
-          IFNULL(a.request_number, 0) request_number, a.status, a.clone_duration, a.deps_duration,
+          IFNULL(a.ref, "") ref, IFNULL(a.request_number, 0) request_number, a.full_scan,
+          IFNULL(a.previous_analysis_id, 0) previous_analysis_id, a.status, a.clone_duration, a.deps_duration,
           a.total_duration, a.created_at, IFNULL(ghi.installation_id, 0) installation_id
      FROM analysis a
 LEFT JOIN gh_installations ghi ON (a.gh_installation_id = ghi.id)
@@ -153,20 +315,23 @@ LEFT JOIN gh_installations ghi ON (a.gh_installation_id = ghi.id)
 	}
 
 	var toolIssues []struct {
-		ToolID   int            `db:"tool_id"`
-		Name     string         `db:"name"`
-		URL      string         `db:"url"`
-		Duration Duration       `db:"duration"`
-		LineID   sql.NullInt64  `db:"issue_id"`
-		Path     sql.NullString `db:"path"`
-		Line     sql.NullInt64  `db:"line"`
-		HunkPos  sql.NullInt64  `db:"hunk_pos"`
-		Issue    sql.NullString `db:"issue"`
+		ToolID      int                `db:"tool_id"`
+		Name        string             `db:"name"`
+		URL         string             `db:"url"`
+		Status      AnalysisToolStatus `db:"status"`
+		Duration    Duration           `db:"duration"`
+		LineID      sql.NullInt64      `db:"issue_id"`
+		Path        sql.NullString     `db:"path"`
+		Line        sql.NullInt64      `db:"line"`
+		HunkPos     sql.NullInt64      `db:"hunk_pos"`
+		Issue       sql.NullString     `db:"issue"`
+		Fingerprint sql.NullString     `db:"fingerprint"`
+		State       sql.NullString     `db:"state"`
 	}
 
 	// get all the tools and issues if they have them
 	err = db.sqlx.Select(&toolIssues, `
-   SELECT at.tool_id, at.duration, i.id issue_id, i.path, i.line, i.hunk_pos, i.issue,
+   SELECT at.tool_id, at.status, at.duration, i.id issue_id, i.path, i.line, i.hunk_pos, i.issue, i.fingerprint, i.state,
 		  t.name, t.url
      FROM analysis_tool at
 	 JOIN tools t ON (at.tool_id = t.id)
@@ -184,6 +349,7 @@ LEFT JOIN issues i ON (i.analysis_tool_id = at.id)
 			analysis.Tools[toolID] = AnalysisTool{
 				Tool:     &Tool{ID: toolID, Name: issue.Name, URL: issue.URL},
 				ToolID:   toolID,
+				Status:   issue.Status,
 				Duration: issue.Duration,
 			}
 		}
@@ -191,11 +357,13 @@ LEFT JOIN issues i ON (i.analysis_tool_id = at.id)
 		if issue.Issue.Valid {
 			at := analysis.Tools[toolID]
 			at.Issues = append(at.Issues, Issue{
-				ID:      int(issue.LineID.Int64),
-				Path:    issue.Path.String,
-				Line:    int(issue.Line.Int64),
-				HunkPos: int(issue.HunkPos.Int64),
-				Issue:   issue.Issue.String,
+				ID:          int(issue.LineID.Int64),
+				Path:        issue.Path.String,
+				Line:        int(issue.Line.Int64),
+				HunkPos:     int(issue.HunkPos.Int64),
+				Issue:       issue.Issue.String,
+				Fingerprint: issue.Fingerprint.String,
+				State:       IssueState(issue.State.String),
 			})
 			analysis.Tools[toolID] = at
 		}
@@ -203,3 +371,567 @@ LEFT JOIN issues i ON (i.analysis_tool_id = at.id)
 
 	return analysis, nil
 }
+
+// GetPreviousAnalysis implements the DB interface.
+func (db *SQLDB) GetPreviousAnalysis(analysis *Analysis) (*Analysis, error) {
+	var analysisID int
+	err := db.sqlx.Get(&analysisID, `
+SELECT id
+  FROM analysis
+ WHERE repository_id = ? AND ref = ? AND full_scan = ? AND IFNULL(request_number, 0) = ? AND status = ? AND id < ?
+ ORDER BY id DESC
+ LIMIT 1`,
+		analysis.RepositoryID, analysis.Ref, analysis.FullScan, analysis.RequestNumber, string(AnalysisStatusSuccess), analysis.ID,
+	)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return db.GetAnalysis(analysisID)
+}
+
+// GetLatestFullScan implements the DB interface.
+func (db *SQLDB) GetLatestFullScan(repositoryID int) (*Analysis, error) {
+	var analysisID int
+	err := db.sqlx.Get(&analysisID, "SELECT id FROM analysis WHERE repository_id = ? AND full_scan AND status = ? ORDER BY id DESC LIMIT 1",
+		repositoryID, string(AnalysisStatusSuccess),
+	)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return db.GetAnalysis(analysisID)
+}
+
+// scheduleRow is a row from the schedules table.
+type scheduleRow struct {
+	ID               int       `db:"id"`
+	InstallationID   int       `db:"gh_installation_id"`
+	GHInstallationID int       `db:"installation_id"`
+	Owner            string    `db:"owner"`
+	Repo             string    `db:"repo"`
+	IntervalSeconds  int64     `db:"interval_seconds"`
+	NextRunAt        time.Time `db:"next_run_at"`
+}
+
+// selectSchedules selects schedules using the where clause and args.
+func (db *SQLDB) selectSchedules(where string, args ...interface{}) ([]Schedule, error) {
+	var rows []scheduleRow
+	err := db.sqlx.Select(&rows, `
+SELECT s.id, s.gh_installation_id, ghi.installation_id, s.owner, s.repo, s.interval_seconds, s.next_run_at
+  FROM schedules s
+  JOIN gh_installations ghi ON (s.gh_installation_id = ghi.id)
+ WHERE `+where+`
+ ORDER BY s.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []Schedule
+	for _, row := range rows {
+		schedules = append(schedules, Schedule{
+			ID:               row.ID,
+			InstallationID:   row.InstallationID,
+			GHInstallationID: row.GHInstallationID,
+			Owner:            row.Owner,
+			Repo:             row.Repo,
+			Interval:         time.Duration(row.IntervalSeconds) * time.Second,
+			NextRunAt:        row.NextRunAt,
+		})
+	}
+	return schedules, nil
+}
+
+// ListSchedules implements the DB interface.
+func (db *SQLDB) ListSchedules(ghInstallationID int) ([]Schedule, error) {
+	return db.selectSchedules("s.gh_installation_id = ?", ghInstallationID)
+}
+
+// SetSchedule implements the DB interface.
+func (db *SQLDB) SetSchedule(schedule *Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	seconds := int64(schedule.Interval / time.Second)
+	// An existing schedule's next run is brought forward if the new interval
+	// is shorter, but never delayed.
+	_, err := db.sqlx.Exec(`
+INSERT INTO schedules (gh_installation_id, owner, repo, interval_seconds) VALUES (?, ?, ?, ?)
+    ON DUPLICATE KEY UPDATE
+       next_run_at = LEAST(next_run_at, NOW() + INTERVAL ? SECOND), interval_seconds = VALUES(interval_seconds)`,
+		schedule.InstallationID, schedule.Owner, schedule.Repo, seconds, seconds,
+	)
+	if err != nil {
+		return err
+	}
+	return db.sqlx.QueryRowx("SELECT id, next_run_at FROM schedules WHERE gh_installation_id = ? AND owner = ? AND repo = ?",
+		schedule.InstallationID, schedule.Owner, schedule.Repo,
+	).Scan(&schedule.ID, &schedule.NextRunAt)
+}
+
+// RemoveSchedule implements the DB interface.
+func (db *SQLDB) RemoveSchedule(ghInstallationID, scheduleID int) error {
+	_, err := db.sqlx.Exec("DELETE FROM schedules WHERE gh_installation_id = ? AND id = ?", ghInstallationID, scheduleID)
+	return err
+}
+
+// DueSchedules implements the DB interface.
+func (db *SQLDB) DueSchedules(now time.Time) ([]Schedule, error) {
+	return db.selectSchedules("s.next_run_at <= ? AND ghi.enabled_at <= ?", now.UTC(), now.UTC())
+}
+
+// ClaimSchedule implements the DB interface.
+func (db *SQLDB) ClaimSchedule(schedule Schedule, next time.Time) (bool, error) {
+	result, err := db.sqlx.Exec("UPDATE schedules SET next_run_at = ? WHERE id = ? AND next_run_at = ?",
+		next.UTC(), schedule.ID, schedule.NextRunAt.UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := result.RowsAffected()
+	return claimed == 1, err
+}
+
+// AddSuppression implements the DB interface.
+func (db *SQLDB) AddSuppression(suppression *Suppression) error {
+	if err := suppression.Validate(); err != nil {
+		return err
+	}
+	existing, err := db.selectSuppressions("repository_id = ? AND fingerprint = ? AND revoked_at IS NULL",
+		suppression.RepositoryID, suppression.Fingerprint,
+	)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		*suppression = existing[0]
+		return nil
+	}
+
+	result, err := db.sqlx.Exec("INSERT INTO suppressions (gh_installation_id, repository_id, fingerprint, issue, reason, created_by) VALUES (?, ?, ?, ?, ?, ?)",
+		suppression.InstallationID, suppression.RepositoryID, suppression.Fingerprint, suppression.Issue, suppression.Reason, suppression.CreatedBy,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	suppression.ID = int(id)
+	return db.sqlx.Get(&suppression.CreatedAt, "SELECT created_at FROM suppressions WHERE id = ?", suppression.ID)
+}
+
+// suppressionRow is a row from the suppressions table.
+type suppressionRow struct {
+	ID             int           `db:"id"`
+	InstallationID int           `db:"gh_installation_id"`
+	RepositoryID   int           `db:"repository_id"`
+	Fingerprint    string        `db:"fingerprint"`
+	Issue          string        `db:"issue"`
+	Reason         string        `db:"reason"`
+	CreatedBy      int           `db:"created_by"`
+	CreatedAt      time.Time     `db:"created_at"`
+	RevokedBy      sql.NullInt64 `db:"revoked_by"`
+	RevokedAt      *time.Time    `db:"revoked_at"`
+}
+
+// selectSuppressions selects suppressions using the where clause and args.
+func (db *SQLDB) selectSuppressions(where string, args ...interface{}) ([]Suppression, error) {
+	var rows []suppressionRow
+	err := db.sqlx.Select(&rows, `
+SELECT id, gh_installation_id, repository_id, fingerprint, issue, reason, created_by, created_at, revoked_by, revoked_at
+  FROM suppressions
+ WHERE `+where+`
+ ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var suppressions []Suppression
+	for _, row := range rows {
+		suppressions = append(suppressions, Suppression{
+			ID:             row.ID,
+			InstallationID: row.InstallationID,
+			RepositoryID:   row.RepositoryID,
+			Fingerprint:    row.Fingerprint,
+			Issue:          row.Issue,
+			Reason:         row.Reason,
+			CreatedBy:      row.CreatedBy,
+			CreatedAt:      row.CreatedAt,
+			RevokedBy:      int(row.RevokedBy.Int64),
+			RevokedAt:      row.RevokedAt,
+		})
+	}
+	return suppressions, nil
+}
+
+// ListSuppressions implements the DB interface.
+func (db *SQLDB) ListSuppressions(ghInstallationID, repositoryID int) ([]Suppression, error) {
+	if repositoryID == 0 {
+		return db.selectSuppressions("gh_installation_id = ?", ghInstallationID)
+	}
+	return db.selectSuppressions("gh_installation_id = ? AND repository_id = ?", ghInstallationID, repositoryID)
+}
+
+// RevokeSuppression implements the DB interface.
+func (db *SQLDB) RevokeSuppression(ghInstallationID, suppressionID, revokedBy int) error {
+	result, err := db.sqlx.Exec("UPDATE suppressions SET revoked_by = ?, revoked_at = NOW() WHERE gh_installation_id = ? AND id = ? AND revoked_at IS NULL",
+		revokedBy, ghInstallationID, suppressionID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SuppressedFingerprints implements the DB interface.
+func (db *SQLDB) SuppressedFingerprints(repositoryID int) (map[string]bool, error) {
+	var fingerprints []string
+	err := db.sqlx.Select(&fingerprints, "SELECT fingerprint FROM suppressions WHERE repository_id = ? AND revoked_at IS NULL", repositoryID)
+	if err != nil {
+		return nil, err
+	}
+	suppressed := make(map[string]bool)
+	for _, fingerprint := range fingerprints {
+		suppressed[fingerprint] = true
+	}
+	return suppressed, nil
+}
+
+// AddIssueComments implements the DB interface.
+func (db *SQLDB) AddIssueComments(comments []IssueComment) error {
+	for i, c := range comments {
+		result, err := db.sqlx.Exec("INSERT INTO issue_comments (gh_installation_id, repository_id, request_number, tool_id, comment_id, fingerprint, issue) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			c.InstallationID, c.RepositoryID, c.RequestNumber, c.ToolID, c.CommentID, c.Fingerprint, c.Issue,
+		)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		comments[i].ID = int(id)
+		if err := db.sqlx.Get(&comments[i].CreatedAt, "SELECT created_at FROM issue_comments WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenIssueComments implements the DB interface.
+func (db *SQLDB) OpenIssueComments(repositoryID, requestNumber int) ([]IssueComment, error) {
+	var rows []struct {
+		ID             int       `db:"id"`
+		InstallationID int       `db:"gh_installation_id"`
+		RepositoryID   int       `db:"repository_id"`
+		RequestNumber  int       `db:"request_number"`
+		ToolID         ToolID    `db:"tool_id"`
+		CommentID      int       `db:"comment_id"`
+		Fingerprint    string    `db:"fingerprint"`
+		Issue          string    `db:"issue"`
+		CreatedAt      time.Time `db:"created_at"`
+	}
+	err := db.sqlx.Select(&rows, `
+SELECT id, gh_installation_id, repository_id, request_number, tool_id, comment_id, fingerprint, issue, created_at
+  FROM issue_comments
+ WHERE repository_id = ? AND request_number = ? AND fixed_at IS NULL
+ ORDER BY id`, repositoryID, requestNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []IssueComment
+	for _, row := range rows {
+		comments = append(comments, IssueComment{
+			ID:             row.ID,
+			InstallationID: row.InstallationID,
+			RepositoryID:   row.RepositoryID,
+			RequestNumber:  row.RequestNumber,
+			ToolID:         row.ToolID,
+			CommentID:      row.CommentID,
+			Fingerprint:    row.Fingerprint,
+			Issue:          row.Issue,
+			CreatedAt:      row.CreatedAt,
+		})
+	}
+	return comments, nil
+}
+
+// FixIssueComment implements the DB interface.
+func (db *SQLDB) FixIssueComment(issueCommentID int, commit string) error {
+	_, err := db.sqlx.Exec("UPDATE issue_comments SET fixed_in = ?, fixed_at = NOW() WHERE id = ? AND fixed_at IS NULL", commit, issueCommentID)
+	return err
+}
+
+// GetSummaryComment implements the DB interface.
+func (db *SQLDB) GetSummaryComment(repositoryID, requestNumber int) (int, error) {
+	var commentID int
+	err := db.sqlx.Get(&commentID, "SELECT comment_id FROM summary_comments WHERE repository_id = ? AND request_number = ?", repositoryID, requestNumber)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return commentID, err
+}
+
+// SetSummaryComment implements the DB interface.
+func (db *SQLDB) SetSummaryComment(ghInstallationID, repositoryID, requestNumber, commentID int) error {
+	_, err := db.sqlx.Exec(`
+INSERT INTO summary_comments (gh_installation_id, repository_id, request_number, comment_id) VALUES (?, ?, ?, ?)
+    ON DUPLICATE KEY UPDATE comment_id = VALUES(comment_id)`,
+		ghInstallationID, repositoryID, requestNumber, commentID,
+	)
+	return err
+}
+
+// ApproveFork implements the DB interface.
+func (db *SQLDB) ApproveFork(ghInstallationID, repositoryID, requestNumber int, sha string) error {
+	_, err := db.sqlx.Exec("INSERT IGNORE INTO fork_approvals (gh_installation_id, repository_id, request_number, sha) VALUES (?, ?, ?, ?)",
+		ghInstallationID, repositoryID, requestNumber, sha,
+	)
+	return err
+}
+
+// ForkApproved implements the DB interface.
+func (db *SQLDB) ForkApproved(repositoryID, requestNumber int, sha string) (bool, error) {
+	var approved bool
+	err := db.sqlx.Get(&approved, "SELECT EXISTS(SELECT 1 FROM fork_approvals WHERE repository_id = ? AND request_number = ? AND sha = ?)", repositoryID, requestNumber, sha)
+	return approved, err
+}
+
+// GetDepsCredentials implements the DB interface.
+func (db *SQLDB) GetDepsCredentials(ghInstallationID int) (*DepsCredentials, error) {
+	var ciphertext []byte
+	err := db.sqlx.Get(&ciphertext, "SELECT deps_credentials FROM gh_installations WHERE id = ?", ghInstallationID)
+	switch {
+	case err == sql.ErrNoRows || (err == nil && ciphertext == nil):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	plaintext, err := db.secrets.open(ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decrypt deps credentials")
+	}
+	creds := &DepsCredentials{}
+	if err := json.Unmarshal(plaintext, creds); err != nil {
+		return nil, errors.Wrap(err, "could not decode deps credentials")
+	}
+	return creds, nil
+}
+
+// SetGHInstallationSettings implements the DB interface.
+func (db *SQLDB) SetGHInstallationSettings(ghInstallationID int, settings InstallationSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	_, err := db.sqlx.Exec("UPDATE gh_installations SET go_version = NULLIF(?, ''), single_review = ?, fork_approval = ? WHERE id = ?",
+		settings.GoVersion, settings.SingleReview, settings.ForkApproval, ghInstallationID,
+	)
+	return err
+}
+
+// SetDepsCredentials implements the DB interface.
+func (db *SQLDB) SetDepsCredentials(ghInstallationID int, creds *DepsCredentials) error {
+	var ciphertext []byte
+	if creds != nil {
+		plaintext, err := json.Marshal(creds)
+		if err != nil {
+			return err
+		}
+		if ciphertext, err = db.secrets.seal(plaintext); err != nil {
+			return errors.Wrap(err, "could not encrypt deps credentials")
+		}
+	}
+	_, err := db.sqlx.Exec("UPDATE gh_installations SET deps_credentials = ? WHERE id = ?", ciphertext, ghInstallationID)
+	return err
+}
+
+// SetRepository implements the DB interface.
+func (db *SQLDB) SetRepository(repo Repository) error {
+	tx, err := db.sqlx.Beginx()
+	if err != nil {
+		return err
+	}
+
+	var existing Repository
+	err = tx.Get(&existing, "SELECT IFNULL(gh_installation_id, 0) gh_installation_id, owner, name FROM repositories WHERE id = ? FOR UPDATE", repo.ID)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		tx.Rollback()
+		return err
+	case existing.FullName() != repo.FullName():
+		_, err = tx.Exec("UPDATE schedules SET owner = ?, repo = ? WHERE gh_installation_id = ? AND owner = ? AND repo = ?",
+			repo.Owner, repo.Name, existing.InstallationID, existing.Owner, existing.Name,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO repositories (id, gh_installation_id, owner, name, private) VALUES (?, NULLIF(?, 0), ?, ?, ?)
+    ON DUPLICATE KEY UPDATE gh_installation_id = VALUES(gh_installation_id), owner = VALUES(owner), name = VALUES(name), private = VALUES(private)`,
+		repo.ID, repo.InstallationID, repo.Owner, repo.Name, repo.Private,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRepository implements the DB interface.
+func (db *SQLDB) GetRepository(repositoryID int) (*Repository, error) {
+	repo := &Repository{}
+	err := db.sqlx.Get(repo, "SELECT id, IFNULL(gh_installation_id, 0) gh_installation_id, owner, name, private FROM repositories WHERE id = ?", repositoryID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return repo, err
+}
+
+// ListRepositories implements the DB interface.
+func (db *SQLDB) ListRepositories(ghInstallationID int) ([]Repository, error) {
+	var repos []Repository
+	err := db.sqlx.Select(&repos, "SELECT id, gh_installation_id, owner, name, private FROM repositories WHERE gh_installation_id = ? ORDER BY owner, name", ghInstallationID)
+	return repos, err
+}
+
+// RemoveRepository implements the DB interface.
+func (db *SQLDB) RemoveRepository(ghInstallationID, repositoryID int) error {
+	_, err := db.sqlx.Exec("UPDATE repositories SET gh_installation_id = NULL WHERE id = ? AND gh_installation_id = ?", repositoryID, ghInstallationID)
+	return err
+}
+
+// PurgeRepository implements the DB interface.
+func (db *SQLDB) PurgeRepository(repositoryID int) error {
+	tx, err := db.sqlx.Beginx()
+	if err != nil {
+		return err
+	}
+	stmts := []string{
+		// Schedules refer to repositories by name, not ID.
+		`DELETE s FROM schedules s JOIN repositories r ON (s.owner = r.owner AND s.repo = r.name AND s.gh_installation_id = r.gh_installation_id) WHERE r.id = ?`,
+		"DELETE FROM analysis WHERE repository_id = ?",
+		"DELETE FROM issue_comments WHERE repository_id = ?",
+		"DELETE FROM summary_comments WHERE repository_id = ?",
+		"DELETE FROM fork_approvals WHERE repository_id = ?",
+		"DELETE FROM suppressions WHERE repository_id = ?",
+		"DELETE FROM webhook_deliveries WHERE repository_id = ?",
+		"DELETE FROM repositories WHERE id = ?",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, repositoryID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// mysqlErrDupEntry is the MySQL error number of a duplicate key.
+const mysqlErrDupEntry = 1062
+
+// ReserveWebhookDelivery implements the DB interface.
+func (db *SQLDB) ReserveWebhookDelivery(delivery *WebhookDelivery, timeout time.Duration) (bool, error) {
+	// Attempts are incremented when the delivery's result is recorded.
+	result, err := db.sqlx.Exec("INSERT INTO webhook_deliveries (guid, event, repository_id, payload, result, error, duration, attempts) VALUES (?, ?, NULLIF(?, 0), ?, ?, '', '00:00:00', 0)",
+		delivery.GUID, delivery.Event, delivery.RepositoryID, delivery.Payload, string(DeliveryResultPending),
+	)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlErrDupEntry {
+		// Only failed deliveries, and pending deliveries which were abandoned,
+		// are reserved again, the unique guid prevents concurrent deliveries
+		// both reserving it. updated_at is set explicitly, as it's not updated
+		// when a pending delivery's result is unchanged.
+		result, err = db.sqlx.Exec(`
+UPDATE webhook_deliveries SET id = LAST_INSERT_ID(id), result = ?, updated_at = CURRENT_TIMESTAMP
+ WHERE guid = ? AND (result = ? OR (result = ? AND updated_at < NOW() - INTERVAL ? SECOND))`,
+			string(DeliveryResultPending), delivery.GUID, string(DeliveryResultError), string(DeliveryResultPending), int(timeout/time.Second),
+		)
+		if err != nil {
+			return false, err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return false, err
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	id, err := result.LastInsertId()
+	delivery.ID, delivery.Result = int(id), DeliveryResultPending
+	return err == nil, err
+}
+
+// RecordWebhookDelivery implements the DB interface.
+func (db *SQLDB) RecordWebhookDelivery(delivery *WebhookDelivery) error {
+	// LAST_INSERT_ID(id) sets the ID of an existing delivery as the last
+	// insert ID, so its ID is returned when it's updated.
+	result, err := db.sqlx.Exec(`
+INSERT INTO webhook_deliveries (guid, event, repository_id, payload, result, error, duration) VALUES (NULLIF(?, ""), ?, NULLIF(?, 0), ?, ?, ?, ?)
+    ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), event = VALUES(event), repository_id = VALUES(repository_id), payload = VALUES(payload),
+        result = VALUES(result), error = VALUES(error), duration = VALUES(duration), attempts = attempts + 1`,
+		delivery.GUID, delivery.Event, delivery.RepositoryID, delivery.Payload, string(delivery.Result), delivery.Error, delivery.Duration,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	delivery.ID = int(id)
+	return err
+}
+
+// webhookDeliveryColumns are the columns selected to scan into a
+// WebhookDelivery, excluding the payload.
+const webhookDeliveryColumns = "id, IFNULL(guid, '') guid, event, IFNULL(repository_id, 0) repository_id, result, error, duration, attempts, created_at, updated_at"
+
+// GetWebhookDelivery implements the DB interface.
+func (db *SQLDB) GetWebhookDelivery(guid string) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	err := db.sqlx.Get(delivery, "SELECT "+webhookDeliveryColumns+", payload FROM webhook_deliveries WHERE guid = ?", guid)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return delivery, err
+}
+
+// ListWebhookDeliveries implements the DB interface.
+func (db *SQLDB) ListWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := db.sqlx.Select(&deliveries, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries ORDER BY updated_at DESC, id DESC LIMIT ?", limit)
+	return deliveries, err
+}
+
+// PruneWebhookDeliveries implements the DB interface.
+func (db *SQLDB) PruneWebhookDeliveries(before time.Time) (int, error) {
+	result, err := db.sqlx.Exec("DELETE FROM webhook_deliveries WHERE created_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
+
+// ExpireAnalyses implements the DB interface.
+func (db *SQLDB) ExpireAnalyses(before time.Time) (int, error) {
+	result, err := db.sqlx.Exec("UPDATE analysis SET status = ? WHERE status = ? AND created_at < ?",
+		string(AnalysisStatusError), string(AnalysisStatusPending), before.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	expired, err := result.RowsAffected()
+	return int(expired), err
+}
@@ -0,0 +1,55 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// awaitingApprovalDesc is the status description of commits in repositories
+// of installations awaiting approval.
+const awaitingApprovalDesc = "Installation is awaiting approval by GopherCI's operators"
+
+// SetAutoApprove sets the logins of the accounts whose installations are
+// approved when they're created, instead of awaiting approval by an operator.
+func (g *GitHub) SetAutoApprove(logins []string) {
+	g.autoApprove = make(map[string]bool)
+	for _, login := range logins {
+		if login = strings.TrimSpace(login); login != "" {
+			g.autoApprove[strings.ToLower(login)] = true
+		}
+	}
+}
+
+// isAutoApproved returns true if installations on the account with login
+// are approved when they're created.
+func (g *GitHub) isAutoApproved(login string) bool {
+	return g.autoApprove[strings.ToLower(login)]
+}
+
+// awaitingApproval handles an analysis for an installation which isn't
+// enabled. If the installation is awaiting approval, the commit's status
+// explains so, denied installations are ignored.
+func (g *GitHub) awaitingApproval(ctx context.Context, cfg AnalyseConfig) error {
+	installation, err := g.db.GetGHInstallation(cfg.installationID)
+	if err != nil {
+		return errors.Wrap(err, "error getting installation")
+	}
+	if installation == nil {
+		return fmt.Errorf("could not find installation with ID %v", cfg.installationID)
+	}
+	if installation.IsDenied() {
+		log.Printf("ignoring analysis for denied installation ID %v", cfg.installationID)
+		return nil
+	}
+
+	install, err := g.newInstallation(installation)
+	if err != nil {
+		return errors.Wrap(err, "error getting installation")
+	}
+	log.Printf("installation ID %v awaiting approval", cfg.installationID)
+	return install.SetStatus(ctx, cfg.statusesContext, cfg.statusesURL, StatusStatePending, awaitingApprovalDesc, "")
+}
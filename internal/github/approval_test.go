@@ -0,0 +1,44 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestIntegrationInstallationEvent_autoApprove(t *testing.T) {
+	g, _, memDB := setup(t)
+	g.SetAutoApprove([]string{"Trusted", " other "})
+
+	tests := []struct {
+		installationID int
+		login          string
+		want           bool
+	}{
+		{2, "trusted", true},
+		{3, "other", true},
+		{4, "untrusted", false},
+	}
+	for _, test := range tests {
+		event := &github.IntegrationInstallationEvent{
+			Action: github.String("created"),
+			Installation: &github.Installation{
+				ID:      github.Int(test.installationID),
+				Account: &github.User{ID: github.Int(10), Login: github.String(test.login)},
+			},
+			Sender: &github.User{ID: github.Int(11)},
+		}
+		if err := g.integrationInstallationEvent(event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		install, _ := memDB.GetGHInstallation(test.installationID)
+		if have := install.IsEnabled(); have != test.want {
+			t.Errorf("login %q enabled have: %v want: %v", test.login, have, test.want)
+		}
+	}
+
+	pending, _ := memDB.ListUnapprovedGHInstallations()
+	if len(pending) != 1 || pending[0].InstallationID != 4 {
+		t.Errorf("unexpected unapproved installations: %+v", pending)
+	}
+}
@@ -0,0 +1,88 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// recordIssueComments records the comments written for the analysis' issues
+// on a pull request, so they can be updated once the issues are fixed.
+// Errors are logged, as the comments have already been written.
+func (g *GitHub) recordIssueComments(install *Installation, cfg AnalyseConfig, analysis *db.Analysis, written []db.IssueComment) {
+	if len(written) == 0 {
+		return
+	}
+	toolIDs := make(map[string]db.ToolID) // fingerprint -> tool ID
+	for toolID, tool := range analysis.Tools {
+		for _, issue := range tool.Issues {
+			toolIDs[issue.Fingerprint] = toolID
+		}
+	}
+	for i := range written {
+		written[i].InstallationID = install.ID
+		written[i].RepositoryID = cfg.repositoryID
+		written[i].RequestNumber = cfg.pr
+		written[i].ToolID = toolIDs[written[i].Fingerprint]
+	}
+	if err := g.db.AddIssueComments(written); err != nil {
+		log.Printf("could not record %v issue comments for analysisID %v: %v", len(written), analysis.ID, err)
+	}
+}
+
+// fixIssueComments updates the comments previously written on a pull request
+// for issues which are no longer reported by the analysis, to say they were
+// fixed in the analysed commit. Comments for tools which did not succeed,
+// and for issues which have been suppressed, are not updated as the issues
+// may not have been fixed. Errors are logged, as they should not fail the
+// analysis.
+func (g *GitHub) fixIssueComments(ctx context.Context, install *Installation, cfg AnalyseConfig, analysis *db.Analysis, suppressed map[string]bool) {
+	comments, err := g.db.OpenIssueComments(cfg.repositoryID, cfg.pr)
+	if err != nil {
+		log.Printf("could not get issue comments for %v/%v#%v: %v", cfg.owner, cfg.repo, cfg.pr, err)
+		return
+	}
+
+	reported := make(map[string]bool)
+	for _, issue := range analysis.Issues() {
+		reported[issue.Fingerprint] = true
+	}
+
+	for _, comment := range comments {
+		tool, ok := analysis.Tools[comment.ToolID]
+		if !ok || tool.Status != db.AnalysisToolStatusSuccess || reported[comment.Fingerprint] || suppressed[comment.Fingerprint] {
+			continue
+		}
+		if err := install.FixComment(ctx, cfg.owner, cfg.repo, comment, cfg.sha); err != nil {
+			log.Printf("could not fix comment %v: %v", comment.CommentID, err)
+			continue
+		}
+		if err := g.db.FixIssueComment(comment.ID, cfg.sha); err != nil {
+			log.Printf("could not mark issue comment %v as fixed: %v", comment.ID, err)
+		}
+	}
+}
+
+// FixComment edits the pull request comment written for an issue to say the
+// issue was fixed in a commit. The comment's fingerprint is removed, so the
+// issue is commented on again if it reappears. Comments which have since
+// been deleted are ignored.
+func (i *Installation) FixComment(ctx context.Context, owner, repo string, comment db.IssueComment, commit string) error {
+	edit := &github.PullRequestComment{Body: github.String(fixedCommentBody(comment.Issue, commit))}
+	_, resp, err := i.client.PullRequests.EditComment(ctx, owner, repo, comment.CommentID, edit)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return errors.Wrap(err, "could not edit comment")
+}
+
+// fixedCommentBody returns the body of a comment for an issue which was fixed
+// in a commit.
+func fixedCommentBody(issue, commit string) string {
+	return fmt.Sprintf("~~%s~~\n\nFixed in %s.", issue, commit)
+}
@@ -0,0 +1,91 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+)
+
+func TestFixIssueComments(t *testing.T) {
+	g, _, memDB := setup(t)
+
+	edited := make(map[int]string) // comment ID -> body
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id int
+		if _, err := fmt.Sscanf(r.URL.Path, "/repos/owner/repo/pulls/comments/%d", &id); err != nil || r.Method != "PATCH" {
+			t.Errorf("unexpected request: %v %v", r.Method, r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		var comment github.PullRequestComment
+		json.NewDecoder(r.Body).Decode(&comment)
+		edited[id] = comment.GetBody()
+		json.NewEncoder(w).Encode(&comment)
+	}))
+	defer ts.Close()
+
+	install := &Installation{client: github.NewClient(nil)}
+	install.client.BaseURL, _ = url.Parse(ts.URL + "/")
+
+	memDB.AddIssueComments([]db.IssueComment{
+		{RepositoryID: 100, RequestNumber: 3, ToolID: 1, CommentID: 10, Fingerprint: "fixed", Issue: "tool1: fixed"},
+		{RepositoryID: 100, RequestNumber: 3, ToolID: 1, CommentID: 11, Fingerprint: "reported", Issue: "tool1: reported"},
+		{RepositoryID: 100, RequestNumber: 3, ToolID: 2, CommentID: 12, Fingerprint: "failed", Issue: "tool2: failed"},
+		{RepositoryID: 100, RequestNumber: 3, ToolID: 1, CommentID: 13, Fingerprint: "suppressed", Issue: "tool1: suppressed"},
+		{RepositoryID: 100, RequestNumber: 4, ToolID: 1, CommentID: 14, Fingerprint: "other", Issue: "tool1: other pr"},
+	})
+
+	analysis := &db.Analysis{Tools: map[db.ToolID]db.AnalysisTool{
+		1: {Status: db.AnalysisToolStatusSuccess, Issues: []db.Issue{{Fingerprint: "reported", Issue: "tool1: reported"}}},
+		2: {Status: db.AnalysisToolStatusFailure},
+	}}
+	cfg := AnalyseConfig{owner: "owner", repo: "repo", repositoryID: 100, pr: 3, sha: "abc123"}
+
+	// Suppressed issues are only not reported, they're not fixed, so only
+	// the first comment is fixed.
+	g.fixIssueComments(context.Background(), install, cfg, analysis, map[string]bool{"suppressed": true})
+
+	want := map[int]string{10: "~~tool1: fixed~~\n\nFixed in abc123."}
+	if !reflect.DeepEqual(edited, want) {
+		t.Errorf("edited\nhave: %v\nwant: %v", edited, want)
+	}
+
+	open, _ := memDB.OpenIssueComments(100, 3)
+	if len(open) != 3 {
+		t.Errorf("have %v open comments want: 3", len(open))
+	}
+	if fixed := memDB.IssueComments[0]; fixed.FixedIn != "abc123" || fixed.FixedAt == nil {
+		t.Errorf("comment was not marked as fixed: %+v", fixed)
+	}
+}
+
+func TestRecordIssueComments(t *testing.T) {
+	g, _, memDB := setup(t)
+
+	analysis := &db.Analysis{Tools: map[db.ToolID]db.AnalysisTool{
+		1: {Issues: []db.Issue{{Fingerprint: "abc", Issue: "tool1: issue"}}},
+		2: {Issues: []db.Issue{{Fingerprint: "def", Issue: "tool2: issue"}}},
+	}}
+	cfg := AnalyseConfig{repositoryID: 100, pr: 3}
+
+	g.recordIssueComments(&Installation{ID: 1}, cfg, analysis, []db.IssueComment{
+		{CommentID: 10, Fingerprint: "def", Issue: "tool2: issue"},
+	})
+
+	if len(memDB.IssueComments) != 1 {
+		t.Fatalf("have %v issue comments want: 1", len(memDB.IssueComments))
+	}
+	have := memDB.IssueComments[0]
+	want := db.IssueComment{ID: 1, InstallationID: 1, RepositoryID: 100, RequestNumber: 3, ToolID: 2, CommentID: 10, Fingerprint: "def", Issue: "tool2: issue", CreatedAt: have.CreatedAt}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
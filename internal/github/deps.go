@@ -0,0 +1,106 @@
+package github
+
+import (
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/pkg/errors"
+)
+
+// depsConfig returns the configuration to install the private dependencies
+// of the repository at goSrcPath, such as github.com/owner/repo, using the
+// installation's credentials, if any.
+func (g *GitHub) depsConfig(install *Installation, goSrcPath string) (analyser.Deps, error) {
+	creds, err := g.db.GetDepsCredentials(install.ID)
+	if err != nil {
+		return analyser.Deps{}, errors.Wrap(err, "could not get deps credentials")
+	}
+	if creds == nil {
+		return analyser.Deps{}, nil
+	}
+
+	var token string
+	if creds.OrgToken {
+		if token, err = install.Token(); err != nil {
+			return analyser.Deps{}, err
+		}
+	}
+	return newDeps(*creds, goSrcPath, token), nil
+}
+
+// newDeps returns the configuration to install the private dependencies of
+// the repository at goSrcPath using creds. If token is not empty, it's used
+// to fetch the private repositories of the repository's owner.
+func newDeps(creds db.DepsCredentials, goSrcPath, token string) analyser.Deps {
+	deps := analyser.Deps{
+		GOPRIVATE: creds.GOPRIVATE,
+		GOPROXY:   analyser.Secret(creds.GOPROXY),
+	}
+	if parts := strings.Split(goSrcPath, "/"); token != "" && len(parts) >= 2 {
+		owner := parts[0] + "/" + parts[1]
+		deps.Credentials = append(deps.Credentials, analyser.GitCredential{
+			URL:      "https://" + owner,
+			Username: "x-access-token",
+			Password: analyser.Secret(token),
+		})
+		// The owner's modules are private, so they're fetched directly
+		// from the repository, not the proxy or checksum database.
+		if deps.GOPRIVATE == "" {
+			deps.GOPRIVATE = owner
+		} else {
+			deps.GOPRIVATE = owner + "," + deps.GOPRIVATE
+		}
+	}
+	deps.Credentials = append(deps.Credentials, parseNetrc(creds.Netrc)...)
+	return deps
+}
+
+// parseNetrc returns the credentials of each machine with a password in the
+// contents of a .netrc file, used for HTTPS URLs of the machine. The default
+// entry is ignored, and parsing stops at the first macro.
+func parseNetrc(netrc string) []analyser.GitCredential {
+	var (
+		creds  []analyser.GitCredential
+		cred   *analyser.GitCredential // cred is the current machine's credential, nil for default
+		fields = strings.Fields(netrc)
+	)
+	value := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			i++
+			creds = append(creds, analyser.GitCredential{URL: "https://" + value(i)})
+			cred = &creds[len(creds)-1]
+		case "default":
+			cred = nil
+		case "login":
+			i++
+			if cred != nil {
+				cred.Username = value(i)
+			}
+		case "password":
+			i++
+			if cred != nil {
+				cred.Password = analyser.Secret(value(i))
+			}
+		case "account":
+			i++
+		case "macdef":
+			i = len(fields)
+		}
+	}
+
+	var withPassword []analyser.GitCredential
+	for _, cred := range creds {
+		if cred.URL != "https://" && cred.Password != "" {
+			withPassword = append(withPassword, cred)
+		}
+	}
+	return withPassword
+}
@@ -0,0 +1,92 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := `machine example.com login user password pass
+machine nopassword.com login user
+default login anonymous password guest
+
+machine example.org
+	login other
+	account ignored
+	password secret
+macdef init
+	machine macro.com login user password pass
+`
+	want := []analyser.GitCredential{
+		{URL: "https://example.com", Username: "user", Password: "pass"},
+		{URL: "https://example.org", Username: "other", Password: "secret"},
+	}
+	if have := parseNetrc(netrc); !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+
+	for _, netrc := range []string{"", "machine", "machine example.com password"} {
+		if have := parseNetrc(netrc); have != nil {
+			t.Errorf("%q: have: %+v want: nil", netrc, have)
+		}
+	}
+}
+
+func TestNewDeps(t *testing.T) {
+	creds := db.DepsCredentials{
+		GOPRIVATE: "example.com/private",
+		GOPROXY:   "https://proxy.example.com",
+		Netrc:     "machine example.com login user password pass",
+	}
+	netrc := analyser.GitCredential{URL: "https://example.com", Username: "user", Password: "pass"}
+
+	tests := []struct {
+		token string
+		want  analyser.Deps
+	}{
+		{"", analyser.Deps{
+			GOPRIVATE:   "example.com/private",
+			GOPROXY:     "https://proxy.example.com",
+			Credentials: []analyser.GitCredential{netrc},
+		}},
+		{"token", analyser.Deps{
+			GOPRIVATE: "github.com/owner,example.com/private",
+			GOPROXY:   "https://proxy.example.com",
+			Credentials: []analyser.GitCredential{
+				{URL: "https://github.com/owner", Username: "x-access-token", Password: "token"},
+				netrc,
+			},
+		}},
+	}
+	for _, test := range tests {
+		if have := newDeps(creds, "github.com/owner/repo", test.token); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("token %q\nhave: %#v\nwant: %#v", test.token, have, test.want)
+		}
+	}
+}
+
+func TestDepsConfig(t *testing.T) {
+	g, _, memDB := setup(t)
+	install := &Installation{ID: 1}
+
+	// Installations without credentials have no deps configuration.
+	deps, err := g.depsConfig(install, "github.com/owner/repo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(deps, analyser.Deps{}) {
+		t.Errorf("have: %#v want: zero deps", deps)
+	}
+
+	memDB.SetDepsCredentials(1, &db.DepsCredentials{GOPRIVATE: "example.com/private"})
+	deps, err = g.depsConfig(install, "github.com/owner/repo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (analyser.Deps{GOPRIVATE: "example.com/private"}); !reflect.DeepEqual(deps, want) {
+		t.Errorf("have: %#v want: %#v", deps, want)
+	}
+}
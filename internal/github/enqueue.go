@@ -0,0 +1,85 @@
+package github
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultEnqueueTimeout is the default maximum duration to wait to add a job
+// to a full queue, before the system is considered overloaded. It must be
+// shorter than GitHub's webhook timeout of 10 seconds.
+const defaultEnqueueTimeout = 2 * time.Second
+
+// errQueueFull is returned when a job could not be added to the queue before
+// the enqueue timeout.
+var errQueueFull = errors.New("queue is full")
+
+var (
+	// webhookMetrics are the counts of jobs added to, and rejected by, the
+	// queue from webhooks, and the latency of adding them, published by
+	// expvar.
+	webhookMetrics = expvar.NewMap("github_webhooks")
+	// enqueueLatency is the duration taken to add jobs to the queue.
+	enqueueLatency = &latency{}
+)
+
+func init() {
+	webhookMetrics.Set("enqueue_latency", enqueueLatency)
+}
+
+// enqueue adds job to the queue, waiting for at most the enqueue timeout if
+// the queue is full, in which case errQueueFull is returned.
+func (g *GitHub) enqueue(job interface{}) error {
+	start := time.Now()
+	timer := time.NewTimer(g.enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case g.queuePush <- job:
+		enqueueLatency.observe(time.Since(start))
+		webhookMetrics.Add("enqueued", 1)
+		return nil
+	case <-timer.C:
+		webhookMetrics.Add("rejected", 1)
+		return errQueueFull
+	}
+}
+
+// latency is an expvar.Var of the number, mean and maximum of durations.
+type latency struct {
+	mu    sync.Mutex // protects below
+	count int64
+	total time.Duration
+	max   time.Duration
+}
+
+// observe records a duration.
+func (l *latency) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	l.total += d
+	if d > l.max {
+		l.max = d
+	}
+}
+
+// String implements the expvar.Var interface, durations are in seconds.
+func (l *latency) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v := struct {
+		Count int64   `json:"count"`
+		Mean  float64 `json:"mean"`
+		Max   float64 `json:"max"`
+	}{Count: l.count, Max: l.max.Seconds()}
+	if l.count > 0 {
+		v.Mean = (l.total / time.Duration(l.count)).Seconds()
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
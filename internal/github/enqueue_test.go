@@ -0,0 +1,76 @@
+package github
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+func TestWebhookHandler_queueFull(t *testing.T) {
+	memDB := db.NewMockDB()
+	queue := make(chan interface{}, 1)
+	g, err := New(&mockAnalyser{}, memDB, queue, 1, integrationKey, webhookSecret, "https://example.com")
+	if err != nil {
+		t.Fatal("could not initialise GitHub:", err)
+	}
+	g.enqueueTimeout = time.Millisecond
+
+	rejected := func() int64 {
+		if v, ok := webhookMetrics.Get("rejected").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := rejected()
+
+	deliver := func(guid string) *httptest.ResponseRecorder {
+		payload := `{"after":"abcdef","installation":{"id":2},"repository":{"id":1}}`
+		r := httptest.NewRequest("POST", "https://example.com", strings.NewReader(payload))
+		r.Header.Add("X-GitHub-Delivery", guid)
+		r.Header.Add("X-GitHub-Event", "push")
+		r.Header.Add("X-Hub-Signature", signature(payload))
+		w := httptest.NewRecorder()
+		g.WebHookHandler(w, r)
+		return w
+	}
+
+	if w := deliver("guid-1"); w.Code != http.StatusAccepted {
+		t.Fatalf("have code: %v want: %v", w.Code, http.StatusAccepted)
+	}
+
+	// The queue's buffer is full, so the delivery is rejected.
+	w := deliver("guid-2")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("have code: %v Retry-After: %q want: %v", w.Code, w.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	if have := rejected() - before; have != 1 {
+		t.Errorf("have %v rejected jobs, want 1", have)
+	}
+	delivery, _ := memDB.GetWebhookDelivery("guid-2")
+	if delivery.Result != db.DeliveryResultError || delivery.Error != errQueueFull.Error() {
+		t.Errorf("unexpected rejected delivery: %+v", delivery)
+	}
+
+	// Once the queue has capacity, the rejected delivery can be redelivered.
+	<-queue
+	if w := deliver("guid-2"); w.Code != http.StatusAccepted {
+		t.Errorf("redelivery have code: %v want: %v", w.Code, http.StatusAccepted)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	var l latency
+	if have, want := l.String(), `{"count":0,"mean":0,"max":0}`; have != want {
+		t.Errorf("have: %v want: %v", have, want)
+	}
+	l.observe(time.Second)
+	l.observe(3 * time.Second)
+	if have, want := l.String(), `{"count":2,"mean":2,"max":3}`; have != want {
+		t.Errorf("have: %v want: %v", have, want)
+	}
+}
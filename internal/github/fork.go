@@ -0,0 +1,84 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// forkApprovalLabel is the label maintainers add to a pull request from a
+// fork to approve it for analysis, when the installation requires approval.
+const forkApprovalLabel = "gopherci:approved"
+
+// isFork returns true if the pull request's head is not in the base
+// repository, the head repository may be nil if the fork has been deleted.
+func isFork(pr *github.PullRequest) bool {
+	return pr.Head.Repo == nil || pr.Head.Repo.GetID() != pr.Base.Repo.GetID()
+}
+
+// isForkApproval returns true if the event is the forkApprovalLabel being
+// added to a pull request. The label is read from the event's payload, as
+// it's not included in github.PullRequestEvent.
+func isForkApproval(e *github.PullRequestEvent, payload []byte) bool {
+	if e.GetAction() != "labeled" {
+		return false
+	}
+	var labeled struct {
+		Label github.Label `json:"label"`
+	}
+	if err := json.Unmarshal(payload, &labeled); err != nil {
+		return false
+	}
+	return labeled.Label.GetName() == forkApprovalLabel
+}
+
+// approveFork records the head commit of the pull request in e, which is the
+// forkApprovalLabel being added, as approved for analysis. Only the commit
+// which was labelled is approved, so commits pushed after the approval
+// aren't analysed.
+func (g *GitHub) approveFork(e *github.PullRequestEvent) error {
+	install, err := g.db.GetGHInstallation(e.Installation.GetID())
+	if err != nil {
+		return errors.Wrap(err, "could not get installation")
+	}
+	if install == nil {
+		// Nothing to approve, the installation isn't analysed.
+		return nil
+	}
+	return g.db.ApproveFork(install.ID, e.Repo.GetID(), e.GetNumber(), e.PullRequest.Head.GetSHA())
+}
+
+// ForkApproved returns true if a pull request from a fork by author can be
+// analysed, because the pull request has the forkApprovalLabel and its head
+// commit was approved (headApproved is true), or author is not a first time
+// contributor, that is, author already has commits in the repository. If
+// the pull request has the forkApprovalLabel but its head commit wasn't
+// approved, the label is removed so it can be added again to approve it.
+func (i *Installation) ForkApproved(ctx context.Context, owner, repo string, prNumber int, author string, headApproved bool) (bool, error) {
+	labels, _, err := i.client.Issues.ListLabelsByIssue(ctx, owner, repo, prNumber, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "could not list labels")
+	}
+	for _, label := range labels {
+		if label.GetName() != forkApprovalLabel {
+			continue
+		}
+		if headApproved {
+			return true, nil
+		}
+		if _, err := i.client.Issues.RemoveLabelForIssue(ctx, owner, repo, prNumber, forkApprovalLabel); err != nil {
+			return false, errors.Wrap(err, "could not remove approval label")
+		}
+	}
+
+	commits, _, err := i.client.Repositories.ListCommits(ctx, owner, repo, &github.CommitsListOptions{
+		Author:      author,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "could not list commits by %v", author)
+	}
+	return len(commits) > 0, nil
+}
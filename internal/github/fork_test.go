@@ -0,0 +1,113 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestIsForkApproval(t *testing.T) {
+	tests := []struct {
+		action  string
+		payload string
+		want    bool
+	}{
+		{"labeled", `{"label":{"name":"gopherci:approved"}}`, true},
+		{"labeled", `{"label":{"name":"bug"}}`, false},
+		{"unlabeled", `{"label":{"name":"gopherci:approved"}}`, false},
+		{"labeled", `{`, false},
+	}
+	for _, test := range tests {
+		e := &github.PullRequestEvent{Action: github.String(test.action)}
+		if have := isForkApproval(e, []byte(test.payload)); have != test.want {
+			t.Errorf("action: %v payload: %v have: %v want: %v", test.action, test.payload, have, test.want)
+		}
+	}
+}
+
+func TestApproveFork(t *testing.T) {
+	g, _, memDB := setup(t)
+	_ = memDB.AddGHInstallation(2, 3, 4)
+
+	e := &github.PullRequestEvent{
+		Action:       github.String("labeled"),
+		Number:       github.Int(5),
+		Installation: &github.Installation{ID: github.Int(2)},
+		Repo:         &github.Repository{ID: github.Int(100)},
+		PullRequest:  &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("abc")}},
+	}
+	if err := g.approveFork(e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if approved, _ := memDB.ForkApproved(100, 5, "abc"); !approved {
+		t.Error("labelled head commit not approved")
+	}
+	if approved, _ := memDB.ForkApproved(100, 5, "def"); approved {
+		t.Error("unexpected approval of another commit")
+	}
+
+	// Unknown installations aren't approved.
+	e.Installation.ID = github.Int(6)
+	e.PullRequest.Head.SHA = github.String("def")
+	if err := g.approveFork(e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if approved, _ := memDB.ForkApproved(100, 5, "def"); approved {
+		t.Error("unexpected approval for unknown installation")
+	}
+}
+
+func TestForkApproved(t *testing.T) {
+	tests := []struct {
+		labels       string
+		headApproved bool
+		commits      string
+		want         bool
+		wantRemoved  bool
+	}{
+		{`[{"name":"gopherci:approved"}]`, true, `[]`, true, false},  // approved
+		{`[{"name":"gopherci:approved"}]`, false, `[]`, false, true}, // approved before commits were pushed
+		{`[{"name":"bug"}]`, false, `[{"sha":"abc"}]`, true, false},  // existing contributor
+		{`[{"name":"bug"}]`, true, `[]`, false, false},               // approval label removed
+		{`[{"name":"bug"}]`, false, `[]`, false, false},              // first time contributor
+	}
+	for _, test := range tests {
+		var removed bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "DELETE" && r.URL.Path == "/repos/owner/repo/issues/2/labels/gopherci:approved":
+				removed = true
+			case r.URL.Path == "/repos/owner/repo/issues/2/labels":
+				fmt.Fprint(w, test.labels)
+			case r.URL.Path == "/repos/owner/repo/commits":
+				if author := r.URL.Query().Get("author"); author != "contributor" {
+					t.Errorf("commits author have: %q want: %q", author, "contributor")
+				}
+				fmt.Fprint(w, test.commits)
+			default:
+				t.Errorf("unexpected request: %v %v", r.Method, r.URL)
+				http.NotFound(w, r)
+			}
+		}))
+
+		i := Installation{client: github.NewClient(nil)}
+		i.client.BaseURL, _ = url.Parse(ts.URL + "/")
+
+		have, err := i.ForkApproved(context.Background(), "owner", "repo", 2, "contributor", test.headApproved)
+		if err != nil {
+			t.Errorf("%+v unexpected error: %v", test, err)
+		}
+		if have != test.want {
+			t.Errorf("%+v have: %v want: %v", test, have, test.want)
+		}
+		if removed != test.wantRemoved {
+			t.Errorf("%+v have label removed: %v want: %v", test, removed, test.wantRemoved)
+		}
+		ts.Close()
+	}
+}
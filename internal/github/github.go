@@ -1,24 +1,38 @@
 package github
 
 import (
+	"context"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
 )
 
 // GitHub is the type gopherci uses to interract with github.com.
 type GitHub struct {
-	db             db.DB
-	analyser       analyser.Analyser
-	queuePush      chan<- interface{}
-	webhookSecret  []byte            // shared webhook secret configured for the integration
-	integrationID  int               // id is the integration id
-	integrationKey []byte            // integrationKey is the private key for the installationID
-	tr             http.RoundTripper // tr is a transport shared by all installations to reuse http connections
-	baseURL        string            // baseURL for GitHub API
-	gciBaseURL     string            // gciBaseURL is the base URL for GopherCI
+	db              db.DB
+	analyser        analyser.Analyser
+	queuePush       chan<- interface{}
+	webhookSecret   []byte            // shared webhook secret configured for the integration
+	integrationID   int               // id is the integration id
+	integrationKey  []byte            // integrationKey is the private key for the installationID
+	tr              http.RoundTripper // tr is a transport shared by all installations to reuse http connections
+	baseURL         string            // baseURL for GitHub API
+	gciBaseURL      string            // gciBaseURL is the base URL for GopherCI
+	autoApprove     map[string]bool   // autoApprove are the lower case logins of accounts whose installations are approved when created
+	enqueueTimeout  time.Duration     // enqueueTimeout is the maximum duration to wait to add a job to a full queue
+	cloneTimeout    time.Duration     // cloneTimeout is the maximum duration of each clone command, zero uses the analyser's default
+	depsTimeout     time.Duration     // depsTimeout is the maximum duration of installing dependencies, zero uses the analyser's default
+	toolTimeout     time.Duration     // toolTimeout is the maximum duration of each tool, zero uses the analyser's default
+	toolConcurrency int               // toolConcurrency is the maximum number of tools executed concurrently, zero uses the analyser's default
+	webURL          string            // webURL is the base URL for GitHub's website, used to sign users in
+	clientID        string            // clientID is the integration's OAuth client ID
+	clientSecret    string            // clientSecret is the integration's OAuth client secret
 }
 
 // New returns a GitHub object for use with GitHub integrations
@@ -36,7 +50,9 @@ func New(analyser analyser.Analyser, db db.DB, queuePush chan<- interface{}, int
 		integrationKey: integrationKey,
 		tr:             http.DefaultTransport,
 		baseURL:        "https://api.github.com",
+		webURL:         "https://github.com",
 		gciBaseURL:     gciBaseURL,
+		enqueueTimeout: defaultEnqueueTimeout,
 	}
 
 	// TODO some prechecks should be done now, instead of later, fail fast/early.
@@ -44,6 +60,20 @@ func New(analyser analyser.Analyser, db db.DB, queuePush chan<- interface{}, int
 	return g, nil
 }
 
+// SetTimeouts sets the maximum durations of each command used to clone a
+// repository, of installing its dependencies and of each tool, which does not
+// have its own timeout, during an analysis. Zero durations use the analyser's
+// defaults.
+func (g *GitHub) SetTimeouts(clone, deps, tool time.Duration) {
+	g.cloneTimeout, g.depsTimeout, g.toolTimeout = clone, deps, tool
+}
+
+// SetToolConcurrency sets the maximum number of tools executed concurrently
+// during an analysis, zero uses the analyser's default.
+func (g *GitHub) SetToolConcurrency(n int) {
+	g.toolConcurrency = n
+}
+
 func (g *GitHub) newInstallationTransport(installationID int) (*ghinstallation.Transport, error) {
 	tr, err := ghinstallation.New(g.tr, g.integrationID, installationID, g.integrationKey)
 	if err != nil {
@@ -52,3 +82,74 @@ func (g *GitHub) newInstallationTransport(installationID int) (*ghinstallation.T
 	tr.BaseURL = g.baseURL
 	return tr, nil
 }
+
+// UserID returns the ID of the GitHub user who owns the OAuth or personal
+// access token.
+func (g *GitHub) UserID(ctx context.Context, token string) (int, error) {
+	client, err := g.userClient(token)
+	if err != nil {
+		return 0, err
+	}
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get authenticated user")
+	}
+	return user.GetID(), nil
+}
+
+// OrgAdmin returns true if the GitHub user who owns the OAuth or personal
+// access token is an active admin (owner) of the organisation with orgID. The
+// token requires the read:org scope.
+func (g *GitHub) OrgAdmin(ctx context.Context, token string, orgID int) (bool, error) {
+	client, err := g.userClient(token)
+	if err != nil {
+		return false, err
+	}
+
+	opt := &github.ListOrgMembershipsOptions{State: "active", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		memberships, resp, err := client.Organizations.ListOrgMemberships(ctx, opt)
+		if err != nil {
+			return false, errors.Wrap(err, "could not list organisation memberships")
+		}
+		for _, membership := range memberships {
+			if membership.Organization.GetID() == orgID {
+				return membership.GetRole() == "admin", nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// userClient returns a client authenticated as the user who owns the OAuth
+// or personal access token.
+func (g *GitHub) userClient(token string) (*github.Client, error) {
+	client := github.NewClient(&http.Client{Transport: &tokenTransport{token: token, base: g.tr}})
+	var err error
+	client.BaseURL, err = url.Parse(g.baseURL)
+	return client, err
+}
+
+// tokenTransport is a http.RoundTripper which authenticates requests using
+// a GitHub OAuth or personal access token.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip must not modify the request
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(r)
+}
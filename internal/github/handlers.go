@@ -2,6 +2,8 @@ package github
 
 import (
 	"context"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -40,41 +42,164 @@ func (g *GitHub) CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, target, http.StatusSeeOther)
 }
 
-// WebHookHandler is the net/http handler for github webhooks.
+// deliveryTimeout is the maximum duration a delivery is expected to be handled
+// within. Deliveries still pending after this, such as when the process
+// handling them exited, are considered abandoned and may be handled again.
+const deliveryTimeout = 5 * time.Minute
+
+// WebHookHandler is the net/http handler for github webhooks. Each delivery
+// is recorded, and redeliveries of deliveries which have already been handled
+// successfully are ignored. Deliveries whose events are queued are accepted
+// without waiting for them to be processed, and if the queue is full, the
+// delivery is rejected as the service is unavailable, so it can be
+// redelivered or replayed.
 func (g *GitHub) WebHookHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	delivery := &db.WebhookDelivery{Event: github.WebHookType(r)}
+
 	payload, err := github.ValidatePayload(r, g.webhookSecret)
 	if err != nil {
 		log.Println("github: failed to validate payload:", err)
+		delivery.Result, delivery.Error = db.DeliveryResultInvalid, err.Error()
+		g.recordDelivery(delivery, start)
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	delivery.GUID, delivery.Payload = r.Header.Get("X-GitHub-Delivery"), payload
+	delivery.RepositoryID = payloadRepositoryID(payload)
 
-	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if delivery.GUID != "" {
+		reserved, err := g.db.ReserveWebhookDelivery(delivery, deliveryTimeout)
+		if err != nil {
+			log.Println("github: could not reserve delivery:", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			log.Printf("github: ignoring duplicate delivery: %v", delivery.GUID)
+			return
+		}
+	}
+
+	err = g.handleDelivery(delivery)
+	g.recordDelivery(delivery, start)
+	switch {
+	case delivery.Result == db.DeliveryResultInvalid:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	case errors.Cause(err) == errQueueFull:
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case delivery.Result == db.DeliveryResultQueued:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// payloadRepositoryID returns the ID of the repository in a webhook's
+// payload, or 0 if the event is not for a single repository.
+func payloadRepositoryID(payload []byte) int {
+	var event struct {
+		Repository github.Repository `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return 0
+	}
+	return event.Repository.GetID()
+}
+
+// handleDelivery handles the event in a webhook delivery, setting the
+// delivery's result and error.
+func (g *GitHub) handleDelivery(delivery *db.WebhookDelivery) error {
+	event, err := github.ParseWebHook(delivery.Event, delivery.Payload)
 	if err != nil {
 		log.Println("github: failed to parse webhook:", err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
+		delivery.Result, delivery.Error = db.DeliveryResultInvalid, err.Error()
+		return err
 	}
 
+	delivery.Result, delivery.Error = db.DeliveryResultProcessed, ""
 	switch e := event.(type) {
 	case *github.IntegrationInstallationEvent:
 		log.Printf("github: integration event: %v, installation id: %v", *e.Action, *e.Installation.ID)
 		err = g.integrationInstallationEvent(e)
+		if err == nil && e.GetAction() == "created" {
+			err = g.installationCreatedEvent(e, delivery.Payload)
+		}
+	case *github.InstallationRepositoriesEvent:
+		log.Printf("github: installation repositories event: %v, installation id: %v", e.GetAction(), e.Installation.GetID())
+		err = g.installationRepositoriesEvent(e)
+	case *github.RepositoryEvent:
+		log.Printf("github: repository event: %v, installation id: %v", e.GetAction(), e.Installation.GetID())
+		err = g.repositoryEvent(e)
+		if err == nil && e.GetAction() == "deleted" {
+			// The repository's deliveries were purged, so don't keep the
+			// repository's data in this delivery either.
+			delivery.RepositoryID, delivery.Payload = 0, nil
+		}
 	case *github.PushEvent:
 		log.Printf("github: push event: installation id: %v", *e.Installation.ID)
-		g.queuePush <- e
+		err = g.enqueue(e)
+		delivery.Result = db.DeliveryResultQueued
 	case *github.PullRequestEvent:
-		if validPRAction(*e.Action) {
+		delivery.Result = db.DeliveryResultIgnored
+		approval := isForkApproval(e, delivery.Payload)
+		if approval {
+			err = g.approveFork(e)
+		}
+		if err == nil && (validPRAction(*e.Action) || approval) {
 			log.Printf("github: pull request event: %v, installation id: %v", *e.Action, *e.Installation.ID)
-			g.queuePush <- e
+			err = g.enqueue(e)
+			delivery.Result = db.DeliveryResultQueued
+		}
+	case *github.PullRequestReviewCommentEvent:
+		delivery.Result = db.DeliveryResultIgnored
+		if isIgnoreCommand(e) {
+			log.Printf("github: ignore command: installation id: %v", e.Installation.GetID())
+			err = g.enqueue(e)
+			delivery.Result = db.DeliveryResultQueued
 		}
 	default:
 		log.Printf("github: ignored webhook event: %T", event)
+		delivery.Result = db.DeliveryResultIgnored
 	}
 	if err != nil {
 		log.Println("github: event handler error:", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		delivery.Result, delivery.Error = db.DeliveryResultError, err.Error()
 	}
+	return err
+}
+
+// recordDelivery records a webhook delivery which started at start, errors
+// are logged, as they shouldn't prevent the delivery being handled.
+func (g *GitHub) recordDelivery(delivery *db.WebhookDelivery, start time.Time) {
+	delivery.Duration = db.Duration(time.Since(start))
+	if err := g.db.RecordWebhookDelivery(delivery); err != nil {
+		log.Printf("github: could not record delivery %v: %v", delivery.GUID, err)
+	}
+}
+
+// ReplayDelivery handles the recorded webhook delivery with guid again, such
+// as to analyse a push which failed due to an internal error. The delivery's
+// result is updated and returned, nil is returned if the delivery has not
+// been recorded.
+func (g *GitHub) ReplayDelivery(guid string) (*db.WebhookDelivery, error) {
+	delivery, err := g.db.GetWebhookDelivery(guid)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get delivery")
+	}
+	if delivery == nil {
+		return nil, nil
+	}
+	if delivery.Payload == nil {
+		return nil, errors.New("delivery has no payload")
+	}
+	log.Printf("github: replaying delivery: %v", guid)
+
+	start := time.Now()
+	g.handleDelivery(delivery)
+	g.recordDelivery(delivery, start)
+	return delivery, nil
 }
 
 func (g *GitHub) integrationInstallationEvent(e *github.IntegrationInstallationEvent) error {
@@ -83,6 +208,10 @@ func (g *GitHub) integrationInstallationEvent(e *github.IntegrationInstallationE
 	case "created":
 		// Record the installation event in the database
 		err = g.db.AddGHInstallation(*e.Installation.ID, *e.Installation.Account.ID, *e.Sender.ID)
+		if err == nil && g.isAutoApproved(e.Installation.Account.GetLogin()) {
+			log.Printf("github: auto approving installation id: %v, account: %v", *e.Installation.ID, e.Installation.Account.GetLogin())
+			err = g.db.ApproveGHInstallation(*e.Installation.ID)
+		}
 	case "deleted":
 		// Remove the installation event from the database
 		err = g.db.RemoveGHInstallation(*e.Installation.ID)
@@ -112,14 +241,21 @@ func PushConfig(e *github.PushEvent) AnalyseConfig {
 		baseRef:   fmt.Sprintf("%v~%v", *e.After, len(e.Commits)),
 		headURL:   *e.Repo.CloneURL,
 		headRef:   *e.After,
+		branch:    strings.TrimPrefix(e.GetRef(), "refs/heads/"),
 		goSrcPath: stripScheme(*e.Repo.HTMLURL),
+		private:   e.Repo.GetPrivate(),
+		owner:     e.Repo.Owner.GetName(),
+		repo:      e.Repo.GetName(),
+		sha:       *e.After,
 	}
 }
 
-// PullRequestConfig return an AnalyseConfig for a GitHub Pull Request.
+// PullRequestConfig return an AnalyseConfig for a GitHub Pull Request. Pull
+// requests from forks are fetched from the base repository, as the fork may
+// not be accessible, and are untrusted.
 func PullRequestConfig(e *github.PullRequestEvent) AnalyseConfig {
 	pr := e.PullRequest
-	return AnalyseConfig{
+	cfg := AnalyseConfig{
 		eventType:       analyser.EventTypePullRequest,
 		installationID:  *e.Installation.ID,
 		repositoryID:    *e.Repo.ID,
@@ -127,14 +263,94 @@ func PullRequestConfig(e *github.PullRequestEvent) AnalyseConfig {
 		statusesURL:     *pr.StatusesURL,
 		baseURL:         *pr.Base.Repo.CloneURL,
 		baseRef:         *pr.Base.Ref,
-		headURL:         *pr.Head.Repo.CloneURL,
+		headURL:         pr.Head.Repo.GetCloneURL(),
 		headRef:         *pr.Head.Ref,
+		branch:          *pr.Head.Ref,
 		goSrcPath:       stripScheme(*pr.Base.Repo.HTMLURL),
+		private:         pr.Base.Repo.GetPrivate(),
 		owner:           *pr.Base.Repo.Owner.Login,
 		repo:            *pr.Base.Repo.Name,
 		pr:              *e.Number,
 		sha:             *pr.Head.SHA,
+		author:          pr.User.GetLogin(),
+	}
+	if isFork(pr) {
+		cfg.untrusted = true
+		cfg.headURL = cfg.baseURL
+		cfg.headRef = fmt.Sprintf("refs/pull/%d/head", cfg.pr)
 	}
+	return cfg
+}
+
+// FullScan is a request to record all issues in a repository at a ref, not
+// just the issues introduced by a push or pull request.
+type FullScan struct {
+	InstallationID int    // InstallationID is the GitHub installation ID.
+	Owner          string // Owner is the repository's owner.
+	Repo           string // Repo is the repository's name.
+	Ref            string // Ref is a branch, tag or sha, if empty the repository's default branch is used.
+}
+
+func init() {
+	// FullScan is added to the queue, which may gob encode it.
+	gob.Register(&FullScan{})
+}
+
+// FullScanConfig returns an AnalyseConfig for a FullScan, resolving the
+// repository and ref using the installation.
+func (g *GitHub) FullScanConfig(scan *FullScan) (AnalyseConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	install, err := g.NewInstallation(scan.InstallationID)
+	if err != nil {
+		return AnalyseConfig{}, errors.Wrap(err, "error getting installation")
+	}
+	if install == nil {
+		return AnalyseConfig{}, fmt.Errorf("could not find installation with ID %v", scan.InstallationID)
+	}
+
+	repo, _, err := install.client.Repositories.Get(ctx, scan.Owner, scan.Repo)
+	if err != nil {
+		return AnalyseConfig{}, errors.Wrapf(err, "could not get repository %v/%v", scan.Owner, scan.Repo)
+	}
+
+	// Public repositories are accessible by any installation, so only scan
+	// repositories covered by this installation.
+	covered, err := g.db.GetRepository(repo.GetID())
+	if err != nil {
+		return AnalyseConfig{}, errors.Wrapf(err, "could not get repository %v", repo.GetID())
+	}
+	if covered == nil || covered.InstallationID != install.ID {
+		return AnalyseConfig{}, fmt.Errorf("repository %v/%v is not covered by installation %v", scan.Owner, scan.Repo, scan.InstallationID)
+	}
+
+	ref := scan.Ref
+	if ref == "" {
+		ref = repo.GetDefaultBranch()
+	}
+	sha, _, err := install.client.Repositories.GetCommitSHA1(ctx, scan.Owner, scan.Repo, ref, "")
+	if err != nil {
+		return AnalyseConfig{}, errors.Wrapf(err, "could not get sha for %v/%v@%v", scan.Owner, scan.Repo, ref)
+	}
+
+	return AnalyseConfig{
+		eventType:       analyser.EventTypeFullScan,
+		installationID:  scan.InstallationID,
+		repositoryID:    repo.GetID(),
+		statusesContext: "ci/gopherci/scan",
+		statusesURL:     strings.Replace(repo.GetStatusesURL(), "{sha}", sha, -1),
+		commitTo:        sha,
+		baseURL:         repo.GetCloneURL(),
+		headURL:         repo.GetCloneURL(),
+		headRef:         sha,
+		branch:          ref,
+		goSrcPath:       stripScheme(repo.GetHTMLURL()),
+		private:         repo.GetPrivate(),
+		owner:           scan.Owner,
+		repo:            scan.Repo,
+		sha:             sha,
+	}, nil
 }
 
 // AnalyseConfig is a configuration struct for the Analyse method, all fields
@@ -146,21 +362,26 @@ type AnalyseConfig struct {
 	statusesContext string
 	statusesURL     string
 
-	// if push (EventTypePush)
+	// if push (EventTypePush) or full scan (EventTypeFullScan), commitFrom is
+	// not set for full scans.
 	commitFrom string
 	commitTo   string
 
 	// if pull request (EventTypePullRequest)
-	pr int
+	pr        int
+	author    string // author is the login of the pull request's author.
+	untrusted bool   // untrusted is true if the pull request is from a fork.
 
 	// for analyser.
 	baseURL   string // base for pr, before for push.
 	baseRef   string // ref can be branch for pr or sha~numCommits for push.
 	headURL   string
 	headRef   string // ref can be branch for pr or sha (after) for push.
+	branch    string // branch is the head's branch name, used to track issues.
 	goSrcPath string
+	private   bool // private is true if the repository is private, so cloning requires a token.
 
-	// for issue comments.
+	// for issue comments and reading repository files.
 	owner string // required if eventType is EventTypePullRequest.
 	repo  string // required if eventType is EventTypePullRequest.
 	sha   string // required if eventType is EventTypePullRequest.
@@ -181,12 +402,31 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 		return errors.Wrap(err, "error getting installation")
 	}
 	if install == nil {
-		return fmt.Errorf("could not find installation with ID %v", cfg.installationID)
+		return g.awaitingApproval(ctx, cfg)
 	}
 
-	// Find tools for this repo. StartAnalysis could return these tools instead
+	// Pull requests from forks may need to be approved before their code is
+	// executed, until then the status shows they're awaiting approval.
+	if cfg.untrusted && install.forkApproval {
+		headApproved, err := g.db.ForkApproved(cfg.repositoryID, cfg.pr, cfg.sha)
+		if err != nil {
+			return errors.Wrap(err, "could not get fork approval")
+		}
+		approved, err := install.ForkApproved(ctx, cfg.owner, cfg.repo, cfg.pr, cfg.author, headApproved)
+		if err != nil {
+			return errors.Wrap(err, "could not check fork approval")
+		}
+		if !approved {
+			log.Printf("pull request %v/%v#%v from fork by %v awaiting approval", cfg.owner, cfg.repo, cfg.pr, cfg.author)
+			desc := fmt.Sprintf("Awaiting approval, add the %v label to analyse", forkApprovalLabel)
+			return install.SetStatus(ctx, cfg.statusesContext, cfg.statusesURL, StatusStatePending, desc, "")
+		}
+	}
+
+	// Find tools for this repo, including the installation's own tools.
+	// StartAnalysis could return these tools instead
 	// as part of the analysis type, which Analyser then fills out.
-	tools, err := g.db.ListTools()
+	tools, err := g.db.ListTools(install.ID)
 	if err != nil {
 		return errors.Wrap(err, "could not get tools")
 	}
@@ -202,6 +442,8 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 	analysis.CommitFrom = cfg.commitFrom
 	analysis.CommitTo = cfg.commitTo
 	analysis.RequestNumber = cfg.pr
+	analysis.FullScan = cfg.eventType == analyser.EventTypeFullScan
+	analysis.Ref = cfg.branch
 
 	// Set the CI status API to pending
 	err = install.SetStatus(ctx, cfg.statusesContext, cfg.statusesURL, StatusStatePending, "In progress", analysisURL)
@@ -228,14 +470,66 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 		}
 	}()
 
+	// Record the repository's current name and visibility, as the repository
+	// may have been added before its events were tracked. Private repositories
+	// aren't analysed unless they're recorded as private, as they may still be
+	// recorded as public, which would make their analyses public.
+	if cfg.owner != "" && cfg.repo != "" {
+		repo := db.Repository{ID: cfg.repositoryID, InstallationID: install.ID, Owner: cfg.owner, Name: cfg.repo, Private: cfg.private}
+		if err := g.db.SetRepository(repo); err != nil {
+			if cfg.private {
+				return errors.Wrapf(err, "could not set private repository %v", repo.FullName())
+			}
+			log.Printf("could not set repository %v: %v", repo.FullName(), err)
+		}
+	}
+
+	// Find the version of Go the repository requires, errors are not fatal as
+	// the next source of the version, or the analyser's default, is used.
+	goVersion, err := install.GoVersion(ctx, cfg.owner, cfg.repo, cfg.sha)
+	if err != nil {
+		log.Printf("could not get Go version for %v/%v@%v: %v", cfg.owner, cfg.repo, cfg.sha, err)
+	}
+
+	// Issues users have marked as false positives are not reported.
+	ignored, err := g.db.SuppressedFingerprints(cfg.repositoryID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get suppressed issues for repositoryID %v", cfg.repositoryID)
+	}
+
 	// Analyse
 	acfg := analyser.Config{
-		EventType: cfg.eventType,
-		BaseURL:   cfg.baseURL,
-		BaseRef:   cfg.baseRef,
-		HeadURL:   cfg.headURL,
-		HeadRef:   cfg.headRef,
-		GoSrcPath: cfg.goSrcPath,
+		EventType:       cfg.eventType,
+		BaseURL:         cfg.baseURL,
+		BaseRef:         cfg.baseRef,
+		HeadURL:         cfg.headURL,
+		HeadRef:         cfg.headRef,
+		GoSrcPath:       cfg.goSrcPath,
+		GoVersion:       goVersion,
+		CloneTimeout:    g.cloneTimeout,
+		DepsTimeout:     g.depsTimeout,
+		ToolTimeout:     g.toolTimeout,
+		ToolConcurrency: g.toolConcurrency,
+		Suppressed:      ignored,
+		Untrusted:       cfg.untrusted,
+	}
+
+	// Private repositories are cloned using an installation access token,
+	// which is only provided to git by the analyser and never logged.
+	if cfg.private {
+		token, err := install.Token()
+		if err != nil {
+			return errors.Wrap(err, "could not get installation token")
+		}
+		acfg.GitToken = analyser.Secret(token)
+	}
+
+	// Private dependencies are installed using the installation's
+	// credentials, which are withheld from untrusted code.
+	if !cfg.untrusted {
+		if acfg.Deps, err = g.depsConfig(install, cfg.goSrcPath); err != nil {
+			return err
+		}
 	}
 
 	err = analyser.Analyse(ctx, g.analyser, tools, acfg, analysis)
@@ -243,24 +537,55 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 		return errors.Wrap(err, "could not run analyser")
 	}
 
+	// Track issues against the previous analysis of the pull request or
+	// branch. Pushes only analyse the pushed commits, so their issues can't
+	// be compared with the previous push's.
+	var previous *db.Analysis
+	if cfg.pr != 0 || analysis.FullScan {
+		var perr error
+		previous, perr = g.db.GetPreviousAnalysis(analysis)
+		if perr != nil {
+			log.Printf("could not get previous analysis for analysisID %v: %v", analysis.ID, perr)
+		}
+		analysis.Track(previous)
+	}
+
 	// if this is a PR add comments, suppressed is the number of comments that
 	// would have been submitted if it wasn't for an internal fixed limit. For
 	// pushes, there are no comments, so suppressed is 0.
-	var suppressed = 0
-	if cfg.pr != 0 {
+	var (
+		suppressed = 0
+		written    []db.IssueComment
+	)
+	switch {
+	case cfg.pr != 0 && install.singleReview:
+		suppressed, written, err = install.WriteReview(ctx, cfg.owner, cfg.repo, cfg.pr, cfg.sha, analysisURL, analysis.Issues())
+		g.recordIssueComments(install, cfg, analysis, written)
+		if err != nil {
+			return err
+		}
+		log.Printf("wrote issues as a review, suppressed %v", suppressed)
+	case cfg.pr != 0:
 		var issues []db.Issue
 		suppressed, issues, err = install.FilterIssues(ctx, cfg.owner, cfg.repo, cfg.pr, analysis.Issues())
 		if err != nil {
 			return err
 		}
 
-		err = install.WriteIssues(ctx, cfg.owner, cfg.repo, cfg.pr, cfg.sha, issues)
+		written, err = install.WriteIssues(ctx, cfg.owner, cfg.repo, cfg.pr, cfg.sha, issues)
+		g.recordIssueComments(install, cfg, analysis, written)
 		if err != nil {
 			return err
 		}
 		log.Printf("wrote %v issues as comments, suppressed %v", len(issues)-suppressed, suppressed)
 	}
 
+	// Update comments for issues which have been fixed, and the summary.
+	if cfg.pr != 0 {
+		g.fixIssueComments(ctx, install, cfg, analysis, ignored)
+		g.writeSummary(ctx, install, cfg, tools, analysis, previous, analysisURL)
+	}
+
 	// Set the CI status API to success
 	statusDesc := statusDesc(analysis.Issues(), suppressed)
 	if err := install.SetStatus(ctx, cfg.statusesContext, cfg.statusesURL, StatusStateSuccess, statusDesc, analysisURL); err != nil {
@@ -3,14 +3,19 @@ package github
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
@@ -49,6 +54,7 @@ kGTL0A6/0yAu9qQZlFbaD5bWhQo7eyx63u4hZGppBhkTSPikOYUPCH8=
 
 type mockAnalyser struct {
 	goSrcPath string
+	env       []string // env is the last environment provided to ExecuteEnv
 }
 
 func (a *mockAnalyser) NewExecuter(_ context.Context, goSrcPath string) (analyser.Executer, error) {
@@ -68,11 +74,12 @@ index 0000000..6362395
 	if len(args) > 0 && args[0] == "tool" {
 		return []byte(`main.go:1: error`), nil
 	}
-	if len(args) > 0 && args[0] == "isFileGenerated" {
-		return nil, &analyser.NonZeroError{ExitCode: 1}
-	}
 	return nil, nil
 }
+func (a *mockAnalyser) ExecuteEnv(ctx context.Context, args []string, env []string) ([]byte, error) {
+	a.env = env
+	return a.Execute(ctx, args)
+}
 func (a *mockAnalyser) Stop(_ context.Context) error { return nil }
 
 const webhookSecret = "ede9aa6b6e04fafd53f7460fb75644302e249177"
@@ -121,17 +128,18 @@ func TestCallbackHandler(t *testing.T) {
 
 func TestWebhookHandler(t *testing.T) {
 	tests := []struct {
-		signature  string
-		event      string
-		expectCode int
+		signature    string
+		event        string
+		expectCode   int
+		expectResult db.DeliveryResult
 	}{
-		{"sha1=d1e100e3f17e8399b73137382896ff1536c59457", "goci-invalid", http.StatusBadRequest},
-		{"sha1=d1e100e3f17e8399b73137382896ff1536c59457", "issues", http.StatusOK},
-		{"sha1=aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "issues", http.StatusBadRequest},
+		{"sha1=d1e100e3f17e8399b73137382896ff1536c59457", "goci-invalid", http.StatusBadRequest, db.DeliveryResultInvalid},
+		{"sha1=d1e100e3f17e8399b73137382896ff1536c59457", "issues", http.StatusOK, db.DeliveryResultIgnored},
+		{"sha1=aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "issues", http.StatusBadRequest, db.DeliveryResultInvalid},
 	}
 
 	for _, test := range tests {
-		g, _, _ := setup(t)
+		g, _, memDB := setup(t)
 		body := bytes.NewBufferString(`{"key":"value"}`)
 		r, err := http.NewRequest("POST", "https://example.com", body)
 		if err != nil {
@@ -145,6 +153,114 @@ func TestWebhookHandler(t *testing.T) {
 		if w.Code != test.expectCode {
 			t.Fatalf("have code: %v, want: %v, test: %+v", w.Code, test.expectCode, test)
 		}
+		if len(memDB.Deliveries) != 1 || memDB.Deliveries[0].Result != test.expectResult {
+			t.Errorf("have deliveries: %+v, want result: %v, test: %+v", memDB.Deliveries, test.expectResult, test)
+		}
+	}
+}
+
+// signature returns the X-Hub-Signature header of payload.
+func signature(payload string) string {
+	mac := hmac.New(sha1.New, []byte(webhookSecret))
+	mac.Write([]byte(payload))
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookHandler_deliveries(t *testing.T) {
+	memDB := db.NewMockDB()
+	queue := make(chan interface{}, 10)
+	g, err := New(&mockAnalyser{}, memDB, queue, 1, integrationKey, webhookSecret, "https://example.com")
+	if err != nil {
+		t.Fatal("could not initialise GitHub:", err)
+	}
+
+	deliver := func(guid, event, payload string) int {
+		r := httptest.NewRequest("POST", "https://example.com", strings.NewReader(payload))
+		r.Header.Add("X-GitHub-Delivery", guid)
+		r.Header.Add("X-GitHub-Event", event)
+		r.Header.Add("X-Hub-Signature", signature(payload))
+		w := httptest.NewRecorder()
+		g.WebHookHandler(w, r)
+		return w.Code
+	}
+
+	// Redeliveries of a successful delivery are not queued again.
+	push := `{"after":"abcdef","installation":{"id":2},"repository":{"id":1}}`
+	if code := deliver("guid-push", "push", push); code != http.StatusAccepted {
+		t.Fatalf("have code: %v want: %v", code, http.StatusAccepted)
+	}
+	if code := deliver("guid-push", "push", push); code != http.StatusOK {
+		t.Fatalf("redelivery have code: %v want: %v", code, http.StatusOK)
+	}
+	if len(queue) != 1 {
+		t.Errorf("have %v queued jobs, want 1", len(queue))
+	}
+	<-queue
+	if delivery, _ := memDB.GetWebhookDelivery("guid-push"); delivery.RepositoryID != 1 {
+		t.Errorf("have delivery repository ID: %v want: 1", delivery.RepositoryID)
+	}
+
+	// Redeliveries of a delivery which is still being handled are ignored.
+	memDB.ReserveWebhookDelivery(&db.WebhookDelivery{GUID: "guid-pending", Event: "push", Payload: []byte(push)}, deliveryTimeout)
+	if code := deliver("guid-pending", "push", push); code != http.StatusOK {
+		t.Fatalf("pending redelivery have code: %v want: %v", code, http.StatusOK)
+	}
+	if len(queue) != 0 {
+		t.Errorf("have %v queued jobs after pending redelivery, want 0", len(queue))
+	}
+
+	// Redeliveries of an abandoned pending delivery are handled again.
+	memDB.ReserveWebhookDelivery(&db.WebhookDelivery{
+		GUID:      "guid-abandoned",
+		Event:     "push",
+		Payload:   []byte(push),
+		UpdatedAt: time.Now().Add(-2 * deliveryTimeout),
+	}, deliveryTimeout)
+	if code := deliver("guid-abandoned", "push", push); code != http.StatusAccepted {
+		t.Fatalf("abandoned redelivery have code: %v want: %v", code, http.StatusAccepted)
+	}
+	if len(queue) != 1 {
+		t.Errorf("have %v queued jobs after abandoned redelivery, want 1", len(queue))
+	}
+	<-queue
+
+	// Redeliveries of a failed delivery are handled again.
+	installation := `{"action":"created","installation":{"id":2,"account":{"id":3}},"sender":{"id":4}}`
+	memDB.RecordWebhookDelivery(&db.WebhookDelivery{
+		GUID:    "guid-install",
+		Event:   "installation",
+		Payload: []byte(installation),
+		Result:  db.DeliveryResultError,
+		Error:   "database error handling integration installation event",
+	})
+	if code := deliver("guid-install", "installation", installation); code != http.StatusOK {
+		t.Fatalf("have code: %v want: %v", code, http.StatusOK)
+	}
+	delivery, _ := memDB.GetWebhookDelivery("guid-install")
+	if delivery.Result != db.DeliveryResultProcessed || delivery.Attempts != 2 {
+		t.Errorf("unexpected redelivery: %+v", delivery)
+	}
+	if install, _ := memDB.GetGHInstallation(2); install == nil {
+		t.Errorf("installation not added by redelivery")
+	}
+
+	// Replayed deliveries are handled regardless of their result.
+	delivery, err = g.ReplayDelivery("guid-push")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if delivery.Result != db.DeliveryResultQueued || delivery.Attempts != 2 {
+		t.Errorf("unexpected replayed delivery: %+v", delivery)
+	}
+	if len(queue) != 1 {
+		t.Errorf("have %v queued jobs after replay, want 1", len(queue))
+	}
+
+	if delivery, err := g.ReplayDelivery("unknown"); delivery != nil || err != nil {
+		t.Errorf("unknown delivery have: %+v, %v want: nil, nil", delivery, err)
+	}
+	if len(memDB.Deliveries) != 4 {
+		t.Errorf("have deliveries: %+v, want 4", memDB.Deliveries)
 	}
 }
 
@@ -176,6 +292,7 @@ func TestIntegrationInstallationEvent(t *testing.T) {
 	g.integrationInstallationEvent(event)
 
 	want := &db.GHInstallation{
+		ID:             installationID,
 		InstallationID: installationID,
 		AccountID:      accountID,
 		SenderID:       senderID,
@@ -215,7 +332,11 @@ func TestPushConfig(t *testing.T) {
 		baseRef:         "abcdef~2",
 		headURL:         "https://github.com/owner/repo.git",
 		headRef:         "abcdef",
+		branch:          "master",
 		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abcdef",
 	}
 	e := &github.PushEvent{
 		Installation: &github.Installation{
@@ -223,10 +344,13 @@ func TestPushConfig(t *testing.T) {
 		},
 		Repo: &github.PushEventRepository{
 			ID:          github.Int(2),
+			Name:        github.String("repo"),
+			Owner:       &github.PushEventRepoOwner{Name: github.String("owner")},
 			StatusesURL: github.String("https://github.com/owner/repo/status/{sha}"),
 			CloneURL:    github.String("https://github.com/owner/repo.git"),
 			HTMLURL:     github.String("https://github.com/owner/repo"),
 		},
+		Ref:     github.String("refs/heads/master"),
 		After:   github.String("abcdef"),
 		Commits: []github.PushEventCommit{{}, {}},
 	}
@@ -248,6 +372,7 @@ func TestPullRequestConfig(t *testing.T) {
 		baseRef:         "base-branch",
 		headURL:         "https://github.com/owner/repo.git",
 		headRef:         "head-branch",
+		branch:          "head-branch",
 		goSrcPath:       "github.com/owner/repo",
 		owner:           "owner",
 		repo:            "repo",
@@ -289,6 +414,89 @@ func TestPullRequestConfig(t *testing.T) {
 	if have != want {
 		t.Errorf("have:\n%+v\nwant:\n%+v", have, want)
 	}
+
+	// Pull requests from forks are fetched from the base repository.
+	e.PullRequest.User = &github.User{Login: github.String("contributor")}
+	e.PullRequest.Base.Repo.ID = github.Int(2)
+	e.PullRequest.Head.Repo = &github.Repository{ID: github.Int(3), CloneURL: github.String("https://github.com/contributor/repo.git")}
+	want.headRef = "refs/pull/2/head"
+	want.author = "contributor"
+	want.untrusted = true
+	have = PullRequestConfig(e)
+	if have != want {
+		t.Errorf("fork have:\n%+v\nwant:\n%+v", have, want)
+	}
+
+	// Including when the fork has been deleted.
+	e.PullRequest.Head.Repo = nil
+	have = PullRequestConfig(e)
+	if have != want {
+		t.Errorf("deleted fork have:\n%+v\nwant:\n%+v", have, want)
+	}
+}
+
+func TestFullScanConfig(t *testing.T) {
+	g, _, memDB := setup(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/installations/2/access_tokens":
+			fmt.Fprintln(w, "{}")
+		case "/repos/owner/repo":
+			json.NewEncoder(w).Encode(&github.Repository{
+				ID:            github.Int(1),
+				DefaultBranch: github.String("master"),
+				StatusesURL:   github.String("https://api.github.com/repos/owner/repo/statuses/{sha}"),
+				CloneURL:      github.String("https://github.com/owner/repo.git"),
+				HTMLURL:       github.String("https://github.com/owner/repo"),
+			})
+		case "/repos/owner/repo/commits/master":
+			fmt.Fprint(w, "abcdef")
+		default:
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	_ = memDB.AddGHInstallation(2, 3, 4)
+	memDB.EnableGHInstallation(2)
+
+	// The repository isn't covered by the installation.
+	if _, err := g.FullScanConfig(&FullScan{InstallationID: 2, Owner: "owner", Repo: "repo"}); err == nil {
+		t.Error("expected error for repository not covered by the installation, got nil")
+	}
+	memDB.SetRepository(db.Repository{ID: 1, InstallationID: 5, Owner: "owner", Name: "repo"})
+	if _, err := g.FullScanConfig(&FullScan{InstallationID: 2, Owner: "owner", Repo: "repo"}); err == nil {
+		t.Error("expected error for repository covered by another installation, got nil")
+	}
+
+	memDB.SetRepository(db.Repository{ID: 1, InstallationID: 2, Owner: "owner", Name: "repo"})
+	have, err := g.FullScanConfig(&FullScan{InstallationID: 2, Owner: "owner", Repo: "repo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := AnalyseConfig{
+		eventType:       analyser.EventTypeFullScan,
+		installationID:  2,
+		repositoryID:    1,
+		statusesContext: "ci/gopherci/scan",
+		statusesURL:     "https://api.github.com/repos/owner/repo/statuses/abcdef",
+		commitTo:        "abcdef",
+		baseURL:         "https://github.com/owner/repo.git",
+		headURL:         "https://github.com/owner/repo.git",
+		headRef:         "abcdef",
+		branch:          "master",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abcdef",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected config\nhave: %#v\nwant: %#v", have, want)
+	}
 }
 
 func TestAnalyse(t *testing.T) {
@@ -332,8 +540,7 @@ func TestAnalyse(t *testing.T) {
 				t.Fatalf("unexpected status api change to %v %v %v", status.State, statePending, stateSuccess)
 			}
 		case "/installations/2/access_tokens":
-			// respond with any token to installation transport
-			fmt.Fprintln(w, "{}")
+			fmt.Fprintln(w, `{"token":"secret"}`)
 		case fmt.Sprintf("/repos/%v/%v/pulls/%v/comments", expectedOwner, expectedRepo, expectedPR):
 			if r.Method == "GET" {
 				// list comments - respond with empty array
@@ -351,6 +558,12 @@ func TestAnalyse(t *testing.T) {
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
+			// Comments include the issue's fingerprint, which depends on the
+			// analysed file.
+			if !fingerprintRegexp.MatchString(comment.GetBody()) {
+				t.Errorf("comment body %q has no fingerprint", comment.GetBody())
+			}
+			comment.Body = github.String(fingerprintRegexp.ReplaceAllString(comment.GetBody(), ""))
 			if !reflect.DeepEqual(expected, comment) {
 				t.Fatalf("expected cmt:\n%#v\ngot:\n%#v", expected, comment)
 			} else {
@@ -386,6 +599,7 @@ func TestAnalyse(t *testing.T) {
 		headURL:         "https://github.com/owner/repo.git",
 		headRef:         "head-branch",
 		goSrcPath:       "github.com/owner/repo",
+		private:         true,
 		owner:           expectedOwner,
 		repo:            expectedRepo,
 		pr:              expectedPR,
@@ -405,6 +619,15 @@ func TestAnalyse(t *testing.T) {
 	case mockAnalyser.goSrcPath != expectedGoSrcPath:
 		t.Errorf("goSrcPath have: %q want: %q", mockAnalyser.goSrcPath, expectedGoSrcPath)
 	}
+
+	// The private repository was cloned with the installation's token.
+	var hasToken bool
+	for _, env := range mockAnalyser.env {
+		hasToken = hasToken || strings.HasSuffix(env, "=secret")
+	}
+	if !hasToken {
+		t.Errorf("git env have: %v, want installation token", mockAnalyser.env)
+	}
 }
 
 func TestPullRequestEvent_noInstall(t *testing.T) {
@@ -424,14 +647,47 @@ func TestAnalyse_disabled(t *testing.T) {
 
 	const installationID = 2
 
-	// Added but not enabled
+	var status struct {
+		State       string `json:"state"`
+		Description string `json:"description"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/status-url":
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case "/installations/2/access_tokens":
+			fmt.Fprintln(w, "{}")
+		default:
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	// Added but not enabled, so awaiting approval
 	_ = memDB.AddGHInstallation(installationID, 3, 4)
 
-	cfg := AnalyseConfig{installationID: installationID}
+	cfg := AnalyseConfig{installationID: installationID, statusesURL: ts.URL + "/status-url"}
 
-	err := g.Analyse(cfg)
-	if want := errors.New("could not find installation with ID 2"); err.Error() != want.Error() {
-		t.Errorf("expected error %q have %q", want, err)
+	if err := g.Analyse(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.State != string(StatusStatePending) || status.Description != awaitingApprovalDesc {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	// Denied installations are ignored
+	status.State, status.Description = "", ""
+	_ = memDB.DenyGHInstallation(installationID)
+
+	if err := g.Analyse(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.State != "" {
+		t.Errorf("unexpected status for denied installation: %+v", status)
 	}
 }
 
@@ -491,3 +747,63 @@ func TestStatusDesc(t *testing.T) {
 		}
 	}
 }
+
+func TestUserID(t *testing.T) {
+	g, _, _ := setup(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user" || r.Header.Get("Authorization") != "token abc" {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintln(w, `{"id": 5}`)
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	userID, err := g.UserID(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if userID != 5 {
+		t.Errorf("userID have: %v want: 5", userID)
+	}
+
+	if _, err := g.UserID(context.Background(), "bad"); err == nil {
+		t.Error("expected error for bad token, got nil")
+	}
+}
+
+func TestOrgAdmin(t *testing.T) {
+	g, _, _ := setup(t)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user/memberships/orgs" || r.Header.Get("Authorization") != "token abc" {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("page") != "2" {
+			w.Header().Set("Link", fmt.Sprintf(`<%v/user/memberships/orgs?page=2>; rel="next"`, ts.URL))
+			fmt.Fprintln(w, `[{"role": "member", "organization": {"id": 10}}]`)
+			return
+		}
+		fmt.Fprintln(w, `[{"role": "admin", "organization": {"id": 20}}]`)
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	for orgID, want := range map[int]bool{10: false, 20: true, 30: false} {
+		admin, err := g.OrgAdmin(context.Background(), "abc", orgID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if admin != want {
+			t.Errorf("orgID %v admin have: %v want: %v", orgID, admin, want)
+		}
+	}
+
+	if _, err := g.OrgAdmin(context.Background(), "bad", 10); err == nil {
+		t.Error("expected error for bad token, got nil")
+	}
+}
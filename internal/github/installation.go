@@ -9,7 +9,10 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
 
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
@@ -19,8 +22,12 @@ import (
 // GitHub installation, and therefore performance operations as that
 // installation.
 type Installation struct {
-	ID     int
-	client *github.Client
+	ID           int
+	goVersion    string // goVersion is the installation's default Go version, if not empty
+	singleReview bool   // singleReview submits issues as a single review, see WriteReview
+	forkApproval bool   // forkApproval requires approval to analyse forks, see ForkApproved
+	client       *github.Client
+	transport    *ghinstallation.Transport // transport authenticates client, see Token
 }
 
 func (g *GitHub) NewInstallation(installationID int) (*Installation, error) {
@@ -37,7 +44,12 @@ func (g *GitHub) NewInstallation(installationID int) (*Installation, error) {
 		log.Printf("ignoring disabled installation: %+v", installation)
 		return nil, nil
 	}
+	return g.newInstallation(installation)
+}
 
+// newInstallation returns an Installation for installation, regardless of
+// whether it's enabled.
+func (g *GitHub) newInstallation(installation *db.GHInstallation) (*Installation, error) {
 	itr, err := g.newInstallationTransport(installation.InstallationID)
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("could not initialise transport for installation id %v", installation.InstallationID))
@@ -49,7 +61,25 @@ func (g *GitHub) NewInstallation(installationID int) (*Installation, error) {
 		return nil, err
 	}
 
-	return &Installation{ID: installation.ID, client: client}, nil
+	return &Installation{
+		ID:           installation.ID,
+		goVersion:    installation.GoVersion,
+		singleReview: installation.SingleReview,
+		forkApproval: installation.ForkApproval,
+		client:       client,
+		transport:    itr,
+	}, nil
+}
+
+// Token returns an installation access token, which grants access to the
+// installation's repositories, such as to clone private repositories. The
+// token must not be logged or stored.
+func (i *Installation) Token() (string, error) {
+	token, err := i.transport.Token()
+	if err != nil {
+		return "", errors.Wrap(err, "could not get installation access token")
+	}
+	return token, nil
 }
 
 // StatusState is the state of a GitHub Status API as defined in
@@ -101,51 +131,188 @@ func (i *Installation) SetStatus(ctx context.Context, context, statusURL string,
 // writeissues is called multiple times, such is multiple syncronise events.
 const maxIssueComments = 10
 
+// maxReviewComments is the maximum number of comments that will be written
+// in a single review by WriteReview. As a review only sends one notification,
+// it's much higher than maxIssueComments.
+const maxReviewComments = 50
+
 // FilterIssues deduplicates issues by checking the existing pull request for
 // existing comments and returns comments that don't already exist.
 // Additionally, only a maximum amount of issues will be returned, the number
 // of total suppressed comments is returned.
 func (i *Installation) FilterIssues(ctx context.Context, owner, repo string, prNumber int, issues []db.Issue) (suppressed int, filtered []db.Issue, err error) {
+	issues, err = i.dedupeIssues(ctx, owner, repo, prNumber, issues)
+	if err != nil {
+		return 0, nil, err
+	}
+	// Of the de-duplicated issues, only return maxIssuesComments
+	if len(issues) > maxIssueComments {
+		return len(issues) - maxIssueComments, issues[:maxIssueComments], nil
+	}
+	return 0, issues, nil
+}
+
+// dedupeIssues returns the issues which have not already been commented on in
+// the pull request.
+func (i *Installation) dedupeIssues(ctx context.Context, owner, repo string, prNumber int, issues []db.Issue) ([]db.Issue, error) {
 	ecomments, _, err := i.client.PullRequests.ListComments(ctx, owner, repo, prNumber, nil)
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "could not list existing comments")
+		return nil, errors.Wrap(err, "could not list existing comments")
 	}
-	// remove duplicate comments, as we're remove elements based on the index
-	// start from last position and work backwards to keep indexes consistent
-	// even after removing elements.
-	for i := len(issues) - 1; i >= 0; i-- {
-		issue := issues[i]
+	var deduped []db.Issue
+issues:
+	for _, issue := range issues {
 		for _, ec := range ecomments {
-			if issue.Path == *ec.Path && issue.HunkPos == *ec.Position && issue.Issue == *ec.Body {
-				issues = append(issues[:i], issues[i+1:]...)
-				break
+			if isDuplicateComment(issue, ec) {
+				continue issues
 			}
 		}
+		deduped = append(deduped, issue)
 	}
-	// Of the de-duplicated issues, only return maxIssuesComments
-	if len(issues) > maxIssueComments {
-		return len(issues) - maxIssueComments, issues[:maxIssueComments], nil
+	return deduped, nil
+}
+
+// fingerprintRegexp matches the fingerprint marker added to the body of each
+// comment, the first submatch is the fingerprint.
+var fingerprintRegexp = regexp.MustCompile(`\n*<!-- gopherci:fingerprint ([0-9a-f]+) -->`)
+
+// commentBody returns the body of the comment for an issue, which includes a
+// hidden marker with the issue's fingerprint, if it has one.
+func commentBody(issue db.Issue) string {
+	if issue.Fingerprint == "" {
+		return issue.Issue
 	}
-	return 0, issues, nil
+	return fmt.Sprintf("%s\n\n<!-- gopherci:fingerprint %s -->", issue.Issue, issue.Fingerprint)
+}
+
+// isDuplicateComment returns true if the existing comment ec was written for
+// the issue. If both have a fingerprint, the fingerprints are compared, so
+// the issue is not commented on again when its line moves. Otherwise, the
+// comment's position and body must match the issue's.
+func isDuplicateComment(issue db.Issue, ec *github.PullRequestComment) bool {
+	body := ec.GetBody()
+	if m := fingerprintRegexp.FindStringSubmatch(body); m != nil {
+		if issue.Fingerprint != "" {
+			return issue.Fingerprint == m[1]
+		}
+		body = fingerprintRegexp.ReplaceAllString(body, "")
+	}
+	return issue.Path == ec.GetPath() && issue.HunkPos == ec.GetPosition() && issue.Issue == body
 }
 
 // WriteIssues takes a slice of issues and creates a pull request comment for
 // each issue on a given owner, repo, pr and commit hash. Returns on the first
-// error encountered.
-func (i *Installation) WriteIssues(ctx context.Context, owner, repo string, prNumber int, commit string, issues []db.Issue) error {
+// error encountered. The comments written for issues with a fingerprint are
+// returned, including those written before an error.
+func (i *Installation) WriteIssues(ctx context.Context, owner, repo string, prNumber int, commit string, issues []db.Issue) ([]db.IssueComment, error) {
+	var written []db.IssueComment
 	for _, issue := range issues {
 		comment := &github.PullRequestComment{
-			Body:     github.String(issue.Issue),
+			Body:     github.String(commentBody(issue)),
 			CommitID: github.String(commit),
 			Path:     github.String(issue.Path),
 			Position: github.Int(issue.HunkPos),
 		}
-		_, _, err := i.client.PullRequests.CreateComment(ctx, owner, repo, prNumber, comment)
+		created, _, err := i.client.PullRequests.CreateComment(ctx, owner, repo, prNumber, comment)
 		if err != nil {
-			return errors.Wrap(err, "could not post comment")
+			return written, errors.Wrap(err, "could not post comment")
+		}
+		if issue.Fingerprint != "" {
+			written = append(written, db.IssueComment{CommentID: created.GetID(), Fingerprint: issue.Fingerprint, Issue: issue.Issue})
 		}
 	}
-	return nil
+	return written, nil
+}
+
+// WriteReview submits the issues which have not already been commented on as
+// a single pull request review on a given owner, repo, pr and commit hash,
+// with each issue as a comment in the review. Only maxReviewComments issues
+// are commented on, the remaining issues are listed in the review's body,
+// which links to the analysis at analysisURL. No review is submitted if there
+// are no new issues. Returns the number of issues not commented on, and the
+// comments written for issues with a fingerprint.
+func (i *Installation) WriteReview(ctx context.Context, owner, repo string, prNumber int, commit, analysisURL string, issues []db.Issue) (suppressed int, written []db.IssueComment, err error) {
+	issues, err = i.dedupeIssues(ctx, owner, repo, prNumber, issues)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(issues) == 0 {
+		return 0, nil, nil
+	}
+
+	var comments, remaining = issues, []db.Issue(nil)
+	if len(issues) > maxReviewComments {
+		comments, remaining = issues[:maxReviewComments], issues[maxReviewComments:]
+	}
+
+	// The vendored go-github's PullRequestReviewRequest has no commit_id, which
+	// is required for the comments' positions to refer to the analysed commit.
+	review := struct {
+		github.PullRequestReviewRequest
+		CommitID string `json:"commit_id"`
+	}{
+		PullRequestReviewRequest: github.PullRequestReviewRequest{
+			Body:  github.String(reviewBody(len(issues), analysisURL, remaining)),
+			Event: github.String("COMMENT"),
+		},
+		CommitID: commit,
+	}
+	for _, issue := range comments {
+		review.Comments = append(review.Comments, &github.DraftReviewComment{
+			Body:     github.String(commentBody(issue)),
+			Path:     github.String(issue.Path),
+			Position: github.Int(issue.HunkPos),
+		})
+	}
+
+	req, err := i.client.NewRequest("POST", fmt.Sprintf("repos/%v/%v/pulls/%d/reviews", owner, repo, prNumber), &review)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "could not create review request")
+	}
+	var submitted github.PullRequestReview
+	if _, err := i.client.Do(ctx, req, &submitted); err != nil {
+		return 0, nil, errors.Wrap(err, "could not submit review")
+	}
+
+	// The review's response doesn't include its comments, so find the
+	// comments' IDs by their fingerprint.
+	rcomments, _, err := i.client.PullRequests.ListReviewComments(ctx, owner, repo, prNumber, submitted.GetID(), &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return len(remaining), nil, errors.Wrap(err, "could not list review comments")
+	}
+	for _, rc := range rcomments {
+		m := fingerprintRegexp.FindStringSubmatch(rc.GetBody())
+		if m == nil {
+			continue
+		}
+		for _, issue := range comments {
+			if issue.Fingerprint == m[1] {
+				written = append(written, db.IssueComment{CommentID: rc.GetID(), Fingerprint: issue.Fingerprint, Issue: issue.Issue})
+				break
+			}
+		}
+	}
+	return len(remaining), written, nil
+}
+
+// reviewBody returns the body of a review for a number of new issues, listing
+// the remaining issues which were not commented on.
+func reviewBody(issues int, analysisURL string, remaining []db.Issue) string {
+	var body bytes.Buffer
+	if issues == 1 {
+		fmt.Fprint(&body, "GopherCI found 1 new issue")
+	} else {
+		fmt.Fprintf(&body, "GopherCI found %d new issues", issues)
+	}
+	fmt.Fprintf(&body, ", see the [analysis](%s) for details.\n", analysisURL)
+	if len(remaining) == 0 {
+		return body.String()
+	}
+	fmt.Fprintf(&body, "\nThe following %d issues were not commented on:\n\n", len(remaining))
+	for _, issue := range remaining {
+		fmt.Fprintf(&body, "- `%s:%d`: %s\n", issue.Path, issue.Line, issue.Issue)
+	}
+	return body.String()
 }
 
 // Diff implements the web.VCSReader interface.
@@ -180,3 +347,48 @@ func (i *Installation) Diff(ctx context.Context, repositoryID int, commitFrom, c
 	}
 	return resp.Body, nil
 }
+
+// GoVersion returns the version of Go required by a repository at ref, read
+// from the repository's analyser.RepoConfigFile or else the go directive in
+// its go.mod, otherwise the installation's default. Returns an empty string if
+// no version is specified. If a file could not be read or parsed, the next
+// source is used, and the first error is returned with the version found.
+func (i *Installation) GoVersion(ctx context.Context, owner, repo, ref string) (string, error) {
+	contents, cfgErr := i.readFile(ctx, owner, repo, ref, analyser.RepoConfigFile)
+	if cfgErr == nil && contents != nil {
+		var cfg analyser.RepoConfig
+		cfg, cfgErr = analyser.ParseRepoConfig(contents)
+		if cfgErr == nil && cfg.GoVersion != "" {
+			return cfg.GoVersion, nil
+		}
+	}
+
+	contents, modErr := i.readFile(ctx, owner, repo, ref, "go.mod")
+	if version := analyser.GoModVersion(contents); version != "" {
+		return version, cfgErr
+	}
+
+	if cfgErr == nil {
+		cfgErr = modErr
+	}
+	return i.goVersion, cfgErr
+}
+
+// readFile returns the contents of the file at path in a repository at ref,
+// or nil if the file does not exist.
+func (i *Installation) readFile(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	file, _, resp, err := i.client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "could not get contents of %v", path)
+	case file == nil:
+		return nil, nil // path is a directory
+	}
+	contents, err := file.GetContent()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decode contents of %v", path)
+	}
+	return []byte(contents), nil
+}
@@ -102,6 +102,63 @@ func TestFilterIssues_deduplicate(t *testing.T) {
 	}
 }
 
+func TestFilterIssues_fingerprint(t *testing.T) {
+	var (
+		expectedOwner = "owner"
+		expectedRepo  = "repo"
+		expectedPR    = 2
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case fmt.Sprintf("/repos/%v/%v/pulls/%v/comments", expectedOwner, expectedRepo, expectedPR):
+			comments := []*github.PullRequestComment{
+				{
+					// Line has since moved
+					Body:     github.String("moved\n\n<!-- gopherci:fingerprint abc -->"),
+					Path:     github.String("path.go"),
+					Position: github.Int(1),
+				},
+				{
+					// Same position and body, but different code
+					Body:     github.String("changed\n\n<!-- gopherci:fingerprint def -->"),
+					Path:     github.String("path.go"),
+					Position: github.Int(5),
+				},
+				{
+					// Written before fingerprints
+					Body:     github.String("old"),
+					Path:     github.String("path.go"),
+					Position: github.Int(9),
+				},
+			}
+			json, _ := json.Marshal(comments)
+			fmt.Fprint(w, string(json))
+		}
+	}))
+	defer ts.Close()
+
+	i := Installation{client: github.NewClient(nil)}
+	i.client.BaseURL, _ = url.Parse(ts.URL)
+
+	var issues = []db.Issue{
+		{Path: "path.go", HunkPos: 3, Issue: "moved", Fingerprint: "abc"},   // remove
+		{Path: "path.go", HunkPos: 5, Issue: "changed", Fingerprint: "123"}, // keep
+		{Path: "path.go", HunkPos: 9, Issue: "old", Fingerprint: "456"},     // remove
+		{Path: "path.go", HunkPos: 5, Issue: "changed"},                     // remove
+	}
+
+	_, filtered, err := i.FilterIssues(context.Background(), expectedOwner, expectedRepo, expectedPR, issues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []db.Issue{{Path: "path.go", HunkPos: 5, Issue: "changed", Fingerprint: "123"}}
+	if !reflect.DeepEqual(filtered, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", filtered, want)
+	}
+}
+
 func TestWriteIssues(t *testing.T) {
 	var (
 		expectedOwner   = "owner"
@@ -131,6 +188,7 @@ func TestWriteIssues(t *testing.T) {
 			if !reflect.DeepEqual(expected, comment) {
 				t.Fatalf("expected cmt:\n%#v\ngot:\n%#v", expected, comment)
 			}
+			fmt.Fprintln(w, `{"id": 10}`)
 		default:
 			t.Logf(r.RequestURI)
 		}
@@ -142,10 +200,117 @@ func TestWriteIssues(t *testing.T) {
 
 	var issues = []db.Issue{{Path: expectedCmtPath, HunkPos: expectedCmtPos, Issue: expectedCmtBody}}
 
-	err := i.WriteIssues(context.Background(), expectedOwner, expectedRepo, expectedPR, expectedCmtSHA, issues)
+	written, err := i.WriteIssues(context.Background(), expectedOwner, expectedRepo, expectedPR, expectedCmtSHA, issues)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	// Issues without a fingerprint can't be tracked.
+	if len(written) != 0 {
+		t.Errorf("unexpected written comments: %+v", written)
+	}
+}
+
+func TestWriteReview(t *testing.T) {
+	var (
+		expectedOwner = "owner"
+		expectedRepo  = "repo"
+		expectedPR    = 2
+		expectedSHA   = "abc123"
+		reviewed      bool
+	)
+
+	// Existing comment, and more new issues than maxReviewComments.
+	issues := []db.Issue{{Path: "path.go", Line: 1, HunkPos: 1, Issue: "existing"}}
+	for n := 0; n < maxReviewComments+1; n++ {
+		issues = append(issues, db.Issue{Path: "path.go", Line: n + 2, HunkPos: n + 2, Issue: "new"})
+	}
+	issues[1].Fingerprint = "abc"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case fmt.Sprintf("/repos/%v/%v/pulls/%v/comments", expectedOwner, expectedRepo, expectedPR):
+			comments := []*github.PullRequestComment{
+				{Body: github.String("existing"), Path: github.String("path.go"), Position: github.Int(1)},
+			}
+			json.NewEncoder(w).Encode(comments)
+		case fmt.Sprintf("/repos/%v/%v/pulls/%v/reviews", expectedOwner, expectedRepo, expectedPR):
+			var review struct {
+				github.PullRequestReviewRequest
+				CommitID string `json:"commit_id"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if review.CommitID != expectedSHA {
+				t.Errorf("commit_id have: %q want: %q", review.CommitID, expectedSHA)
+			}
+			if review.GetEvent() != "COMMENT" {
+				t.Errorf("event have: %q want: %q", review.GetEvent(), "COMMENT")
+			}
+			if len(review.Comments) != maxReviewComments {
+				t.Errorf("review has %v comments want: %v", len(review.Comments), maxReviewComments)
+			}
+			if want := reviewBody(maxReviewComments+1, "analysis-url", issues[maxReviewComments+1:]); review.GetBody() != want {
+				t.Errorf("body have:\n%s\nwant:\n%s", review.GetBody(), want)
+			}
+			reviewed = true
+			fmt.Fprintln(w, `{"id": 7}`)
+		case fmt.Sprintf("/repos/%v/%v/pulls/%v/reviews/7/comments?per_page=100", expectedOwner, expectedRepo, expectedPR):
+			comments := []*github.PullRequestComment{
+				{ID: github.Int(20), Body: github.String(commentBody(issues[1]))},
+				{ID: github.Int(21), Body: github.String(commentBody(issues[2]))},
+			}
+			json.NewEncoder(w).Encode(comments)
+		default:
+			t.Logf(r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	i := Installation{client: github.NewClient(nil)}
+	i.client.BaseURL, _ = url.Parse(ts.URL + "/")
+
+	suppressed, written, err := i.WriteReview(context.Background(), expectedOwner, expectedRepo, expectedPR, expectedSHA, "analysis-url", issues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantWritten := []db.IssueComment{{CommentID: 20, Fingerprint: "abc", Issue: "new"}}
+	if !reflect.DeepEqual(written, wantWritten) {
+		t.Errorf("written\nhave: %+v\nwant: %+v", written, wantWritten)
+	}
+	if !reviewed {
+		t.Errorf("did not submit review")
+	}
+	if suppressed != 1 {
+		t.Errorf("suppressed have: %v want: %v", suppressed, 1)
+	}
+
+	// No new issues, so no review should be submitted.
+	reviewed = false
+	_, _, err = i.WriteReview(context.Background(), expectedOwner, expectedRepo, expectedPR, expectedSHA, "analysis-url", issues[:1])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reviewed {
+		t.Errorf("unexpected review without new issues")
+	}
+}
+
+func TestReviewBody(t *testing.T) {
+	tests := []struct {
+		issues    int
+		remaining []db.Issue
+		want      string
+	}{
+		{1, nil, "GopherCI found 1 new issue, see the [analysis](url) for details.\n"},
+		{3, []db.Issue{{Path: "a.go", Line: 4, Issue: "golint: issue"}}, "GopherCI found 3 new issues, see the [analysis](url) for details.\n" +
+			"\nThe following 1 issues were not commented on:\n\n- `a.go:4`: golint: issue\n"},
+	}
+	for _, test := range tests {
+		if have := reviewBody(test.issues, "url", test.remaining); have != test.want {
+			t.Errorf("have:\n%s\nwant:\n%s", have, test.want)
+		}
+	}
 }
 
 func TestInstallation_diff(t *testing.T) {
@@ -201,3 +366,54 @@ func TestInstallation_diff(t *testing.T) {
 		}
 	}
 }
+
+func TestGoVersion(t *testing.T) {
+	tests := []struct {
+		files     map[string]string // path -> contents, or "!error" if the file can't be read
+		goVersion string            // installation's default
+		want      string
+		wantErr   bool
+	}{
+		{map[string]string{".gopherci.yml": "go: 1.8", "go.mod": "go 1.12"}, "1.7", "1.8", false},
+		{map[string]string{".gopherci.yml": "ignored: [foo]", "go.mod": "go 1.12"}, "1.7", "1.12", false},
+		{map[string]string{"go.mod": "module foo"}, "1.7", "1.7", false},
+		{map[string]string{}, "", "", false},
+		{map[string]string{".gopherci.yml": "go: [", "go.mod": "go 1.12"}, "1.7", "1.12", true},
+		{map[string]string{".gopherci.yml": "!error", "go.mod": "go 1.12"}, "1.7", "1.12", true},
+		{map[string]string{".gopherci.yml": "!error", "go.mod": "!error"}, "1.7", "1.7", true},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if have, want := r.URL.Query().Get("ref"), "abcdef"; have != want {
+				t.Errorf("ref have: %q want: %q", have, want)
+			}
+			for path, contents := range test.files {
+				if r.URL.Path == "/repos/owner/repo/contents/"+path {
+					if contents == "!error" {
+						http.Error(w, `{"message": "error"}`, http.StatusInternalServerError)
+						return
+					}
+					json.NewEncoder(w).Encode(&github.RepositoryContent{
+						Type:    github.String("file"),
+						Content: github.String(contents),
+					})
+					return
+				}
+			}
+			http.NotFound(w, r)
+		}))
+
+		i := Installation{goVersion: test.goVersion, client: github.NewClient(nil)}
+		i.client.BaseURL, _ = url.Parse(ts.URL)
+
+		have, err := i.GoVersion(context.Background(), "owner", "repo", "abcdef")
+		if (err != nil) != test.wantErr {
+			t.Errorf("files: %v have error: %v want error: %v", test.files, err, test.wantErr)
+		}
+		if have != test.want {
+			t.Errorf("files: %v have: %q want: %q", test.files, have, test.want)
+		}
+		ts.Close()
+	}
+}
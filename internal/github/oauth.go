@@ -0,0 +1,107 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetOAuth sets the integration's OAuth client ID and secret, which are used
+// to sign users in to GopherCI with their GitHub account.
+func (g *GitHub) SetOAuth(clientID, clientSecret string) {
+	g.clientID, g.clientSecret = clientID, clientSecret
+}
+
+// OAuthURL returns the URL to redirect a user to, to sign in with GitHub. Once
+// the user has authorised GopherCI, GitHub redirects the user to redirectURL
+// with the code to pass to Login, and state, which must be verified.
+func (g *GitHub) OAuthURL(state, redirectURL string) string {
+	v := url.Values{
+		"client_id":    {g.clientID},
+		"redirect_uri": {redirectURL},
+		"state":        {state},
+	}
+	return g.webURL + "/login/oauth/authorize?" + v.Encode()
+}
+
+// Login exchanges the code GitHub provided, after a user authorised GopherCI,
+// for the user's OAuth token, and returns the user's ID and login. The token
+// isn't returned, as it's only used to identify the user.
+func (g *GitHub) Login(ctx context.Context, code string) (userID int, login string, err error) {
+	form := url.Values{
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"code":          {code},
+	}
+	req, err := http.NewRequest("POST", g.webURL+"/login/oauth/access_token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := (&http.Client{Transport: g.tr}).Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, "", errors.Wrap(err, "could not exchange code")
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return 0, "", errors.Wrapf(err, "could not decode access token response with status %v", resp.Status)
+	}
+	if token.AccessToken == "" {
+		return 0, "", fmt.Errorf("could not exchange code: %q", token.Error)
+	}
+
+	client, err := g.userClient(token.AccessToken)
+	if err != nil {
+		return 0, "", err
+	}
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return 0, "", errors.Wrap(err, "could not get authenticated user")
+	}
+	return user.GetID(), user.GetLogin(), nil
+}
+
+// RepositoryPermission returns the permission, "admin", "write", "read" or
+// "none", the user with login has to the repository with repositoryID, as
+// seen by the installation with the GitHub installationID.
+func (g *GitHub) RepositoryPermission(ctx context.Context, installationID, repositoryID int, login string) (string, error) {
+	install, err := g.NewInstallation(installationID)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get installation")
+	}
+	if install == nil {
+		// The installation has been removed or disabled, so can't be used to
+		// check the permission.
+		return "none", nil
+	}
+
+	repo, resp, err := install.client.Repositories.GetByID(ctx, repositoryID)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "none", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get repository %v", repositoryID)
+	}
+
+	perm, resp, err := install.client.Repositories.GetPermissionLevel(ctx, repo.Owner.GetLogin(), repo.GetName(), login)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// The user doesn't exist, or isn't a collaborator.
+		return "none", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get permission of %v", login)
+	}
+	return perm.GetPermission(), nil
+}
@@ -0,0 +1,111 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestOAuthURL(t *testing.T) {
+	g, _, _ := setup(t)
+	g.SetOAuth("client-id", "client-secret")
+
+	u, err := url.Parse(g.OAuthURL("state", "https://example.com/login/callback"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing url: %v", err)
+	}
+	if have, want := u.Host+u.Path, "github.com/login/oauth/authorize"; have != want {
+		t.Errorf("url have: %v want: %v", have, want)
+	}
+	want := url.Values{"client_id": {"client-id"}, "redirect_uri": {"https://example.com/login/callback"}, "state": {"state"}}
+	if have := u.Query(); have.Encode() != want.Encode() {
+		t.Errorf("query have: %v want: %v", have, want)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	g, _, _ := setup(t)
+	g.SetOAuth("client-id", "client-secret")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			if r.PostFormValue("client_id") != "client-id" || r.PostFormValue("client_secret") != "client-secret" {
+				t.Errorf("unexpected client credentials: %v", r.PostForm)
+			}
+			if r.PostFormValue("code") != "good" {
+				fmt.Fprintln(w, `{"error": "bad_verification_code"}`)
+				return
+			}
+			fmt.Fprintln(w, `{"access_token": "abc"}`)
+		case "/user":
+			if r.Header.Get("Authorization") != "token abc" {
+				http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintln(w, `{"id": 10, "login": "user"}`)
+		default:
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL, g.webURL = ts.URL, ts.URL
+
+	userID, login, err := g.Login(context.Background(), "good")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if userID != 10 || login != "user" {
+		t.Errorf("have userID: %v login: %q want userID: 10 login: %q", userID, login, "user")
+	}
+
+	if _, _, err := g.Login(context.Background(), "bad"); err == nil {
+		t.Error("expected error for bad code, got nil")
+	}
+}
+
+func TestRepositoryPermission(t *testing.T) {
+	g, _, memDB := setup(t)
+	_ = memDB.AddGHInstallation(2, 3, 4)
+	memDB.EnableGHInstallation(2)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/installations/2/access_tokens":
+			fmt.Fprintln(w, "{}")
+		case "/repositories/100":
+			fmt.Fprintln(w, `{"id": 100, "name": "repo", "owner": {"login": "owner"}}`)
+		case "/repos/owner/repo/collaborators/writer/permission":
+			fmt.Fprintln(w, `{"permission": "write"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	tests := []struct {
+		installationID int
+		repositoryID   int
+		login          string
+		want           string
+	}{
+		{2, 100, "writer", "write"},
+		{2, 100, "stranger", "none"}, // not a collaborator
+		{2, 101, "writer", "none"},   // repository not accessible by the installation
+		{5, 100, "writer", "none"},   // unknown installation
+	}
+	for _, test := range tests {
+		have, err := g.RepositoryPermission(context.Background(), test.installationID, test.repositoryID, test.login)
+		if err != nil {
+			t.Errorf("%+v unexpected error: %v", test, err)
+		}
+		if have != test.want {
+			t.Errorf("%+v have permission: %q want: %q", test, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package github
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// newRepository returns the record of repo, covered by the installation with
+// the ID ghInstallationID (not the GitHub installation ID). The repositories
+// in installation events only contain the full name, not the owner.
+func newRepository(ghInstallationID int, repo *github.Repository) db.Repository {
+	r := db.Repository{
+		ID:             repo.GetID(),
+		InstallationID: ghInstallationID,
+		Owner:          repo.Owner.GetLogin(),
+		Name:           repo.GetName(),
+		Private:        repo.GetPrivate(),
+	}
+	if parts := strings.SplitN(repo.GetFullName(), "/", 2); len(parts) == 2 {
+		r.Owner, r.Name = parts[0], parts[1]
+	}
+	return r
+}
+
+// ghInstallationID returns the ID (not the GitHub installation ID) of the
+// installation with the GitHub installation ID installationID, 0 if the
+// installation has not been recorded.
+func (g *GitHub) ghInstallationID(installationID int) (int, error) {
+	install, err := g.db.GetGHInstallation(installationID)
+	if err != nil || install == nil {
+		return 0, err
+	}
+	return install.ID, nil
+}
+
+// installationCreatedEvent records the repositories an installation covers
+// when it's created. The event's repositories aren't parsed by go-github, so
+// they're read from the payload.
+func (g *GitHub) installationCreatedEvent(e *github.IntegrationInstallationEvent, payload []byte) error {
+	var created struct {
+		Repositories []*github.Repository `json:"repositories"`
+	}
+	if err := json.Unmarshal(payload, &created); err != nil {
+		return errors.Wrap(err, "could not unmarshal installation repositories")
+	}
+	return g.setRepositories(*e.Installation.ID, created.Repositories)
+}
+
+// installationRepositoriesEvent records the repositories added to, or
+// removed from, an installation.
+func (g *GitHub) installationRepositoriesEvent(e *github.InstallationRepositoriesEvent) error {
+	if err := g.setRepositories(*e.Installation.ID, e.RepositoriesAdded); err != nil {
+		return err
+	}
+
+	id, err := g.ghInstallationID(*e.Installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "could not get installation")
+	}
+	for _, repo := range e.RepositoriesRemoved {
+		if err := g.db.RemoveRepository(id, repo.GetID()); err != nil {
+			return errors.Wrapf(err, "could not remove repository %v", repo.GetFullName())
+		}
+	}
+	return nil
+}
+
+// setRepositories records repos as covered by the installation with the
+// GitHub installation ID installationID.
+func (g *GitHub) setRepositories(installationID int, repos []*github.Repository) error {
+	id, err := g.ghInstallationID(installationID)
+	if err != nil {
+		return errors.Wrap(err, "could not get installation")
+	}
+	for _, repo := range repos {
+		if err := g.db.SetRepository(newRepository(id, repo)); err != nil {
+			return errors.Wrapf(err, "could not set repository %v", repo.GetFullName())
+		}
+	}
+	return nil
+}
+
+// repositoryEvent records the renaming, transfer and changes in visibility of
+// a repository. When a repository is deleted, all its data is removed.
+func (g *GitHub) repositoryEvent(e *github.RepositoryEvent) error {
+	if e.GetAction() == "deleted" {
+		return errors.Wrap(g.db.PurgeRepository(e.Repo.GetID()), "could not purge repository")
+	}
+
+	id, err := g.ghInstallationID(e.Installation.GetID())
+	if err != nil {
+		return errors.Wrap(err, "could not get installation")
+	}
+	return errors.Wrap(g.db.SetRepository(newRepository(id, e.Repo)), "could not set repository")
+}
@@ -0,0 +1,133 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+)
+
+func TestNewRepository(t *testing.T) {
+	tests := []struct {
+		repo *github.Repository
+		want db.Repository
+	}{
+		{
+			&github.Repository{ID: github.Int(100), Owner: &github.User{Login: github.String("owner")}, Name: github.String("repo"), Private: github.Bool(true)},
+			db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo", Private: true},
+		},
+		{
+			// Installation events only contain the full name.
+			&github.Repository{ID: github.Int(100), Name: github.String("repo"), FullName: github.String("owner/repo")},
+			db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo"},
+		},
+	}
+	for _, test := range tests {
+		if have := newRepository(1, test.repo); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("\nhave: %+v\nwant: %+v", have, test.want)
+		}
+	}
+}
+
+func TestInstallationRepositoriesEvent(t *testing.T) {
+	g, _, memDB := setup(t)
+	memDB.AddGHInstallation(2, 3, 4)
+
+	created := &github.IntegrationInstallationEvent{Installation: &github.Installation{ID: github.Int(2)}}
+	payload := []byte(`{"repositories":[{"id":100,"name":"repo","full_name":"owner/repo","private":true}]}`)
+	if err := g.installationCreatedEvent(created, payload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &db.Repository{ID: 100, InstallationID: 2, Owner: "owner", Name: "repo", Private: true}
+	if have, _ := memDB.GetRepository(100); !reflect.DeepEqual(have, want) {
+		t.Errorf("created\nhave: %+v\nwant: %+v", have, want)
+	}
+
+	event := &github.InstallationRepositoriesEvent{
+		Action:              github.String("added"),
+		Installation:        &github.Installation{ID: github.Int(2)},
+		RepositoriesAdded:   []*github.Repository{{ID: github.Int(101), Name: github.String("other"), FullName: github.String("owner/other")}},
+		RepositoriesRemoved: []*github.Repository{{ID: github.Int(100), Name: github.String("repo"), FullName: github.String("owner/repo")}},
+	}
+	if err := g.installationRepositoriesEvent(event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = &db.Repository{ID: 101, InstallationID: 2, Owner: "owner", Name: "other"}
+	if have, _ := memDB.GetRepository(101); !reflect.DeepEqual(have, want) {
+		t.Errorf("added\nhave: %+v\nwant: %+v", have, want)
+	}
+	// Removed repositories are still known, but not covered by the installation.
+	want = &db.Repository{ID: 100, Owner: "owner", Name: "repo", Private: true}
+	if have, _ := memDB.GetRepository(100); !reflect.DeepEqual(have, want) {
+		t.Errorf("removed\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+func TestRepositoryEvent(t *testing.T) {
+	g, _, memDB := setup(t)
+	memDB.AddGHInstallation(2, 3, 4)
+	memDB.SetRepository(db.Repository{ID: 100, InstallationID: 2, Owner: "owner", Name: "repo"})
+	memDB.Schedules = []db.Schedule{
+		{ID: 1, InstallationID: 2, Owner: "owner", Repo: "repo"},
+		{ID: 2, InstallationID: 7, Owner: "owner", Repo: "repo"}, // another installation's
+	}
+	memDB.Suppressions = []db.Suppression{{RepositoryID: 100}, {RepositoryID: 101}}
+	memDB.Deliveries = []db.WebhookDelivery{{ID: 1, RepositoryID: 100}, {ID: 2, RepositoryID: 101}}
+	analysis := db.NewAnalysis()
+	analysis.ID, analysis.InstallationID, analysis.RepositoryID = 5, 2, 100
+	memDB.Analyses = map[int]*db.Analysis{analysis.ID: analysis}
+
+	event := func(action, owner, name string, private bool) *github.RepositoryEvent {
+		return &github.RepositoryEvent{
+			Action: github.String(action),
+			Repo: &github.Repository{
+				ID:       github.Int(100),
+				Owner:    &github.User{Login: github.String(owner)},
+				Name:     github.String(name),
+				FullName: github.String(owner + "/" + name),
+				Private:  github.Bool(private),
+			},
+			Installation: &github.Installation{ID: github.Int(2)},
+		}
+	}
+
+	// Renamed repositories update their schedules.
+	if err := g.repositoryEvent(event("renamed", "owner", "renamed", false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have := memDB.Schedules[0]; have.Owner != "owner" || have.Repo != "renamed" {
+		t.Errorf("unexpected schedule after rename: %+v", have)
+	}
+	if have := memDB.Schedules[1]; have.Owner != "owner" || have.Repo != "repo" {
+		t.Errorf("unexpected other installation's schedule after rename: %+v", have)
+	}
+
+	if err := g.repositoryEvent(event("privatized", "owner", "renamed", true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &db.Repository{ID: 100, InstallationID: 2, Owner: "owner", Name: "renamed", Private: true}
+	if have, _ := memDB.GetRepository(100); !reflect.DeepEqual(have, want) {
+		t.Errorf("privatized\nhave: %+v\nwant: %+v", have, want)
+	}
+
+	// Deleted repositories have all their data removed.
+	if err := g.repositoryEvent(event("deleted", "owner", "renamed", true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, _ := memDB.GetRepository(100); have != nil {
+		t.Errorf("have repository: %+v want: nil", have)
+	}
+	if have, _ := memDB.GetAnalysis(analysis.ID); have != nil {
+		t.Errorf("have analysis: %+v want: nil", have)
+	}
+	if len(memDB.Deliveries) != 1 || memDB.Deliveries[0].ID != 2 {
+		t.Errorf("have deliveries: %+v want: other repository's only", memDB.Deliveries)
+	}
+	if len(memDB.Schedules) != 1 || memDB.Schedules[0].ID != 2 {
+		t.Errorf("have schedules: %+v want: other installation's only", memDB.Schedules)
+	}
+	if want := []db.Suppression{{RepositoryID: 101}}; !reflect.DeepEqual(memDB.Suppressions, want) {
+		t.Errorf("have suppressions: %+v want: %+v", memDB.Suppressions, want)
+	}
+}
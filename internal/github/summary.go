@@ -0,0 +1,113 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// writeSummary creates or updates the pull request's summary comment for the
+// analysis, previous is the previous analysis of the pull request, if any.
+// Errors are logged, as they should not fail the analysis.
+func (g *GitHub) writeSummary(ctx context.Context, install *Installation, cfg AnalyseConfig, tools []db.Tool, analysis, previous *db.Analysis, analysisURL string) {
+	commentID, err := g.db.GetSummaryComment(cfg.repositoryID, cfg.pr)
+	if err != nil {
+		log.Printf("could not get summary comment for %v/%v#%v: %v", cfg.owner, cfg.repo, cfg.pr, err)
+		return
+	}
+
+	body := summaryBody(cfg.sha, tools, analysis, previous, analysisURL)
+	newID, err := install.WriteSummary(ctx, cfg.owner, cfg.repo, cfg.pr, commentID, body)
+	if err != nil {
+		log.Printf("could not write summary comment for %v/%v#%v: %v", cfg.owner, cfg.repo, cfg.pr, err)
+		return
+	}
+	if newID == commentID {
+		return
+	}
+	if err := g.db.SetSummaryComment(install.ID, cfg.repositoryID, cfg.pr, newID); err != nil {
+		log.Printf("could not set summary comment for %v/%v#%v: %v", cfg.owner, cfg.repo, cfg.pr, err)
+	}
+}
+
+// WriteSummary edits the pull request's summary comment with commentID to
+// body, or if commentID is 0 or the comment has been deleted, creates a new
+// summary comment. Returns the ID of the summary comment.
+func (i *Installation) WriteSummary(ctx context.Context, owner, repo string, prNumber, commentID int, body string) (int, error) {
+	comment := &github.IssueComment{Body: github.String(body)}
+	if commentID != 0 {
+		_, resp, err := i.client.Issues.EditComment(ctx, owner, repo, commentID, comment)
+		switch {
+		case resp != nil && resp.StatusCode == http.StatusNotFound:
+			log.Printf("summary comment %v has been deleted, creating a new comment", commentID)
+		case err != nil:
+			return 0, errors.Wrapf(err, "could not edit comment %v", commentID)
+		default:
+			return commentID, nil
+		}
+	}
+
+	comment, _, err := i.client.Issues.CreateComment(ctx, owner, repo, prNumber, comment)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not create comment")
+	}
+	return comment.GetID(), nil
+}
+
+// summaryBody returns the body of a pull request's summary comment for an
+// analysis of commit, previous is the previous analysis of the pull request,
+// if any.
+func summaryBody(commit string, tools []db.Tool, analysis, previous *db.Analysis, analysisURL string) string {
+	var (
+		issues      = analysis.Issues()
+		newIssues   int
+		fixedIssues int
+	)
+	for _, issue := range issues {
+		if issue.State == db.IssueStateNew {
+			newIssues++
+		}
+	}
+	if previous != nil {
+		fixedIssues = len(analysis.FixedIssues(previous))
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "**GopherCI** analysed %s in %v and found %s", commit, roundDuration(analysis.TotalDuration), pluralIssues(len(issues)))
+	if previous != nil {
+		fmt.Fprintf(&body, ", %d new and %d fixed since the previous analysis", newIssues, fixedIssues)
+	}
+	fmt.Fprintf(&body, ". See the [analysis](%s) for details.\n\n", analysisURL)
+
+	fmt.Fprintln(&body, "| Tool | Status | Issues | Duration |")
+	fmt.Fprintln(&body, "| ---- | ------ | -----: | -------: |")
+	for _, tool := range tools {
+		result, ok := analysis.Tools[tool.ID]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&body, "| %s | %s | %d | %v |\n", tool.Name, result.Status, len(result.Issues), roundDuration(result.Duration))
+	}
+	return body.String()
+}
+
+// pluralIssues returns the number of issues and the correctly pluralised
+// noun, such as "1 issue".
+func pluralIssues(n int) string {
+	if n == 1 {
+		return "1 issue"
+	}
+	return fmt.Sprintf("%d issues", n)
+}
+
+// roundDuration rounds d to the nearest 100 milliseconds, for display.
+func roundDuration(d db.Duration) time.Duration {
+	return time.Duration(d).Round(100 * time.Millisecond)
+}
@@ -0,0 +1,95 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+)
+
+func TestSummaryBody(t *testing.T) {
+	tools := []db.Tool{{ID: 1, Name: "golint"}, {ID: 2, Name: "vet"}, {ID: 3, Name: "unused"}}
+	analysis := &db.Analysis{
+		TotalDuration: db.Duration(62340 * time.Millisecond),
+		Tools: map[db.ToolID]db.AnalysisTool{
+			1: {Status: db.AnalysisToolStatusSuccess, Duration: db.Duration(1234 * time.Millisecond), Issues: []db.Issue{
+				{Fingerprint: "a", State: db.IssueStateExisting},
+				{Fingerprint: "b", State: db.IssueStateNew},
+			}},
+			2: {Status: db.AnalysisToolStatusTimeout, Duration: db.Duration(30 * time.Second)},
+		},
+	}
+	previous := &db.Analysis{Tools: map[db.ToolID]db.AnalysisTool{
+		1: {Issues: []db.Issue{{Fingerprint: "a"}, {Fingerprint: "c"}}},
+	}}
+
+	want := "**GopherCI** analysed abc123 in 1m2.3s and found 2 issues, 1 new and 1 fixed since the previous analysis. See the [analysis](url) for details.\n\n" +
+		"| Tool | Status | Issues | Duration |\n" +
+		"| ---- | ------ | -----: | -------: |\n" +
+		"| golint | Success | 2 | 1.2s |\n" +
+		"| vet | Timeout | 0 | 30s |\n"
+	if have := summaryBody("abc123", tools, analysis, previous, "url"); have != want {
+		t.Errorf("have:\n%s\nwant:\n%s", have, want)
+	}
+
+	// Without a previous analysis, new and fixed issues are unknown.
+	want = "**GopherCI** analysed abc123 in 1m2.3s and found 2 issues. See the [analysis](url) for details.\n\n" +
+		"| Tool | Status | Issues | Duration |\n" +
+		"| ---- | ------ | -----: | -------: |\n" +
+		"| golint | Success | 2 | 1.2s |\n" +
+		"| vet | Timeout | 0 | 30s |\n"
+	if have := summaryBody("abc123", tools, analysis, nil, "url"); have != want {
+		t.Errorf("have:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	var created, edited int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/repos/owner/repo/issues/3/comments":
+			created++
+			json.NewEncoder(w).Encode(&github.IssueComment{ID: github.Int(20)})
+		case r.Method == "PATCH" && r.URL.Path == "/repos/owner/repo/issues/comments/10":
+			edited++
+			json.NewEncoder(w).Encode(&github.IssueComment{ID: github.Int(10)})
+		case r.Method == "PATCH" && r.URL.Path == "/repos/owner/repo/issues/comments/11":
+			http.NotFound(w, r) // deleted
+		default:
+			t.Errorf("unexpected request: %v %v", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	i := Installation{client: github.NewClient(nil)}
+	i.client.BaseURL, _ = url.Parse(ts.URL + "/")
+
+	tests := []struct {
+		commentID   int
+		wantID      int
+		wantCreated int
+		wantEdited  int
+	}{
+		{0, 20, 1, 0},  // no summary
+		{10, 10, 0, 1}, // existing summary
+		{11, 20, 1, 0}, // deleted summary
+	}
+	for _, test := range tests {
+		created, edited = 0, 0
+		id, err := i.WriteSummary(context.Background(), "owner", "repo", 3, test.commentID, "body")
+		if err != nil {
+			t.Errorf("commentID %v: unexpected error: %v", test.commentID, err)
+		}
+		if id != test.wantID || created != test.wantCreated || edited != test.wantEdited {
+			t.Errorf("commentID %v: have id %v created %v edited %v, want id %v created %v edited %v",
+				test.commentID, id, created, edited, test.wantID, test.wantCreated, test.wantEdited)
+		}
+	}
+}
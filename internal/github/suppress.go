@@ -0,0 +1,119 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// ignoreCommandRegexp matches a reply to a GopherCI comment asking for the
+// issue to be ignored, such as "gopherci ignore false positive", the first
+// submatch is the optional reason.
+var ignoreCommandRegexp = regexp.MustCompile(`(?is)^\s*/?gopherci\s+ignore\b\s*(.*)$`)
+
+// isIgnoreCommand returns true if the event is a new reply to a comment,
+// asking for the issue to be ignored.
+func isIgnoreCommand(e *github.PullRequestReviewCommentEvent) bool {
+	return e.GetAction() == "created" && e.Comment != nil && e.Comment.InReplyTo != nil &&
+		ignoreCommandRegexp.MatchString(e.Comment.GetBody())
+}
+
+// IgnoreCommentEvent handles a reply to a GopherCI comment asking for the
+// issue to be ignored. The issue is suppressed in the repository if the
+// comment was recorded as written for an open issue and the user has write
+// access to the repository, and the outcome is replied to the comment.
+func (g *GitHub) IgnoreCommentEvent(e *github.PullRequestReviewCommentEvent) error {
+	if !isIgnoreCommand(e) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	install, err := g.NewInstallation(e.Installation.GetID())
+	if err != nil {
+		return errors.Wrap(err, "error getting installation")
+	}
+	if install == nil {
+		return fmt.Errorf("could not find installation with ID %v", e.Installation.GetID())
+	}
+
+	var (
+		owner = e.Repo.Owner.GetLogin()
+		repo  = e.Repo.GetName()
+		pr    = e.PullRequest.GetNumber()
+	)
+
+	// Only replies to comments written by GopherCI can ignore issues, the
+	// parent's body can't be trusted, as anyone can write a comment with a
+	// fingerprint.
+	parent, err := g.issueComment(e.Repo.GetID(), pr, *e.Comment.InReplyTo)
+	if err != nil {
+		return errors.Wrapf(err, "could not get issue comment %v", *e.Comment.InReplyTo)
+	}
+	if parent == nil {
+		// Not a comment for an open issue, written by GopherCI.
+		log.Printf("ignoring reply to comment %v which isn't an open issue comment", *e.Comment.InReplyTo)
+		return nil
+	}
+
+	perm, _, err := install.client.Repositories.GetPermissionLevel(ctx, owner, repo, e.Sender.GetLogin())
+	if err != nil {
+		return errors.Wrapf(err, "could not get permission of %v", e.Sender.GetLogin())
+	}
+	if level := perm.GetPermission(); level != "admin" && level != "write" {
+		return install.replyComment(ctx, owner, repo, pr, e.Comment, "Only users with write access to this repository can ignore issues.")
+	}
+
+	suppression := &db.Suppression{
+		InstallationID: install.ID,
+		RepositoryID:   e.Repo.GetID(),
+		Fingerprint:    parent.Fingerprint,
+		Issue:          parent.Issue,
+		Reason:         strings.TrimSpace(ignoreCommandRegexp.FindStringSubmatch(e.Comment.GetBody())[1]),
+		CreatedBy:      e.Sender.GetID(),
+	}
+	err = g.db.AddSuppression(suppression)
+	if verr, ok := err.(*db.ValidationError); ok {
+		return install.replyComment(ctx, owner, repo, pr, e.Comment, fmt.Sprintf("Could not ignore this issue, %v.", verr))
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not add suppression")
+	}
+
+	return install.replyComment(ctx, owner, repo, pr, e.Comment, fmt.Sprintf(
+		"Ignored, this issue will no longer be reported in this repository. Suppression %v can be revoked using the API.", suppression.ID,
+	))
+}
+
+// issueComment returns the open issue comment recorded with the GitHub
+// pull request comment ID commentID, or nil if there is none.
+func (g *GitHub) issueComment(repositoryID, prNumber, commentID int) (*db.IssueComment, error) {
+	comments, err := g.db.OpenIssueComments(repositoryID, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	for _, comment := range comments {
+		if comment.CommentID == commentID {
+			return &comment, nil
+		}
+	}
+	return nil, nil
+}
+
+// replyComment replies to a pull request review comment.
+func (i *Installation) replyComment(ctx context.Context, owner, repo string, prNumber int, comment *github.PullRequestComment, body string) error {
+	reply := &github.PullRequestComment{
+		Body:      github.String(body),
+		InReplyTo: comment.ID,
+	}
+	_, _, err := i.client.PullRequests.CreateComment(ctx, owner, repo, prNumber, reply)
+	return errors.Wrap(err, "could not reply to comment")
+}
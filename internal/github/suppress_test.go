@@ -0,0 +1,118 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+)
+
+func TestIsIgnoreCommand(t *testing.T) {
+	tests := []struct {
+		action    string
+		inReplyTo *int
+		body      string
+		want      bool
+	}{
+		{"created", github.Int(1), "gopherci ignore", true},
+		{"created", github.Int(1), " /GopherCI ignore false positive\nthanks", true},
+		{"edited", github.Int(1), "gopherci ignore", false},
+		{"created", nil, "gopherci ignore", false},
+		{"created", github.Int(1), "please gopherci ignore", false},
+		{"created", github.Int(1), "gopherci ignored", false},
+	}
+	for _, test := range tests {
+		e := &github.PullRequestReviewCommentEvent{
+			Action:  github.String(test.action),
+			Comment: &github.PullRequestComment{InReplyTo: test.inReplyTo, Body: github.String(test.body)},
+		}
+		if have := isIgnoreCommand(e); have != test.want {
+			t.Errorf("action: %q body: %q have: %v want: %v", test.action, test.body, have, test.want)
+		}
+	}
+}
+
+func TestIgnoreCommentEvent(t *testing.T) {
+	fingerprint := strings.Repeat("a", 40)
+
+	tests := []struct {
+		permission string
+		parent     int    // parent is the comment replied to
+		wantReply  string // wantReply is the expected reply, empty if none
+		suppressed bool
+	}{
+		{"write", 10, "Ignored", true},
+		{"read", 10, "Only users with write access", false},
+		// Comments which weren't recorded, such as comments written by users
+		// which contain a fingerprint, and comments for fixed issues are
+		// ignored.
+		{"admin", 12, "", false},
+		{"admin", 13, "", false},
+	}
+
+	for _, test := range tests {
+		g, _, memDB := setup(t)
+		var reply string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/installations/2/access_tokens":
+				fmt.Fprintln(w, "{}")
+			case "/repos/owner/repo/collaborators/user/permission":
+				fmt.Fprintf(w, `{"permission":%q}`, test.permission)
+			case "/repos/owner/repo/pulls/3/comments":
+				var comment github.PullRequestComment
+				json.NewDecoder(r.Body).Decode(&comment)
+				if comment.GetInReplyTo() != 11 {
+					t.Errorf("reply in reply to %v, want 11", comment.GetInReplyTo())
+				}
+				reply = comment.GetBody()
+			default:
+				t.Errorf("unexpected request: %v", r.URL)
+				http.NotFound(w, r)
+			}
+		}))
+		g.baseURL = ts.URL
+
+		_ = memDB.AddGHInstallation(2, 3, 4)
+		memDB.EnableGHInstallation(2)
+		_ = memDB.AddIssueComments([]db.IssueComment{
+			{InstallationID: 2, RepositoryID: 100, RequestNumber: 3, CommentID: 10, Fingerprint: fingerprint, Issue: "issue"},
+			{InstallationID: 2, RepositoryID: 100, RequestNumber: 3, CommentID: 13, Fingerprint: fingerprint, Issue: "issue", FixedAt: &time.Time{}},
+		})
+
+		e := &github.PullRequestReviewCommentEvent{
+			Action:       github.String("created"),
+			Comment:      &github.PullRequestComment{ID: github.Int(11), InReplyTo: github.Int(test.parent), Body: github.String("gopherci ignore false positive")},
+			PullRequest:  &github.PullRequest{Number: github.Int(3)},
+			Repo:         &github.Repository{ID: github.Int(100), Name: github.String("repo"), Owner: &github.User{Login: github.String("owner")}},
+			Sender:       &github.User{ID: github.Int(5), Login: github.String("user")},
+			Installation: &github.Installation{ID: github.Int(2)},
+		}
+
+		if err := g.IgnoreCommentEvent(e); err != nil {
+			t.Errorf("permission: %v unexpected error: %v", test.permission, err)
+		}
+		ts.Close()
+
+		if !strings.HasPrefix(reply, test.wantReply) || (test.wantReply == "" && reply != "") {
+			t.Errorf("permission: %v have reply: %q want: %q", test.permission, reply, test.wantReply)
+		}
+
+		suppressed, _ := memDB.SuppressedFingerprints(100)
+		if suppressed[fingerprint] != test.suppressed {
+			t.Errorf("permission: %v have suppressed: %v want: %v", test.permission, suppressed[fingerprint], test.suppressed)
+		}
+		if test.suppressed {
+			if s := memDB.Suppressions[0]; s.Reason != "false positive" || s.CreatedBy != 5 || s.Issue != "issue" || s.InstallationID != 2 {
+				t.Errorf("unexpected suppression: %+v", s)
+			}
+		}
+	}
+}
@@ -23,6 +23,9 @@ func init() {
 	// List of all types that could be added to the queue
 	gob.Register(&github.PullRequestEvent{})
 	gob.Register(&github.PushEvent{})
+	gob.Register(&github.PullRequestReviewCommentEvent{})
+	// GopherCI's own job types, such as a full scan, are registered by the
+	// package which defines them.
 }
 
 const (
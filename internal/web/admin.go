@@ -0,0 +1,438 @@
+package web
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/pressly/chi"
+)
+
+// AdminAuth returns middleware restricting access to operators, using HTTP
+// basic authentication with username and password. Requests which change
+// state must also originate from the same host, as browsers automatically
+// send basic authentication credentials with cross site requests.
+func (web *Web) AdminAuth(username, password string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+			if !ok || !userOK || !passOK {
+				w.Header().Set("WWW-Authenticate", `Basic realm="GopherCI Admin"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if r.Method != "GET" && r.Method != "HEAD" && !sameOrigin(r) {
+				http.Error(w, "Cross origin request denied", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sameOrigin returns true if the request's Origin, or Referer if there's no
+// Origin, is for the same host as the request, or if neither are set.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// adminTool is a tool and its usage, as displayed to operators.
+type adminTool struct {
+	db.Tool
+	Usage db.ToolUsage
+}
+
+// AdminToolsHandler lists all tools and their usage.
+func (web *Web) AdminToolsHandler(w http.ResponseWriter, r *http.Request) {
+	tools, err := web.db.ListAllTools()
+	if err != nil {
+		log.Printf("error listing tools: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list tools")
+		return
+	}
+
+	usage, err := web.db.ToolUsage()
+	if err != nil {
+		log.Printf("error getting tool usage: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get tool usage")
+		return
+	}
+
+	page := struct {
+		Title string
+		Tools []adminTool
+	}{Title: "Tools"}
+	for _, tool := range tools {
+		page.Tools = append(page.Tools, adminTool{Tool: tool, Usage: usage[tool.ID]})
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "admin_tools.tmpl", page); err != nil {
+		log.Println("error parsing admin tools template:", err)
+	}
+}
+
+// adminToolForm is the form to add or edit a tool, and test its regexp.
+type adminToolForm struct {
+	Title   string
+	Tool    db.Tool
+	Timeout string                 // Timeout is the tool's timeout as a duration, such as 30s.
+	Sample  string                 // Sample is output to test the regexp against.
+	Issues  []analyser.OutputIssue // Issues are the issues parsed from Sample.
+	Tested  bool                   // Tested is true if the regexp was tested.
+	Error   string
+}
+
+// adminTool returns the tool from the URL parameter toolID, if the tool does
+// not exist nil is returned and an error has already been written to w.
+func (web *Web) adminTool(w http.ResponseWriter, r *http.Request) *db.Tool {
+	toolID, err := strconv.ParseInt(chi.URLParam(r, "toolID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid tool ID")
+		return nil
+	}
+
+	tool, err := web.db.GetTool(db.ToolID(toolID))
+	if err != nil {
+		log.Printf("error getting toolID %v: %v", toolID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get tool")
+		return nil
+	}
+	if tool == nil {
+		web.errorHandler(w, r, http.StatusNotFound, "Tool not found")
+		return nil
+	}
+	return tool
+}
+
+// renderToolForm renders the form to add or edit a tool.
+func (web *Web) renderToolForm(w http.ResponseWriter, code int, form adminToolForm) {
+	form.Title = "New Tool"
+	if form.Tool.ID != 0 {
+		form.Title = "Edit " + form.Tool.Name
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(code)
+	if err := web.templates.ExecuteTemplate(w, "admin_tool.tmpl", form); err != nil {
+		log.Println("error parsing admin tool template:", err)
+	}
+}
+
+// AdminNewToolHandler displays the form to add a tool.
+func (web *Web) AdminNewToolHandler(w http.ResponseWriter, r *http.Request) {
+	web.renderToolForm(w, http.StatusOK, adminToolForm{})
+}
+
+// AdminEditToolHandler displays the form to edit a tool.
+func (web *Web) AdminEditToolHandler(w http.ResponseWriter, r *http.Request) {
+	tool := web.adminTool(w, r)
+	if tool == nil {
+		return
+	}
+	form := adminToolForm{Tool: *tool}
+	if tool.Timeout != 0 {
+		form.Timeout = tool.Timeout.String()
+	}
+	web.renderToolForm(w, http.StatusOK, form)
+}
+
+// AdminSaveToolHandler adds a tool, or updates the tool from the URL parameter
+// toolID. If the form's action is "test", the tool is not saved and instead
+// the tool's regexp is tested against the sample output.
+func (web *Web) AdminSaveToolHandler(w http.ResponseWriter, r *http.Request) {
+	var tool db.Tool
+	if chi.URLParam(r, "toolID") != "" {
+		existing := web.adminTool(w, r)
+		if existing == nil {
+			return
+		}
+		tool = *existing
+	}
+
+	form := adminToolForm{
+		Timeout: strings.TrimSpace(r.PostFormValue("timeout")),
+		Sample:  r.PostFormValue("sample"),
+	}
+	tool.Name = strings.TrimSpace(r.PostFormValue("name"))
+	tool.URL = strings.TrimSpace(r.PostFormValue("url"))
+	tool.Path = strings.TrimSpace(r.PostFormValue("path"))
+	tool.Args = strings.TrimSpace(r.PostFormValue("args"))
+	tool.Regexp = r.PostFormValue("regexp")
+	tool.Timeout = 0
+	form.Tool = tool
+
+	if form.Timeout != "" {
+		timeout, err := time.ParseDuration(form.Timeout)
+		if err != nil {
+			form.Error = "timeout must be a duration such as 30s"
+			web.renderToolForm(w, http.StatusBadRequest, form)
+			return
+		}
+		tool.Timeout = db.Duration(timeout)
+		form.Tool = tool
+	}
+
+	if r.PostFormValue("action") == "test" {
+		issues, err := analyser.ParseOutput(tool.Regexp, []byte(form.Sample))
+		if err != nil {
+			form.Error = "invalid regexp: " + err.Error()
+		}
+		form.Issues, form.Tested = issues, true
+		web.renderToolForm(w, http.StatusOK, form)
+		return
+	}
+
+	var err error
+	if tool.ID == 0 {
+		tool.Position, err = web.nextPosition()
+		if err == nil {
+			err = web.db.AddTool(&tool)
+		}
+	} else {
+		err = web.db.UpdateTool(tool)
+	}
+	if verr, ok := err.(*db.ValidationError); ok {
+		form.Error = verr.Error()
+		web.renderToolForm(w, http.StatusBadRequest, form)
+		return
+	}
+	if err != nil {
+		log.Printf("error saving tool: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not save tool")
+		return
+	}
+	http.Redirect(w, r, "/admin/tools", http.StatusSeeOther)
+}
+
+// AdminToolActionHandler performs the action from the URL parameter action
+// on the tool from the URL parameter toolID. Actions are enable and disable,
+// or up and down to move the tool one position earlier or later.
+func (web *Web) AdminToolActionHandler(w http.ResponseWriter, r *http.Request) {
+	tool := web.adminTool(w, r)
+	if tool == nil {
+		return
+	}
+
+	var err error
+	switch action := chi.URLParam(r, "action"); action {
+	case "enable", "disable":
+		tool.Disabled = action == "disable"
+		err = web.db.UpdateTool(*tool)
+	case "up", "down":
+		err = web.moveTool(tool.ID, action == "up")
+	default:
+		web.errorHandler(w, r, http.StatusNotFound, "Unknown action")
+		return
+	}
+	if err != nil {
+		log.Printf("error updating toolID %v: %v", tool.ID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not update tool")
+		return
+	}
+	http.Redirect(w, r, "/admin/tools", http.StatusSeeOther)
+}
+
+// moveTool swaps the position of the tool with toolID with the tool before
+// it if up is true, or the tool after it if up is false.
+func (web *Web) moveTool(toolID db.ToolID, up bool) error {
+	tools, err := web.db.ListAllTools()
+	if err != nil {
+		return err
+	}
+
+	toolIDs := make([]db.ToolID, len(tools))
+	for i, tool := range tools {
+		toolIDs[i] = tool.ID
+	}
+
+	for i := range toolIDs {
+		if toolIDs[i] != toolID {
+			continue
+		}
+		j := i + 1
+		if up {
+			j = i - 1
+		}
+		if j < 0 || j >= len(toolIDs) {
+			return nil // already first or last
+		}
+		toolIDs[i], toolIDs[j] = toolIDs[j], toolIDs[i]
+		break
+	}
+	return web.db.ReorderTools(toolIDs)
+}
+
+// nextPosition returns the position after all existing tools.
+func (web *Web) nextPosition() (int, error) {
+	tools, err := web.db.ListAllTools()
+	if err != nil {
+		return 0, err
+	}
+	position := 0
+	for _, tool := range tools {
+		if tool.Position >= position {
+			position = tool.Position + 1
+		}
+	}
+	return position, nil
+}
+
+// adminInstallation is an installation and the repositories it covers, as
+// displayed to operators.
+type adminInstallation struct {
+	db.GHInstallation
+	Repositories []db.Repository
+}
+
+// AdminInstallationsHandler lists the installations awaiting approval and
+// the denied installations.
+func (web *Web) AdminInstallationsHandler(w http.ResponseWriter, r *http.Request) {
+	installations, err := web.db.ListUnapprovedGHInstallations()
+	if err != nil {
+		log.Printf("error listing unapproved installations: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list installations")
+		return
+	}
+
+	page := struct {
+		Title         string
+		Installations []adminInstallation
+	}{Title: "Installations"}
+	for _, install := range installations {
+		repos, err := web.db.ListRepositories(install.ID)
+		if err != nil {
+			log.Printf("error listing repositories for installationID %v: %v", install.InstallationID, err)
+			web.errorHandler(w, r, http.StatusInternalServerError, "Could not list repositories")
+			return
+		}
+		page.Installations = append(page.Installations, adminInstallation{GHInstallation: install, Repositories: repos})
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "admin_installations.tmpl", page); err != nil {
+		log.Println("error parsing admin installations template:", err)
+	}
+}
+
+// AdminInstallationActionHandler performs the action from the URL parameter
+// action on the installation with the GitHub installation ID from the URL
+// parameter installationID. Actions are approve and deny.
+func (web *Web) AdminInstallationActionHandler(w http.ResponseWriter, r *http.Request) {
+	installationID, err := strconv.ParseInt(chi.URLParam(r, "installationID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid installation ID")
+		return
+	}
+
+	install, err := web.db.GetGHInstallation(int(installationID))
+	if err != nil {
+		log.Printf("error getting installationID %v: %v", installationID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get installation")
+		return
+	}
+	if install == nil {
+		web.errorHandler(w, r, http.StatusNotFound, "Installation not found")
+		return
+	}
+
+	switch action := chi.URLParam(r, "action"); action {
+	case "approve":
+		err = web.db.ApproveGHInstallation(install.InstallationID)
+	case "deny":
+		err = web.db.DenyGHInstallation(install.InstallationID)
+	default:
+		web.errorHandler(w, r, http.StatusNotFound, "Unknown action")
+		return
+	}
+	if err != nil {
+		log.Printf("error updating installationID %v: %v", installationID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not update installation")
+		return
+	}
+	http.Redirect(w, r, "/admin/installations", http.StatusSeeOther)
+}
+
+// adminDeliveriesLimit is the number of recent webhook deliveries listed.
+const adminDeliveriesLimit = 100
+
+// AdminDeliveriesHandler lists the most recent webhook deliveries.
+func (web *Web) AdminDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := web.db.ListWebhookDeliveries(adminDeliveriesLimit)
+	if err != nil {
+		log.Printf("error listing webhook deliveries: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list deliveries")
+		return
+	}
+
+	page := struct {
+		Title      string
+		Deliveries []db.WebhookDelivery
+	}{Title: "Deliveries", Deliveries: deliveries}
+
+	if err := web.templates.ExecuteTemplate(w, "admin_deliveries.tmpl", page); err != nil {
+		log.Println("error parsing admin deliveries template:", err)
+	}
+}
+
+// AdminDeliveryHandler displays the webhook delivery with the GUID from the
+// URL parameter guid, including its payload.
+func (web *Web) AdminDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	guid := chi.URLParam(r, "guid")
+	delivery, err := web.db.GetWebhookDelivery(guid)
+	if err != nil {
+		log.Printf("error getting webhook delivery %v: %v", guid, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get delivery")
+		return
+	}
+	if delivery == nil {
+		web.errorHandler(w, r, http.StatusNotFound, "Delivery not found")
+		return
+	}
+
+	page := struct {
+		Title    string
+		Delivery *db.WebhookDelivery
+		Payload  string // Payload is the delivery's payload, indented if it's valid JSON.
+	}{Title: "Delivery " + delivery.GUID, Delivery: delivery, Payload: string(delivery.Payload)}
+	var payload bytes.Buffer
+	if err := json.Indent(&payload, delivery.Payload, "", "  "); err == nil {
+		page.Payload = payload.String()
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "admin_delivery.tmpl", page); err != nil {
+		log.Println("error parsing admin delivery template:", err)
+	}
+}
+
+// AdminReplayDeliveryHandler handles the webhook delivery with the GUID from
+// the URL parameter guid again, such as to queue an analysis which failed.
+func (web *Web) AdminReplayDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	guid := chi.URLParam(r, "guid")
+	delivery, err := web.gh.ReplayDelivery(guid)
+	if err != nil {
+		log.Printf("error replaying webhook delivery %v: %v", guid, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not replay delivery")
+		return
+	}
+	if delivery == nil {
+		web.errorHandler(w, r, http.StatusNotFound, "Delivery not found")
+		return
+	}
+	http.Redirect(w, r, "/admin/deliveries/"+url.PathEscape(guid), http.StatusSeeOther)
+}
@@ -0,0 +1,319 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/github"
+	"github.com/pressly/chi"
+)
+
+func setupAdmin(t *testing.T) (http.Handler, *db.MockDB) {
+	templates, err := template.ParseGlob("templates/*.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error parsing templates: %v", err)
+	}
+
+	memDB := db.NewMockDB()
+	memDB.Tools = []db.Tool{
+		{ID: 1, Name: "golint", Path: "golint", Args: "./...", Position: 0},
+		{ID: 2, Name: "vet", Path: "go", Args: "vet ./...", Position: 1},
+		{ID: 3, Name: "inhouse", Path: "inhouse", Args: "./...", Position: 2, InstallationID: 1},
+	}
+	memDB.Usage = map[db.ToolID]db.ToolUsage{1: {Analyses: 5, Issues: 7}}
+
+	gh, err := github.New(nil, memDB, make(chan interface{}, 10), 1, nil, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error initialising GitHub: %v", err)
+	}
+	web := &Web{db: memDB, gh: gh, templates: templates}
+
+	r := chi.NewRouter()
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(web.AdminAuth("admin", "secret"))
+		r.Get("/tools", web.AdminToolsHandler)
+		r.Post("/tools", web.AdminSaveToolHandler)
+		r.Get("/tools/new", web.AdminNewToolHandler)
+		r.Get("/tools/:toolID", web.AdminEditToolHandler)
+		r.Post("/tools/:toolID", web.AdminSaveToolHandler)
+		r.Post("/tools/:toolID/:action", web.AdminToolActionHandler)
+		r.Get("/installations", web.AdminInstallationsHandler)
+		r.Post("/installations/:installationID/:action", web.AdminInstallationActionHandler)
+		r.Get("/deliveries", web.AdminDeliveriesHandler)
+		r.Get("/deliveries/:guid", web.AdminDeliveryHandler)
+		r.Post("/deliveries/:guid/replay", web.AdminReplayDeliveryHandler)
+	})
+	return r, memDB
+}
+
+// adminDo performs an authenticated request with an optional form body.
+func adminDo(r http.Handler, method, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("admin", "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	r, _ := setupAdmin(t)
+
+	tests := []struct {
+		user, pass string
+		method     string
+		origin     string
+		want       int
+	}{
+		{"", "", "GET", "", http.StatusUnauthorized},
+		{"admin", "wrong", "GET", "", http.StatusUnauthorized},
+		{"wrong", "secret", "GET", "", http.StatusUnauthorized},
+		{"admin", "secret", "GET", "", http.StatusOK},
+		{"admin", "secret", "POST", "https://evil.example.com", http.StatusForbidden},
+		{"admin", "secret", "POST", "http://example.com", http.StatusSeeOther},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/admin/tools/1/disable", nil)
+		if test.method == "GET" {
+			req = httptest.NewRequest(test.method, "/admin/tools", nil)
+		}
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.pass)
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("user: %q pass: %q method: %v origin: %q have code: %v want: %v", test.user, test.pass, test.method, test.origin, w.Code, test.want)
+		}
+	}
+}
+
+func TestAdminTools(t *testing.T) {
+	r, _ := setupAdmin(t)
+
+	w := adminDo(r, "GET", "/admin/tools", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("have code: %v want: %v", w.Code, http.StatusOK)
+	}
+	for _, want := range []string{"golint", "vet", "inhouse", "Installation 1", "<td>7</td>"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected body to contain %q", want)
+		}
+	}
+}
+
+func TestAdminSaveTool(t *testing.T) {
+	r, memDB := setupAdmin(t)
+
+	// Add
+	form := url.Values{"name": {"staticcheck"}, "path": {"staticcheck"}, "args": {"./..."}, "timeout": {"1m"}}
+	if w := adminDo(r, "POST", "/admin/tools", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("add have code: %v want: %v, body: %s", w.Code, http.StatusSeeOther, w.Body)
+	}
+	tool, _ := memDB.GetTool(4)
+	if tool == nil || tool.Name != "staticcheck" || tool.Position != 3 || tool.Timeout.String() != "1m0s" {
+		t.Errorf("unexpected added tool: %+v", tool)
+	}
+
+	// Update, keeping position and disabled
+	memDB.Tools[0].Disabled = true
+	form = url.Values{"name": {"golint"}, "path": {"golint"}, "args": {"-set_exit_status ./..."}}
+	if w := adminDo(r, "POST", "/admin/tools/1", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("update have code: %v want: %v, body: %s", w.Code, http.StatusSeeOther, w.Body)
+	}
+	tool, _ = memDB.GetTool(1)
+	if tool.Args != "-set_exit_status ./..." || !tool.Disabled {
+		t.Errorf("unexpected updated tool: %+v", tool)
+	}
+
+	// Invalid
+	form = url.Values{"name": {"golint"}, "path": {"go lint"}}
+	if w := adminDo(r, "POST", "/admin/tools/1", form); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid have code: %v want: %v", w.Code, http.StatusBadRequest)
+	}
+	form = url.Values{"name": {"golint"}, "path": {"golint"}, "timeout": {"soon"}}
+	if w := adminDo(r, "POST", "/admin/tools/1", form); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid timeout have code: %v want: %v", w.Code, http.StatusBadRequest)
+	}
+
+	// Not found
+	if w := adminDo(r, "POST", "/admin/tools/99", form); w.Code != http.StatusNotFound {
+		t.Errorf("not found have code: %v want: %v", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminSaveTool_test(t *testing.T) {
+	r, memDB := setupAdmin(t)
+
+	form := url.Values{
+		"action": {"test"},
+		"name":   {"changed"},
+		"path":   {"golint"},
+		"regexp": {`^(.+):(\d+):(\d+): (.*)$`},
+		"sample": {"main.go:1:2: exported func should have comment\nnot an issue"},
+	}
+	w := adminDo(r, "POST", "/admin/tools/1", form)
+	if w.Code != http.StatusOK {
+		t.Fatalf("have code: %v want: %v", w.Code, http.StatusOK)
+	}
+	if want := "<td>exported func should have comment</td>"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("expected body to contain %q, body: %s", want, w.Body)
+	}
+	if tool, _ := memDB.GetTool(1); tool.Name != "golint" {
+		t.Errorf("tool was saved when testing: %+v", tool)
+	}
+
+	form.Set("regexp", "(")
+	w = adminDo(r, "POST", "/admin/tools/1", form)
+	if want := "invalid regexp"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("expected body to contain %q, body: %s", want, w.Body)
+	}
+}
+
+func TestAdminToolAction(t *testing.T) {
+	r, memDB := setupAdmin(t)
+
+	order := func() []db.ToolID {
+		tools, _ := memDB.ListAllTools()
+		var ids []db.ToolID
+		for _, tool := range tools {
+			ids = append(ids, tool.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		url  string
+		want []db.ToolID
+	}{
+		{"/admin/tools/3/up", []db.ToolID{1, 3, 2}},
+		{"/admin/tools/3/up", []db.ToolID{3, 1, 2}},
+		{"/admin/tools/3/up", []db.ToolID{3, 1, 2}}, // already first
+		{"/admin/tools/3/down", []db.ToolID{1, 3, 2}},
+	}
+	for _, test := range tests {
+		if w := adminDo(r, "POST", test.url, nil); w.Code != http.StatusSeeOther {
+			t.Fatalf("url: %v have code: %v want: %v", test.url, w.Code, http.StatusSeeOther)
+		}
+		if have := order(); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("url: %v have order: %v want: %v", test.url, have, test.want)
+		}
+	}
+
+	adminDo(r, "POST", "/admin/tools/2/disable", nil)
+	if tools, _ := memDB.ListTools(0); len(tools) != 1 || tools[0].ID != 1 {
+		t.Errorf("unexpected enabled tools after disable: %+v", tools)
+	}
+	adminDo(r, "POST", "/admin/tools/2/enable", nil)
+	if tools, _ := memDB.ListTools(0); len(tools) != 2 {
+		t.Errorf("unexpected enabled tools after enable: %+v", tools)
+	}
+
+	if w := adminDo(r, "POST", "/admin/tools/2/unknown", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown action have code: %v want: %v", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminInstallations(t *testing.T) {
+	r, memDB := setupAdmin(t)
+	memDB.AddGHInstallation(2, 20, 21)
+	memDB.AddGHInstallation(3, 30, 31)
+	memDB.SetRepository(db.Repository{ID: 100, InstallationID: 2, Owner: "owner", Name: "repo"})
+
+	w := adminDo(r, "GET", "/admin/installations", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("have code: %v want: %v", w.Code, http.StatusOK)
+	}
+	for _, want := range []string{"owner/repo", "/admin/installations/2/approve", "/admin/installations/3/deny"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("body does not contain %q:\n%s", want, w.Body)
+		}
+	}
+
+	tests := []struct {
+		url     string
+		want    int
+		enabled bool
+		denied  bool
+	}{
+		{"/admin/installations/2/approve", http.StatusSeeOther, true, false},
+		{"/admin/installations/2/deny", http.StatusSeeOther, false, true},
+		{"/admin/installations/2/approve", http.StatusSeeOther, true, false},
+		{"/admin/installations/2/unknown", http.StatusNotFound, true, false},
+	}
+	for _, test := range tests {
+		if w := adminDo(r, "POST", test.url, nil); w.Code != test.want {
+			t.Errorf("url: %v have code: %v want: %v", test.url, w.Code, test.want)
+		}
+		install, _ := memDB.GetGHInstallation(2)
+		if install.IsEnabled() != test.enabled || install.IsDenied() != test.denied {
+			t.Errorf("url: %v have enabled: %v denied: %v want enabled: %v denied: %v",
+				test.url, install.IsEnabled(), install.IsDenied(), test.enabled, test.denied)
+		}
+	}
+
+	if w := adminDo(r, "POST", "/admin/installations/9/approve", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown installation have code: %v want: %v", w.Code, http.StatusNotFound)
+	}
+
+	// Approved installations are no longer listed.
+	if w := adminDo(r, "GET", "/admin/installations", nil); strings.Contains(w.Body.String(), "/admin/installations/2/") {
+		t.Errorf("approved installation listed:\n%s", w.Body)
+	}
+}
+
+func TestAdminDeliveries(t *testing.T) {
+	r, memDB := setupAdmin(t)
+	memDB.RecordWebhookDelivery(&db.WebhookDelivery{Event: "push", Result: db.DeliveryResultInvalid, Error: "invalid signature"})
+	memDB.RecordWebhookDelivery(&db.WebhookDelivery{
+		GUID:    "guid",
+		Event:   "issues",
+		Payload: []byte(`{"action":"opened"}`),
+		Result:  db.DeliveryResultIgnored,
+	})
+
+	w := adminDo(r, "GET", "/admin/deliveries", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("have code: %v want: %v", w.Code, http.StatusOK)
+	}
+	for _, want := range []string{"invalid signature", "/admin/deliveries/guid/replay"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("deliveries body does not contain %q:\n%s", want, w.Body)
+		}
+	}
+
+	w = adminDo(r, "GET", "/admin/deliveries/guid", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("have code: %v want: %v", w.Code, http.StatusOK)
+	}
+	if want := "&#34;action&#34;: &#34;opened&#34;"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("delivery body does not contain indented payload %q:\n%s", want, w.Body)
+	}
+
+	tests := []struct {
+		method, url string
+		want        int
+	}{
+		{"GET", "/admin/deliveries/unknown", http.StatusNotFound},
+		{"POST", "/admin/deliveries/unknown/replay", http.StatusNotFound},
+		{"POST", "/admin/deliveries/guid/replay", http.StatusSeeOther},
+	}
+	for _, test := range tests {
+		if w := adminDo(r, test.method, test.url, nil); w.Code != test.want {
+			t.Errorf("%v %v have code: %v want: %v", test.method, test.url, w.Code, test.want)
+		}
+	}
+	if delivery, _ := memDB.GetWebhookDelivery("guid"); delivery.Attempts != 2 {
+		t.Errorf("replayed delivery have attempts: %v want: 2", delivery.Attempts)
+	}
+}
@@ -0,0 +1,801 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/github"
+	"github.com/pkg/errors"
+	"github.com/pressly/chi"
+)
+
+// Authenticator authenticates users of the API and users who sign in with
+// GitHub.
+type Authenticator interface {
+	// UserID returns the ID of the GitHub user who owns the OAuth or personal
+	// access token.
+	UserID(ctx context.Context, token string) (int, error)
+	// OrgAdmin returns true if the GitHub user who owns the OAuth or personal
+	// access token is an admin (owner) of the organisation with orgID.
+	OrgAdmin(ctx context.Context, token string, orgID int) (bool, error)
+	// OAuthURL returns the URL to redirect a user to, to sign in with GitHub,
+	// who is redirected back to redirectURL with a code and state.
+	OAuthURL(state, redirectURL string) string
+	// Login returns the ID and login of the user who signed in with GitHub
+	// and was redirected back with code.
+	Login(ctx context.Context, code string) (userID int, login string, err error)
+	// RepositoryPermission returns the permission, "admin", "write", "read"
+	// or "none", the user with login has to the repository with repositoryID,
+	// as seen by the installation with the GitHub installationID.
+	RepositoryPermission(ctx context.Context, installationID, repositoryID int, login string) (string, error)
+}
+
+// apiTool is the API representation of a db.Tool.
+type apiTool struct {
+	ID      db.ToolID `json:"id"`
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	Path    string    `json:"path"`
+	Args    string    `json:"args"`
+	Regexp  string    `json:"regexp"`
+	Timeout string    `json:"timeout,omitempty"` // Timeout is a duration such as "30s", empty uses the analyser's default.
+}
+
+// newAPITool returns an apiTool for a db.Tool.
+func newAPITool(tool db.Tool) apiTool {
+	at := apiTool{
+		ID:     tool.ID,
+		Name:   tool.Name,
+		URL:    tool.URL,
+		Path:   tool.Path,
+		Args:   tool.Args,
+		Regexp: tool.Regexp,
+	}
+	if tool.Timeout != 0 {
+		at.Timeout = tool.Timeout.String()
+	}
+	return at
+}
+
+// dbTool returns a db.Tool for an apiTool, or a db.ValidationError if the
+// timeout is invalid.
+func (at apiTool) dbTool() (db.Tool, error) {
+	tool := db.Tool{
+		Name:   at.Name,
+		URL:    at.URL,
+		Path:   at.Path,
+		Args:   at.Args,
+		Regexp: at.Regexp,
+	}
+	if at.Timeout != "" {
+		timeout, err := time.ParseDuration(at.Timeout)
+		if err != nil {
+			return tool, &db.ValidationError{Field: "timeout", Msg: "must be a duration such as 30s"}
+		}
+		tool.Timeout = db.Duration(timeout)
+	}
+	return tool, nil
+}
+
+// apiError writes an error message as JSON with the status code.
+func apiError(w http.ResponseWriter, code int, msg string) {
+	apiResponse(w, code, struct {
+		Error string `json:"error"`
+	}{msg})
+}
+
+// apiResponse writes v as JSON with the status code.
+func apiResponse(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("error encoding api response:", err)
+	}
+}
+
+// installation authenticates the request and returns the installation from
+// the URL parameter installationID (the GitHub installation ID), if the user
+// is the installation's account or an admin of its organisation. If nil is
+// returned, an error has already been written to w.
+//
+// Requests are authenticated using a GitHub OAuth or personal access token in
+// the Authorization header, in the form "token <token>". Organisation admins
+// are found using the token, which requires the read:org scope.
+func (web *Web) installation(w http.ResponseWriter, r *http.Request) *db.GHInstallation {
+	install, _ := web.installationUser(w, r)
+	return install
+}
+
+// installationUser is the same as installation, but also returns the ID of
+// the authenticated user.
+func (web *Web) installationUser(w http.ResponseWriter, r *http.Request) (*db.GHInstallation, int) {
+	installationID, err := strconv.ParseInt(chi.URLParam(r, "installationID"), 10, 32)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid installation ID")
+		return nil, 0
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "token ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		apiError(w, http.StatusUnauthorized, `Authorization header must be in the form "token <token>"`)
+		return nil, 0
+	}
+
+	userID, err := web.auth.UserID(r.Context(), token)
+	if err != nil {
+		log.Printf("error authenticating api request: %v", err)
+		apiError(w, http.StatusUnauthorized, "could not authenticate token")
+		return nil, 0
+	}
+
+	install, err := web.db.GetGHInstallation(int(installationID))
+	if err != nil {
+		log.Printf("error getting installationID %v: %v", installationID, err)
+		apiError(w, http.StatusInternalServerError, "could not get installation")
+		return nil, 0
+	}
+
+	// Respond with not found if the user isn't authorised, to avoid
+	// disclosing which installations exist.
+	if install == nil {
+		apiError(w, http.StatusNotFound, "installation not found")
+		return nil, 0
+	}
+	ok, err := web.authorised(r.Context(), install, token, userID)
+	if err != nil {
+		log.Printf("error authorising api request for installationID %v: %v", installationID, err)
+		apiError(w, http.StatusInternalServerError, "could not authorise token")
+		return nil, 0
+	}
+	if !ok {
+		apiError(w, http.StatusNotFound, "installation not found")
+		return nil, 0
+	}
+	return install, userID
+}
+
+// authorised returns true if the user with userID, who owns token, can
+// manage the installation, because the user is the installation's account or
+// an admin of the installation's organisation. The user who installed the
+// installation isn't authorised, as they may no longer be an admin.
+func (web *Web) authorised(ctx context.Context, install *db.GHInstallation, token string, userID int) (bool, error) {
+	if userID == install.AccountID {
+		return true, nil
+	}
+	return web.auth.OrgAdmin(ctx, token, install.AccountID)
+}
+
+// installationTool returns the installation and the tool from the URL
+// parameter toolID, if the tool is scoped to the installation. If nil is
+// returned, an error has already been written to w.
+func (web *Web) installationTool(w http.ResponseWriter, r *http.Request) (*db.GHInstallation, *db.Tool) {
+	install := web.installation(w, r)
+	if install == nil {
+		return nil, nil
+	}
+
+	toolID, err := strconv.ParseInt(chi.URLParam(r, "toolID"), 10, 32)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid tool ID")
+		return nil, nil
+	}
+
+	tool, err := web.db.GetTool(db.ToolID(toolID))
+	if err != nil {
+		log.Printf("error getting toolID %v: %v", toolID, err)
+		apiError(w, http.StatusInternalServerError, "could not get tool")
+		return nil, nil
+	}
+	if tool == nil || tool.InstallationID != install.ID {
+		apiError(w, http.StatusNotFound, "tool not found")
+		return nil, nil
+	}
+	return install, tool
+}
+
+// installationRepository returns the repository with owner and name, if it's
+// covered by the installation. If nil is returned, an error has already been
+// written to w.
+func (web *Web) installationRepository(w http.ResponseWriter, install *db.GHInstallation, owner, name string) *db.Repository {
+	repos, err := web.db.ListRepositories(install.ID)
+	if err != nil {
+		log.Printf("error listing repositories for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not list repositories")
+		return nil
+	}
+	for _, repo := range repos {
+		// GitHub's owner and repository names are case insensitive.
+		if strings.EqualFold(repo.Owner, owner) && strings.EqualFold(repo.Name, name) {
+			return &repo
+		}
+	}
+	apiError(w, http.StatusNotFound, "repository not found")
+	return nil
+}
+
+// decodeTool decodes an apiTool from the request's body. If an error is
+// returned, an error has already been written to w.
+func decodeTool(w http.ResponseWriter, r *http.Request) (db.Tool, bool) {
+	var at apiTool
+	if err := json.NewDecoder(r.Body).Decode(&at); err != nil {
+		apiError(w, http.StatusBadRequest, "could not decode tool: "+err.Error())
+		return db.Tool{}, false
+	}
+	tool, err := at.dbTool()
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return db.Tool{}, false
+	}
+	return tool, true
+}
+
+// saveError writes the error from adding or updating a tool.
+func saveError(w http.ResponseWriter, err error) {
+	if verr, ok := err.(*db.ValidationError); ok {
+		apiError(w, http.StatusBadRequest, verr.Error())
+		return
+	}
+	log.Printf("error saving tool: %v", err)
+	apiError(w, http.StatusInternalServerError, "could not save tool")
+}
+
+// ListInstallationToolsHandler lists the tools scoped to an installation,
+// global tools are not included.
+func (web *Web) ListInstallationToolsHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	tools, err := web.db.ListTools(install.ID)
+	if err != nil {
+		log.Printf("error listing tools for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not list tools")
+		return
+	}
+
+	apiTools := []apiTool{}
+	for _, tool := range tools {
+		if tool.InstallationID == install.ID {
+			apiTools = append(apiTools, newAPITool(tool))
+		}
+	}
+	apiResponse(w, http.StatusOK, apiTools)
+}
+
+// AddInstallationToolHandler adds a tool scoped to an installation.
+func (web *Web) AddInstallationToolHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	tool, ok := decodeTool(w, r)
+	if !ok {
+		return
+	}
+	tool.InstallationID = install.ID
+
+	if err := web.db.AddTool(&tool); err != nil {
+		saveError(w, err)
+		return
+	}
+	apiResponse(w, http.StatusCreated, newAPITool(tool))
+}
+
+// UpdateInstallationToolHandler updates a tool scoped to an installation.
+func (web *Web) UpdateInstallationToolHandler(w http.ResponseWriter, r *http.Request) {
+	install, existing := web.installationTool(w, r)
+	if existing == nil {
+		return
+	}
+
+	tool, ok := decodeTool(w, r)
+	if !ok {
+		return
+	}
+	tool.ID = existing.ID
+	tool.InstallationID = install.ID
+	tool.Position = existing.Position
+	tool.Disabled = existing.Disabled
+
+	if err := web.db.UpdateTool(tool); err != nil {
+		saveError(w, err)
+		return
+	}
+	apiResponse(w, http.StatusOK, newAPITool(tool))
+}
+
+// RemoveInstallationToolHandler removes a tool scoped to an installation.
+func (web *Web) RemoveInstallationToolHandler(w http.ResponseWriter, r *http.Request) {
+	_, tool := web.installationTool(w, r)
+	if tool == nil {
+		return
+	}
+
+	if err := web.db.RemoveTool(tool.ID); err != nil {
+		log.Printf("error removing toolID %v: %v", tool.ID, err)
+		apiError(w, http.StatusInternalServerError, "could not remove tool")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSettings is the API representation of db.InstallationSettings.
+type apiSettings struct {
+	GoVersion    string `json:"go_version"`    // GoVersion is the default version of Go for repositories, such as "1.8".
+	SingleReview bool   `json:"single_review"` // SingleReview submits a pull request's issues as a single review.
+	ForkApproval bool   `json:"fork_approval"` // ForkApproval requires approval to analyse forks from first time contributors.
+}
+
+// newAPISettings returns the apiSettings of an installation.
+func newAPISettings(install *db.GHInstallation) apiSettings {
+	return apiSettings{
+		GoVersion:    install.GoVersion,
+		SingleReview: install.SingleReview,
+		ForkApproval: install.ForkApproval,
+	}
+}
+
+// GetSettingsHandler returns an installation's settings.
+func (web *Web) GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+	apiResponse(w, http.StatusOK, newAPISettings(install))
+}
+
+// SetSettingsHandler replaces an installation's settings.
+func (web *Web) SetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	var settings apiSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		apiError(w, http.StatusBadRequest, "could not decode settings: "+err.Error())
+		return
+	}
+	settings.GoVersion = strings.TrimSpace(settings.GoVersion)
+
+	err := web.db.SetGHInstallationSettings(install.ID, db.InstallationSettings{
+		GoVersion:    settings.GoVersion,
+		SingleReview: settings.SingleReview,
+		ForkApproval: settings.ForkApproval,
+	})
+	if verr, ok := err.(*db.ValidationError); ok {
+		apiError(w, http.StatusBadRequest, verr.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("error setting settings for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not set settings")
+		return
+	}
+	apiResponse(w, http.StatusOK, settings)
+}
+
+// apiFullScan is the API representation of a github.FullScan.
+type apiFullScan struct {
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+	Ref   string `json:"ref,omitempty"` // Ref is a branch, tag or sha, empty uses the default branch.
+}
+
+// FullScanHandler queues a full scan of one of an installation's
+// repositories, recording all issues at the ref, not just new issues.
+func (web *Web) FullScanHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	var scan apiFullScan
+	if err := json.NewDecoder(r.Body).Decode(&scan); err != nil {
+		apiError(w, http.StatusBadRequest, "could not decode scan: "+err.Error())
+		return
+	}
+	if scan.Owner == "" || scan.Repo == "" {
+		apiError(w, http.StatusBadRequest, "owner and repo are required")
+		return
+	}
+	if web.installationRepository(w, install, scan.Owner, scan.Repo) == nil {
+		return
+	}
+
+	job := &github.FullScan{
+		InstallationID: install.InstallationID,
+		Owner:          scan.Owner,
+		Repo:           scan.Repo,
+		Ref:            scan.Ref,
+	}
+	if !web.enqueue(job) {
+		w.Header().Set("Retry-After", "60")
+		apiError(w, http.StatusServiceUnavailable, "queue is full, try again later")
+		return
+	}
+	apiResponse(w, http.StatusAccepted, scan)
+}
+
+// enqueueTimeout is the maximum duration to wait to add a job to a full
+// queue, before the system is considered overloaded.
+var enqueueTimeout = 2 * time.Second
+
+// enqueue adds job to the queue, returning false if the queue remained full
+// for enqueueTimeout.
+func (web *Web) enqueue(job interface{}) bool {
+	timer := time.NewTimer(enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case web.queue <- job:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// apiSchedule is the API representation of a db.Schedule.
+type apiSchedule struct {
+	ID        int       `json:"id"`
+	Owner     string    `json:"owner"`
+	Repo      string    `json:"repo"`
+	Interval  string    `json:"interval"` // Interval is a duration such as "24h".
+	NextRunAt time.Time `json:"next_run_at"`
+}
+
+// newAPISchedule returns an apiSchedule for a db.Schedule.
+func newAPISchedule(schedule db.Schedule) apiSchedule {
+	return apiSchedule{
+		ID:        schedule.ID,
+		Owner:     schedule.Owner,
+		Repo:      schedule.Repo,
+		Interval:  schedule.Interval.String(),
+		NextRunAt: schedule.NextRunAt,
+	}
+}
+
+// ListSchedulesHandler lists the schedules of an installation's repositories.
+func (web *Web) ListSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	schedules, err := web.db.ListSchedules(install.ID)
+	if err != nil {
+		log.Printf("error listing schedules for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not list schedules")
+		return
+	}
+
+	apiSchedules := []apiSchedule{}
+	for _, schedule := range schedules {
+		apiSchedules = append(apiSchedules, newAPISchedule(schedule))
+	}
+	apiResponse(w, http.StatusOK, apiSchedules)
+}
+
+// SetScheduleHandler adds or replaces the schedule of one of an installation's
+// repositories, the repository's default branch is fully scanned each
+// interval.
+func (web *Web) SetScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	var as apiSchedule
+	if err := json.NewDecoder(r.Body).Decode(&as); err != nil {
+		apiError(w, http.StatusBadRequest, "could not decode schedule: "+err.Error())
+		return
+	}
+	interval, err := time.ParseDuration(as.Interval)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "interval must be a duration such as 24h")
+		return
+	}
+	if as.Owner == "" || as.Repo == "" {
+		apiError(w, http.StatusBadRequest, "owner and repo are required")
+		return
+	}
+	repo := web.installationRepository(w, install, as.Owner, as.Repo)
+	if repo == nil {
+		return
+	}
+
+	schedule := db.Schedule{
+		InstallationID:   install.ID,
+		GHInstallationID: install.InstallationID,
+		Owner:            repo.Owner,
+		Repo:             repo.Name,
+		Interval:         interval,
+	}
+	if err := web.db.SetSchedule(&schedule); err != nil {
+		if verr, ok := err.(*db.ValidationError); ok {
+			apiError(w, http.StatusBadRequest, verr.Error())
+			return
+		}
+		log.Printf("error saving schedule: %v", err)
+		apiError(w, http.StatusInternalServerError, "could not save schedule")
+		return
+	}
+	apiResponse(w, http.StatusOK, newAPISchedule(schedule))
+}
+
+// RemoveScheduleHandler removes the schedule of one of an installation's
+// repositories.
+func (web *Web) RemoveScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	scheduleID, err := strconv.ParseInt(chi.URLParam(r, "scheduleID"), 10, 32)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid schedule ID")
+		return
+	}
+
+	if err := web.db.RemoveSchedule(install.ID, int(scheduleID)); err != nil {
+		log.Printf("error removing scheduleID %v: %v", scheduleID, err)
+		apiError(w, http.StatusInternalServerError, "could not remove schedule")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSuppression is the API representation of a db.Suppression.
+type apiSuppression struct {
+	ID           int        `json:"id"`
+	RepositoryID int        `json:"repository_id"`
+	Fingerprint  string     `json:"fingerprint"`
+	Issue        string     `json:"issue"`
+	Reason       string     `json:"reason"`
+	CreatedBy    int        `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RevokedBy    int        `json:"revoked_by,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// newAPISuppression returns an apiSuppression for a db.Suppression.
+func newAPISuppression(suppression db.Suppression) apiSuppression {
+	return apiSuppression{
+		ID:           suppression.ID,
+		RepositoryID: suppression.RepositoryID,
+		Fingerprint:  suppression.Fingerprint,
+		Issue:        suppression.Issue,
+		Reason:       suppression.Reason,
+		CreatedBy:    suppression.CreatedBy,
+		CreatedAt:    suppression.CreatedAt,
+		RevokedBy:    suppression.RevokedBy,
+		RevokedAt:    suppression.RevokedAt,
+	}
+}
+
+// ListSuppressionsHandler lists the suppressions of an installation's
+// repositories, including revoked suppressions, newest first. The optional
+// query parameter repository_id limits the suppressions to one repository.
+func (web *Web) ListSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	var repositoryID int64
+	if id := r.URL.Query().Get("repository_id"); id != "" {
+		var err error
+		if repositoryID, err = strconv.ParseInt(id, 10, 32); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid repository ID")
+			return
+		}
+	}
+
+	suppressions, err := web.db.ListSuppressions(install.ID, int(repositoryID))
+	if err != nil {
+		log.Printf("error listing suppressions for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not list suppressions")
+		return
+	}
+
+	apiSuppressions := []apiSuppression{}
+	for _, suppression := range suppressions {
+		apiSuppressions = append(apiSuppressions, newAPISuppression(suppression))
+	}
+	apiResponse(w, http.StatusOK, apiSuppressions)
+}
+
+// AddSuppressionHandler suppresses an issue from one of an installation's
+// analyses, so it's no longer reported in the analysis' repository.
+func (web *Web) AddSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	install, userID := web.installationUser(w, r)
+	if install == nil {
+		return
+	}
+
+	var req struct {
+		AnalysisID int    `json:"analysis_id"`
+		IssueID    int    `json:"issue_id"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "could not decode suppression: "+err.Error())
+		return
+	}
+
+	analysis, err := web.db.GetAnalysis(req.AnalysisID)
+	if err != nil {
+		log.Printf("error getting analysisID %v: %v", req.AnalysisID, err)
+		apiError(w, http.StatusInternalServerError, "could not get analysis")
+		return
+	}
+	if analysis == nil || analysis.InstallationID != install.InstallationID {
+		apiError(w, http.StatusNotFound, "analysis not found")
+		return
+	}
+	suppression := issueSuppression(analysis, req.IssueID)
+	if suppression == nil {
+		apiError(w, http.StatusNotFound, "issue not found")
+		return
+	}
+	suppression.InstallationID = install.ID
+	suppression.Reason = strings.TrimSpace(req.Reason)
+	suppression.CreatedBy = userID
+
+	if err := web.db.AddSuppression(suppression); err != nil {
+		if verr, ok := err.(*db.ValidationError); ok {
+			apiError(w, http.StatusBadRequest, verr.Error())
+			return
+		}
+		log.Printf("error adding suppression: %v", err)
+		apiError(w, http.StatusInternalServerError, "could not add suppression")
+		return
+	}
+	apiResponse(w, http.StatusCreated, newAPISuppression(*suppression))
+}
+
+// RevokeSuppressionHandler revokes a suppression of one of an installation's
+// repositories, so the issue is reported again.
+func (web *Web) RevokeSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	install, userID := web.installationUser(w, r)
+	if install == nil {
+		return
+	}
+
+	suppressionID, err := strconv.ParseInt(chi.URLParam(r, "suppressionID"), 10, 32)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid suppression ID")
+		return
+	}
+
+	err = web.db.RevokeSuppression(install.ID, int(suppressionID), userID)
+	if err == db.ErrNotFound {
+		apiError(w, http.StatusNotFound, "suppression not found")
+		return
+	}
+	if err != nil {
+		log.Printf("error revoking suppressionID %v: %v", suppressionID, err)
+		apiError(w, http.StatusInternalServerError, "could not revoke suppression")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redacted replaces secrets in API responses, and if a secret is redacted in
+// a request, the existing secret is kept.
+const redacted = "[redacted]"
+
+// apiDeps is the API representation of db.DepsCredentials.
+type apiDeps struct {
+	OrgToken  bool   `json:"org_token"` // OrgToken provides the installation's token to fetch the owner's private repositories.
+	GOPRIVATE string `json:"goprivate"`
+	GOPROXY   string `json:"goproxy"` // GOPROXY is redacted in responses, as it may include credentials.
+	Netrc     string `json:"netrc"`   // Netrc is redacted in responses.
+}
+
+// newAPIDeps returns an apiDeps for db.DepsCredentials, redacting secrets.
+func newAPIDeps(creds db.DepsCredentials) apiDeps {
+	deps := apiDeps{OrgToken: creds.OrgToken, GOPRIVATE: creds.GOPRIVATE}
+	if creds.GOPROXY != "" {
+		deps.GOPROXY = redacted
+	}
+	if creds.Netrc != "" {
+		deps.Netrc = redacted
+	}
+	return deps
+}
+
+// installationDeps returns the installation and its deps credentials, which
+// are empty if it has none. If nil is returned, an error has already been
+// written to w.
+func (web *Web) installationDeps(w http.ResponseWriter, r *http.Request) (*db.GHInstallation, *db.DepsCredentials) {
+	install := web.installation(w, r)
+	if install == nil {
+		return nil, nil
+	}
+
+	creds, err := web.db.GetDepsCredentials(install.ID)
+	if err != nil {
+		log.Printf("error getting deps credentials for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not get deps credentials")
+		return nil, nil
+	}
+	if creds == nil {
+		creds = &db.DepsCredentials{}
+	}
+	return install, creds
+}
+
+// GetDepsHandler returns the settings and credentials an installation uses to
+// install private dependencies, secrets are redacted.
+func (web *Web) GetDepsHandler(w http.ResponseWriter, r *http.Request) {
+	_, creds := web.installationDeps(w, r)
+	if creds == nil {
+		return
+	}
+	apiResponse(w, http.StatusOK, newAPIDeps(*creds))
+}
+
+// SetDepsHandler sets the settings and credentials an installation uses to
+// install private dependencies. Redacted secrets keep their existing value.
+func (web *Web) SetDepsHandler(w http.ResponseWriter, r *http.Request) {
+	install, existing := web.installationDeps(w, r)
+	if existing == nil {
+		return
+	}
+
+	var deps apiDeps
+	if err := json.NewDecoder(r.Body).Decode(&deps); err != nil {
+		apiError(w, http.StatusBadRequest, "could not decode deps: "+err.Error())
+		return
+	}
+
+	creds := db.DepsCredentials{
+		OrgToken:  deps.OrgToken,
+		GOPRIVATE: strings.TrimSpace(deps.GOPRIVATE),
+		GOPROXY:   strings.TrimSpace(deps.GOPROXY),
+		Netrc:     deps.Netrc,
+	}
+	if deps.GOPROXY == redacted {
+		creds.GOPROXY = existing.GOPROXY
+	}
+	if deps.Netrc == redacted {
+		creds.Netrc = existing.Netrc
+	}
+
+	err := web.db.SetDepsCredentials(install.ID, &creds)
+	if errors.Cause(err) == db.ErrNoSecretKey {
+		apiError(w, http.StatusNotImplemented, "credentials cannot be stored, as no secret key is configured")
+		return
+	}
+	if err != nil {
+		log.Printf("error setting deps credentials for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not set deps credentials")
+		return
+	}
+	apiResponse(w, http.StatusOK, newAPIDeps(creds))
+}
+
+// RemoveDepsHandler removes the settings and credentials an installation uses
+// to install private dependencies.
+func (web *Web) RemoveDepsHandler(w http.ResponseWriter, r *http.Request) {
+	install := web.installation(w, r)
+	if install == nil {
+		return
+	}
+
+	if err := web.db.SetDepsCredentials(install.ID, nil); err != nil {
+		log.Printf("error removing deps credentials for installationID %v: %v", install.InstallationID, err)
+		apiError(w, http.StatusInternalServerError, "could not remove deps credentials")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,194 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionCookie is the name of the cookie storing a signed in user's
+	// session.
+	sessionCookie = "gopherci_session"
+	// stateCookie is the name of the cookie storing the OAuth state and the
+	// path to return to, while the user is signing in with GitHub.
+	stateCookie = "gopherci_oauth_state"
+	// sessionDuration is how long a user stays signed in.
+	sessionDuration = 7 * 24 * time.Hour
+)
+
+// Session is a user signed in with their GitHub account.
+type Session struct {
+	UserID  int       `json:"id"`      // UserID is the GitHub user's ID.
+	Login   string    `json:"login"`   // Login is the GitHub user's login when they signed in.
+	Expires time.Time `json:"expires"` // Expires is when the user must sign in again.
+}
+
+// EnableLogin allows users to sign in with their GitHub account, using the
+// integration's OAuth client. Sessions are stored in cookies signed with a key
+// derived from secretKey. baseURL is GopherCI's base URL, which GitHub
+// redirects users back to once they've signed in.
+func (web *Web) EnableLogin(secretKey []byte, baseURL string) {
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte("gopherci session"))
+	web.sessionKey = mac.Sum(nil)
+	web.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// LoginHandler redirects the user to GitHub to sign in, and once signed in,
+// back to the local path in the return parameter.
+func (web *Web) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if web.sessionKey == nil {
+		web.NotFoundHandler(w, r)
+		return
+	}
+
+	returnPath := r.FormValue("return")
+	if !localPath(returnPath) {
+		returnPath = "/"
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("error generating oauth state: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not sign in")
+		return
+	}
+	state := hex.EncodeToString(b)
+
+	web.setCookie(w, stateCookie, web.sign([]byte(state+" "+returnPath)), "/login", 10*time.Minute)
+	http.Redirect(w, r, web.auth.OAuthURL(state, web.baseURL+"/login/callback"), http.StatusFound)
+}
+
+// LoginCallbackHandler signs in the user GitHub redirected back after they
+// authorised GopherCI, and redirects them to the path they signed in from.
+func (web *Web) LoginCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if web.sessionKey == nil {
+		web.NotFoundHandler(w, r)
+		return
+	}
+
+	var state []string
+	if cookie, err := r.Cookie(stateCookie); err == nil {
+		if value, ok := web.verify(cookie.Value); ok {
+			state = strings.SplitN(string(value), " ", 2)
+		}
+	}
+	if len(state) != 2 || subtle.ConstantTimeCompare([]byte(state[0]), []byte(r.FormValue("state"))) != 1 {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid sign in state, please try signing in again")
+		return
+	}
+	web.setCookie(w, stateCookie, "", "/login", -1)
+
+	userID, login, err := web.auth.Login(r.Context(), r.FormValue("code"))
+	if err != nil {
+		log.Printf("error signing in with github: %v", err)
+		web.errorHandler(w, r, http.StatusUnauthorized, "Could not sign in with GitHub")
+		return
+	}
+
+	session, err := json.Marshal(Session{UserID: userID, Login: login, Expires: time.Now().Add(sessionDuration)})
+	if err != nil {
+		log.Printf("error encoding session: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not sign in")
+		return
+	}
+	web.setCookie(w, sessionCookie, web.sign(session), "/", sessionDuration)
+	http.Redirect(w, r, state[1], http.StatusFound)
+}
+
+// LogoutHandler signs out the user, and redirects them to the local path in
+// the return parameter.
+func (web *Web) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		web.errorHandler(w, r, http.StatusForbidden, "Cross origin request denied")
+		return
+	}
+	returnPath := r.FormValue("return")
+	if !localPath(returnPath) {
+		returnPath = "/"
+	}
+	web.setCookie(w, sessionCookie, "", "/", -1)
+	http.Redirect(w, r, returnPath, http.StatusSeeOther)
+}
+
+// session returns the session of the signed in user, or nil if the user isn't
+// signed in, or their session is invalid or has expired.
+func (web *Web) session(r *http.Request) *Session {
+	if web.sessionKey == nil {
+		return nil
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	value, ok := web.verify(cookie.Value)
+	if !ok {
+		return nil
+	}
+	var session Session
+	if err := json.Unmarshal(value, &session); err != nil || time.Now().After(session.Expires) {
+		return nil
+	}
+	return &session
+}
+
+// setCookie sets a cookie with name, value and path, which expires after
+// maxAge, or immediately if maxAge is negative. Cookies can't be read by
+// scripts, and aren't sent with cross site requests which change state.
+func (web *Web) setCookie(w http.ResponseWriter, name, value, path string, maxAge time.Duration) {
+	seconds := int(maxAge / time.Second)
+	if maxAge < 0 {
+		seconds = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   seconds,
+		Secure:   strings.HasPrefix(web.baseURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign returns value and its signature, encoded for use in a cookie.
+func (web *Web) sign(value []byte) string {
+	mac := hmac.New(sha256.New, web.sessionKey)
+	mac.Write(value)
+	return base64.RawURLEncoding.EncodeToString(value) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the value signed by sign, and true if the signature is
+// valid.
+func (web *Web) verify(signed string) ([]byte, bool) {
+	parts := strings.SplitN(signed, ".", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, web.sessionKey)
+	mac.Write(value)
+	return value, hmac.Equal(sig, mac.Sum(nil))
+}
+
+// localPath returns true if path is an absolute path on this host, which is
+// safe to redirect to.
+func localPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, `/\`)
+}
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pressly/chi"
+)
+
+// signedIn returns a session cookie for the user with userID and login.
+func signedIn(web *Web, userID int, login string) *http.Cookie {
+	session, _ := json.Marshal(Session{UserID: userID, Login: login, Expires: time.Now().Add(time.Hour)})
+	return &http.Cookie{Name: sessionCookie, Value: web.sign(session)}
+}
+
+func TestLogin(t *testing.T) {
+	templates, err := template.ParseGlob("templates/*.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error parsing templates: %v", err)
+	}
+
+	web := &Web{auth: mockAuth{"user": 10}, templates: templates}
+	web.EnableLogin([]byte("secret"), "https://example.com/")
+
+	r := chi.NewRouter()
+	r.Get("/login", web.LoginHandler)
+	r.Get("/login/callback", web.LoginCallbackHandler)
+	r.Post("/logout", web.LogoutHandler)
+
+	tests := []struct {
+		returnPath string
+		code       string
+		badState   bool
+		wantCode   int
+		wantPath   string
+	}{
+		{"/analysis/5", "user", false, http.StatusFound, "/analysis/5"},
+		{"//evil.com", "user", false, http.StatusFound, "/"}, // open redirect
+		{"/analysis/5", "user", true, http.StatusBadRequest, ""},
+		{"/analysis/5", "unknown", false, http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/login?return="+url.QueryEscape(test.returnPath), nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("login have code: %v want: %v", w.Code, http.StatusFound)
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("unexpected error parsing location: %v", err)
+		}
+		if have, want := location.Query().Get("redirect_uri"), "https://example.com/login/callback"; have != want {
+			t.Errorf("redirect_uri have: %q want: %q", have, want)
+		}
+		state := location.Query().Get("state")
+		if test.badState {
+			state = "bad"
+		}
+
+		req := httptest.NewRequest("GET", "/login/callback?"+url.Values{"code": {test.code}, "state": {state}}.Encode(), nil)
+		for _, cookie := range w.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.wantCode {
+			t.Errorf("%+v callback have code: %v want: %v", test, w.Code, test.wantCode)
+			continue
+		}
+		if test.wantCode != http.StatusFound {
+			continue
+		}
+		if have := w.Header().Get("Location"); have != test.wantPath {
+			t.Errorf("%+v callback have location: %q want: %q", test, have, test.wantPath)
+		}
+
+		req = httptest.NewRequest("GET", "/", nil)
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == sessionCookie && (!cookie.Secure || !cookie.HttpOnly) {
+				t.Errorf("session cookie must be secure and http only: %+v", cookie)
+			}
+			req.AddCookie(cookie)
+		}
+		if session := web.session(req); session == nil || session.UserID != 10 || session.Login != "user" {
+			t.Errorf("%+v unexpected session: %+v", test, session)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/logout?return=/analysis/5", nil)
+	req.AddCookie(signedIn(web, 10, "user"))
+	r.ServeHTTP(w, req)
+	if have, want := w.Header().Get("Location"), "/analysis/5"; w.Code != http.StatusSeeOther || have != want {
+		t.Errorf("logout have code: %v location: %q want: %v %q", w.Code, have, http.StatusSeeOther, want)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != sessionCookie || cookies[0].MaxAge >= 0 {
+		t.Errorf("logout did not remove session cookie: %+v", cookies)
+	}
+}
+
+func TestSession(t *testing.T) {
+	web := &Web{}
+	web.EnableLogin([]byte("secret"), "https://example.com")
+	other := &Web{}
+	other.EnableLogin([]byte("other"), "https://example.com")
+
+	expired, _ := json.Marshal(Session{UserID: 10, Login: "user", Expires: time.Now().Add(-time.Hour)})
+
+	tests := []struct {
+		cookie *http.Cookie
+		want   bool
+	}{
+		{nil, false},
+		{signedIn(web, 10, "user"), true},
+		{signedIn(other, 10, "user"), false}, // signed with another key
+		{&http.Cookie{Name: sessionCookie, Value: web.sign(expired)}, false},
+		{&http.Cookie{Name: sessionCookie, Value: "garbage"}, false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.cookie != nil {
+			req.AddCookie(test.cookie)
+		}
+		if have := web.session(req) != nil; have != test.want {
+			t.Errorf("cookie: %+v have session: %v want: %v", test.cookie, have, test.want)
+		}
+	}
+}
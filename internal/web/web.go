@@ -5,10 +5,13 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/bradleyfalzon/gopherci/internal/github"
+	"github.com/pkg/errors"
 	"github.com/pressly/chi"
 )
 
@@ -16,11 +19,16 @@ import (
 type Web struct {
 	db        db.DB
 	gh        *github.GitHub
+	auth      Authenticator
+	queue     chan<- interface{} // queue receives jobs such as full scans.
 	templates *template.Template
+
+	sessionKey []byte // sessionKey signs sessions, if nil users cannot sign in.
+	baseURL    string // baseURL is GopherCI's base URL, without a trailing slash.
 }
 
 // NewWeb returns a new Web instance, or an error.
-func NewWeb(db db.DB, gh *github.GitHub) (*Web, error) {
+func NewWeb(db db.DB, gh *github.GitHub, queue chan<- interface{}) (*Web, error) {
 	// Initialise html templates
 	templates, err := template.ParseGlob("internal/web/templates/*.tmpl")
 	if err != nil {
@@ -30,6 +38,8 @@ func NewWeb(db db.DB, gh *github.GitHub) (*Web, error) {
 	web := &Web{
 		db:        db,
 		gh:        gh,
+		auth:      gh,
+		queue:     queue,
 		templates: templates,
 	}
 	return web, nil
@@ -60,7 +70,9 @@ func (web *Web) errorHandler(w http.ResponseWriter, r *http.Request, code int, d
 	}
 }
 
-// AnalysisHandler displays a single analysis.
+// AnalysisHandler displays a single analysis, analyses of private
+// repositories are only displayed to signed in users with access to the
+// repository.
 func (web *Web) AnalysisHandler(w http.ResponseWriter, r *http.Request) {
 	analysisID, err := strconv.ParseInt(chi.URLParam(r, "analysisID"), 10, 32)
 	if err != nil {
@@ -80,12 +92,199 @@ func (web *Web) AnalysisHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	vcs, err := NewVCS(web.gh, analysis)
+	repo, err := web.db.GetRepository(analysis.RepositoryID)
+	if err != nil {
+		log.Printf("error getting repositoryID %v: %v", analysis.RepositoryID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get repository")
+		return
+	}
+	if !web.canView(w, r, analysis.InstallationID, analysis.RepositoryID, repo) {
+		return
+	}
+
+	var page = struct {
+		Title       string
+		Analysis    *db.Analysis
+		Repository  *db.Repository // Repository is the analysis' repository, nil if unknown.
+		Patches     []Patch
+		TotalIssues int
+		Fixed       []db.Issue // Fixed are issues in the previous analysis which are no longer found.
+		Session     *Session   // Session is the signed in user, nil if not signed in.
+		CanLogin    bool       // CanLogin is true if users can sign in, to ignore issues.
+	}{
+		Title:       "Analysis",
+		Analysis:    analysis,
+		Repository:  repo,
+		TotalIssues: len(analysis.Issues()),
+		Session:     web.session(r),
+		CanLogin:    web.sessionKey != nil,
+	}
+
+	// Full scans aren't of a diff, so all issues are listed by tool.
+	if !analysis.FullScan {
+		page.Patches, err = web.analysisPatches(r, analysis)
+		if err != nil {
+			log.Printf("error getting patches for analysisID %v: %v", analysisID, err)
+			web.errorHandler(w, r, http.StatusInternalServerError, "Could not get VCS")
+			return
+		}
+	}
+
+	if analysis.PreviousID != 0 {
+		previous, err := web.db.GetAnalysis(analysis.PreviousID)
+		if err != nil {
+			log.Printf("error getting previous analysisID %v: %v", analysis.PreviousID, err)
+			web.errorHandler(w, r, http.StatusInternalServerError, "Could not get previous analysis")
+			return
+		}
+		if previous != nil {
+			page.Fixed = analysis.FixedIssues(previous)
+		}
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "analysis.tmpl", page); err != nil {
+		log.Printf("error parsing analysis template: %v", err)
+	}
+}
+
+// canView returns true if the user can view analyses of the repository with
+// repositoryID, as seen by the installation with the GitHub installationID.
+// repo is the repository's record, or nil if it hasn't been recorded.
+// Analyses of public repositories are public, analyses of private
+// repositories, or of repositories which haven't been recorded, can only be
+// viewed by signed in users with access to the repository. If false is
+// returned, users who aren't signed in have been redirected to sign in, or a
+// response has already been written to w.
+func (web *Web) canView(w http.ResponseWriter, r *http.Request, installationID, repositoryID int, repo *db.Repository) bool {
+	if repo != nil && !repo.Private {
+		return true
+	}
+
+	session := web.session(r)
+	if session == nil {
+		if web.sessionKey == nil {
+			web.NotFoundHandler(w, r)
+			return false
+		}
+		http.Redirect(w, r, "/login?return="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return false
+	}
+
+	perm, err := web.auth.RepositoryPermission(r.Context(), installationID, repositoryID, session.Login)
+	if err != nil {
+		log.Printf("error getting permission of %v to repositoryID %v: %v", session.Login, repositoryID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get repository permission")
+		return false
+	}
+	if perm != "admin" && perm != "write" && perm != "read" {
+		// Respond with not found to avoid disclosing which private
+		// repositories have been analysed.
+		web.NotFoundHandler(w, r)
+		return false
+	}
+	return true
+}
+
+// issueSuppression returns a suppression for the issue with issueID in
+// analysis, or nil if the analysis has no such issue, or the issue has no
+// fingerprint.
+func issueSuppression(analysis *db.Analysis, issueID int) *db.Suppression {
+	for _, issue := range analysis.Issues() {
+		if issue.ID == issueID && issue.Fingerprint != "" {
+			return &db.Suppression{
+				RepositoryID: analysis.RepositoryID,
+				Fingerprint:  issue.Fingerprint,
+				Issue:        issue.Issue,
+			}
+		}
+	}
+	return nil
+}
+
+// IgnoreIssueHandler suppresses an issue from the analysis page, so it's no
+// longer reported in the analysis' repository. The user must be signed in with
+// GitHub, and have write access to the repository.
+func (web *Web) IgnoreIssueHandler(w http.ResponseWriter, r *http.Request) {
+	analysisID, err := strconv.ParseInt(chi.URLParam(r, "analysisID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid analysis ID")
+		return
+	}
+	issueID, err := strconv.ParseInt(chi.URLParam(r, "issueID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid issue ID")
+		return
+	}
+
+	analysis, err := web.db.GetAnalysis(int(analysisID))
+	if err != nil {
+		log.Printf("error getting analysisID %v: %v", analysisID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get analysis")
+		return
+	}
+	if analysis == nil {
+		web.NotFoundHandler(w, r)
+		return
+	}
+	suppression := issueSuppression(analysis, int(issueID))
+	if suppression == nil {
+		web.errorHandler(w, r, http.StatusNotFound, "Issue not found")
+		return
+	}
+
+	if !sameOrigin(r) {
+		web.errorHandler(w, r, http.StatusForbidden, "Cross origin request denied")
+		return
+	}
+	session := web.session(r)
+	if session == nil {
+		web.errorHandler(w, r, http.StatusUnauthorized, "Sign in with GitHub to ignore issues")
+		return
+	}
+	perm, err := web.auth.RepositoryPermission(r.Context(), analysis.InstallationID, analysis.RepositoryID, session.Login)
 	if err != nil {
-		log.Printf("error getting VCS for analysisID %v: %v", analysisID, err)
-		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get VCS")
+		log.Printf("error getting permission of %v to repositoryID %v: %v", session.Login, analysis.RepositoryID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get repository permission")
 		return
 	}
+	if perm != "admin" && perm != "write" {
+		web.errorHandler(w, r, http.StatusForbidden, "Only users with write access to this repository can ignore issues")
+		return
+	}
+	install, err := web.db.GetGHInstallation(analysis.InstallationID)
+	if err != nil {
+		log.Printf("error getting installationID %v: %v", analysis.InstallationID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get installation")
+		return
+	}
+	if install == nil {
+		web.errorHandler(w, r, http.StatusNotFound, "Installation not found")
+		return
+	}
+
+	suppression.InstallationID = install.ID
+	suppression.Reason = strings.TrimSpace(r.PostFormValue("reason"))
+	suppression.CreatedBy = session.UserID
+	err = web.db.AddSuppression(suppression)
+	if verr, ok := err.(*db.ValidationError); ok {
+		web.errorHandler(w, r, http.StatusBadRequest, "Could not ignore issue, "+verr.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("error adding suppression: %v", err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not ignore issue")
+		return
+	}
+	http.Redirect(w, r, analysis.HTMLURL(""), http.StatusSeeOther)
+}
+
+// analysisPatches returns the patches of the analysis' diff, with the issues
+// on the lines they were found.
+func (web *Web) analysisPatches(r *http.Request, analysis *db.Analysis) ([]Patch, error) {
+	vcs, err := NewVCS(web.gh, analysis)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get VCS")
+	}
 
 	// TODO there may be a scenario where a diff isn't return (after a forced
 	// push?), if so, we should just give the template the issues to render.
@@ -93,32 +292,48 @@ func (web *Web) AnalysisHandler(w http.ResponseWriter, r *http.Request) {
 
 	diffReader, err := vcs.Diff(r.Context(), analysis.RepositoryID, analysis.CommitFrom, analysis.CommitTo, analysis.RequestNumber)
 	if err != nil {
-		log.Printf("error getting diff from VCS for analysisID %v: %v", analysisID, err)
-		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get VCS")
-		return
+		return nil, errors.Wrap(err, "could not get diff from VCS")
 	}
 	defer diffReader.Close()
 
 	patches, err := DiffIssues(r.Context(), diffReader, analysis.Issues())
+	return patches, errors.Wrap(err, "could not read VCS")
+}
+
+// BaselineHandler redirects to the latest full scan of a repository, which
+// for private repositories requires the user to have access to the
+// repository.
+func (web *Web) BaselineHandler(w http.ResponseWriter, r *http.Request) {
+	repositoryID, err := strconv.ParseInt(chi.URLParam(r, "repositoryID"), 10, 32)
 	if err != nil {
-		log.Printf("error reading vcs with analysisID %v: %v", analysisID, err)
-		web.errorHandler(w, r, http.StatusInternalServerError, "Could not read VCS")
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid repository ID")
 		return
 	}
 
-	var page = struct {
-		Title       string
-		Analysis    *db.Analysis
-		Patches     []Patch
-		TotalIssues int
-	}{
-		Title:       "Analysis",
-		Analysis:    analysis,
-		Patches:     patches,
-		TotalIssues: len(analysis.Issues()),
+	repo, err := web.db.GetRepository(int(repositoryID))
+	if err != nil {
+		log.Printf("error getting repositoryID %v: %v", repositoryID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get repository")
+		return
 	}
 
-	if err := web.templates.ExecuteTemplate(w, "analysis.tmpl", page); err != nil {
-		log.Printf("error parsing analysis template: %v", err)
+	analysis, err := web.db.GetLatestFullScan(int(repositoryID))
+	if err != nil {
+		log.Printf("error getting latest full scan for repositoryID %v: %v", repositoryID, err)
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get baseline")
+		return
+	}
+	if analysis == nil {
+		if repo == nil || repo.Private {
+			// Don't disclose whether private repositories have been scanned.
+			web.NotFoundHandler(w, r)
+			return
+		}
+		web.errorHandler(w, r, http.StatusNotFound, "Repository has not been fully scanned")
+		return
+	}
+	if !web.canView(w, r, analysis.InstallationID, analysis.RepositoryID, repo) {
+		return
 	}
+	http.Redirect(w, r, analysis.HTMLURL(""), http.StatusFound)
 }
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/pressly/chi"
+)
+
+func TestIgnoreIssueHandler(t *testing.T) {
+	templates, err := template.ParseGlob("templates/*.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error parsing templates: %v", err)
+	}
+
+	fingerprint := strings.Repeat("a", 40)
+	memDB := db.NewMockDB()
+	memDB.AddGHInstallation(1, 10, 11)
+	analysis := db.NewAnalysis()
+	analysis.ID, analysis.InstallationID, analysis.RepositoryID = 5, 1, 100
+	analysis.Tools[1] = db.AnalysisTool{Issues: []db.Issue{{ID: 1, Issue: "golint: issue", Fingerprint: fingerprint}}}
+	memDB.Analyses = map[int]*db.Analysis{analysis.ID: analysis}
+
+	web := &Web{db: memDB, auth: mockAuth{"writer": 10, "writer write": 100, "reader": 20, "reader read": 100}, templates: templates}
+	web.EnableLogin([]byte("secret"), "https://example.com")
+	r := chi.NewRouter()
+	r.Post("/analysis/:analysisID/issues/:issueID/ignore", web.IgnoreIssueHandler)
+
+	tests := []struct {
+		url    string
+		login  string // login is the signed in user, empty if not signed in
+		origin string
+		want   int
+	}{
+		{"/analysis/6/issues/1/ignore", "writer", "", http.StatusNotFound},
+		{"/analysis/5/issues/2/ignore", "writer", "", http.StatusNotFound},
+		{"/analysis/5/issues/1/ignore", "", "", http.StatusUnauthorized},
+		{"/analysis/5/issues/1/ignore", "writer", "https://evil.com", http.StatusForbidden},
+		{"/analysis/5/issues/1/ignore", "reader", "", http.StatusForbidden},
+		{"/analysis/5/issues/1/ignore", "writer", "", http.StatusSeeOther},
+	}
+	for _, test := range tests {
+		form := url.Values{"reason": {"false positive"}}
+		req := httptest.NewRequest("POST", test.url, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.login != "" {
+			req.AddCookie(signedIn(web, mockAuth{"writer": 10, "reader": 20}[test.login], test.login))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("url: %v login: %v origin: %v have code: %v want: %v", test.url, test.login, test.origin, w.Code, test.want)
+		}
+	}
+
+	if suppressed, _ := memDB.SuppressedFingerprints(100); len(suppressed) != 1 || !suppressed[fingerprint] {
+		t.Errorf("unexpected suppressed fingerprints: %v", suppressed)
+	}
+	if have := memDB.Suppressions[0]; have.CreatedBy != 10 || have.Reason != "false positive" {
+		t.Errorf("unexpected suppression: %+v", have)
+	}
+}
+
+func TestAnalysisHandler_private(t *testing.T) {
+	templates, err := template.ParseGlob("templates/*.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error parsing templates: %v", err)
+	}
+
+	memDB := db.NewMockDB()
+	memDB.AddGHInstallation(1, 10, 11)
+	analysis := db.NewAnalysis()
+	analysis.ID, analysis.InstallationID, analysis.RepositoryID, analysis.FullScan = 5, 1, 100, true
+	memDB.Analyses = map[int]*db.Analysis{analysis.ID: analysis}
+
+	web := &Web{db: memDB, auth: mockAuth{"reader read": 100}, templates: templates}
+	r := chi.NewRouter()
+	r.Get("/analysis/:analysisID", web.AnalysisHandler)
+
+	tests := []struct {
+		repo     *db.Repository
+		login    bool   // login is true if users can sign in
+		user     string // user is the signed in user, empty if not signed in
+		want     int
+		location string
+	}{
+		{nil, false, "", http.StatusNotFound, ""}, // repository has not been recorded
+		{nil, true, "", http.StatusFound, "/login?return=%2Fanalysis%2F5"},
+		{nil, true, "stranger", http.StatusNotFound, ""},
+		{nil, true, "reader", http.StatusOK, ""},
+		{&db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo"}, false, "", http.StatusOK, ""},
+		{&db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo", Private: true}, false, "", http.StatusNotFound, ""},
+		{&db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo", Private: true}, true, "", http.StatusFound, "/login?return=%2Fanalysis%2F5"},
+		{&db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo", Private: true}, true, "stranger", http.StatusNotFound, ""},
+		{&db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo", Private: true}, true, "reader", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		web.sessionKey = nil
+		if test.login {
+			web.EnableLogin([]byte("secret"), "https://example.com")
+		}
+		if test.repo != nil {
+			memDB.SetRepository(*test.repo)
+		}
+		req := httptest.NewRequest("GET", "/analysis/5", nil)
+		if test.user != "" {
+			req.AddCookie(signedIn(web, 20, test.user))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("repo: %+v user: %q have code: %v want: %v", test.repo, test.user, w.Code, test.want)
+		}
+		if have := w.Header().Get("Location"); have != test.location {
+			t.Errorf("repo: %+v user: %q have location: %q want: %q", test.repo, test.user, have, test.location)
+		}
+		if test.repo != nil && test.want == http.StatusOK && !strings.Contains(w.Body.String(), "https://github.com/owner/repo") {
+			t.Errorf("repo: %+v missing repository link in body:\n%s", test.repo, w.Body)
+		}
+		if test.user != "" && test.want == http.StatusOK && !strings.Contains(w.Body.String(), "Sign out") {
+			t.Errorf("repo: %+v user: %q missing sign out in body:\n%s", test.repo, test.user, w.Body)
+		}
+	}
+}
+
+func TestBaselineHandler_private(t *testing.T) {
+	templates, err := template.ParseGlob("templates/*.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error parsing templates: %v", err)
+	}
+
+	memDB := db.NewMockDB()
+	memDB.AddGHInstallation(1, 10, 11)
+	analysis := db.NewAnalysis()
+	analysis.ID, analysis.InstallationID, analysis.RepositoryID, analysis.FullScan = 5, 1, 100, true
+	analysis.Status = db.AnalysisStatusSuccess
+	memDB.Analyses = map[int]*db.Analysis{analysis.ID: analysis}
+	memDB.SetRepository(db.Repository{ID: 100, InstallationID: 1, Owner: "owner", Name: "repo", Private: true})
+	memDB.SetRepository(db.Repository{ID: 101, InstallationID: 1, Owner: "owner", Name: "other", Private: true})
+
+	web := &Web{db: memDB, auth: mockAuth{"reader read": 100}, templates: templates}
+	web.EnableLogin([]byte("secret"), "https://example.com")
+	r := chi.NewRouter()
+	r.Get("/repositories/:repositoryID/baseline", web.BaselineHandler)
+
+	tests := []struct {
+		url      string
+		user     string
+		want     int
+		location string
+	}{
+		{"/repositories/100/baseline", "", http.StatusFound, "/login?return=%2Frepositories%2F100%2Fbaseline"},
+		{"/repositories/100/baseline", "stranger", http.StatusNotFound, ""},
+		{"/repositories/100/baseline", "reader", http.StatusFound, "/analysis/5"},
+		{"/repositories/101/baseline", "reader", http.StatusNotFound, ""}, // not scanned
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		if test.user != "" {
+			req.AddCookie(signedIn(web, 20, test.user))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("url: %v user: %q have code: %v want: %v", test.url, test.user, w.Code, test.want)
+		}
+		if have := w.Header().Get("Location"); !strings.HasSuffix(have, test.location) || (test.location == "" && have != "") {
+			t.Errorf("url: %v user: %q have location: %q want: %q", test.url, test.user, have, test.location)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/hex"
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,8 +28,16 @@ import (
 	"github.com/pressly/chi"
 	"github.com/pressly/chi/middleware"
 	migrate "github.com/rubenv/sql-migrate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+// defaultQueueBufferSize is the default number of jobs buffered while waiting
+// to be added to the queue, when full, webhooks are rejected as overloaded.
+const defaultQueueBufferSize = 100
+
 func main() {
 	// Load environment from .env, ignore errors as it's optional and dev only
 	_ = godotenv.Load()
@@ -87,7 +98,17 @@ func main() {
 		log.Fatal(errors.Wrap(err, "could not execute all migrations"))
 	}
 
-	db, err := db.NewSQLDB(sqlDB, os.Getenv("DB_DRIVER"))
+	// Secrets are only stored if there's a key, it's optional for
+	// installations without private dependencies.
+	var secretKey []byte
+	if os.Getenv("GCI_SECRET_KEY") != "" {
+		secretKey, err = hex.DecodeString(os.Getenv("GCI_SECRET_KEY"))
+		if err != nil {
+			log.Fatalln("could not decode GCI_SECRET_KEY:", err)
+		}
+	}
+
+	db, err := db.NewSQLDB(sqlDB, os.Getenv("DB_DRIVER"), secretKey)
 	if err != nil {
 		log.Fatalln("could not initialise db:", err)
 	}
@@ -109,16 +130,63 @@ func main() {
 		if image == "" {
 			image = analyser.DockerDefaultImage
 		}
-		analyse, err = analyser.NewDocker(image)
+		var goImages map[string]string
+		if os.Getenv("ANALYSER_DOCKER_GO_IMAGES") != "" {
+			goImages = make(map[string]string)
+			for _, pair := range strings.Split(os.Getenv("ANALYSER_DOCKER_GO_IMAGES"), ",") {
+				kv := strings.SplitN(pair, "=", 2)
+				if len(kv) != 2 {
+					log.Fatalf("could not parse ANALYSER_DOCKER_GO_IMAGES %q, expected version=image", pair)
+				}
+				goImages[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		analyse, err = analyser.NewDocker(image, goImages)
 		if err != nil {
 			log.Fatalln("could not initialise Docker analyser:", err)
 		}
+	case "sandbox":
+		if os.Getenv("ANALYSER_SANDBOX_PATH") == "" {
+			log.Fatalln("ANALYSER_SANDBOX_PATH is not set")
+		}
+		var binds []string
+		if os.Getenv("ANALYSER_SANDBOX_BINDS") != "" {
+			binds = filepath.SplitList(os.Getenv("ANALYSER_SANDBOX_BINDS"))
+		}
+		analyse, err = analyser.NewSandbox(os.Getenv("ANALYSER_SANDBOX_PATH"), binds)
+		if err != nil {
+			log.Fatalln("could not initialise sandbox analyser:", err)
+		}
+	case "kubernetes":
+		analyse, err = newKubernetesAnalyser()
+		if err != nil {
+			log.Fatalln("could not initialise Kubernetes analyser:", err)
+		}
 	case "":
 		log.Fatalln("ANALYSER is not set")
 	default:
 		log.Fatalf("Unknown ANALYSER option %q", os.Getenv("ANALYSER"))
 	}
 
+	// Reaper removes executers and analyses orphaned by a previous exit
+	if reaper, ok := analyse.(analyser.Reaper); ok {
+		reapAge := defaultReapAge
+		if os.Getenv("ANALYSER_REAP_AGE") != "" {
+			reapAge, err = time.ParseDuration(os.Getenv("ANALYSER_REAP_AGE"))
+			if err != nil {
+				log.Fatalf("could not parse ANALYSER_REAP_AGE %q: %v", os.Getenv("ANALYSER_REAP_AGE"), err)
+			}
+		}
+		retention := defaultDeliveryRetention
+		if os.Getenv("WEBHOOK_DELIVERY_RETENTION") != "" {
+			retention, err = time.ParseDuration(os.Getenv("WEBHOOK_DELIVERY_RETENTION"))
+			if err != nil {
+				log.Fatalf("could not parse WEBHOOK_DELIVERY_RETENTION %q: %v", os.Getenv("WEBHOOK_DELIVERY_RETENTION"), err)
+			}
+		}
+		go Reap(ctx, reaper, db, reapAge, retention)
+	}
+
 	// GitHub
 	log.Printf("GitHub Integration ID: %q, GitHub Integration PEM File: %q", os.Getenv("GITHUB_ID"), os.Getenv("GITHUB_PEM_FILE"))
 	integrationID, err := strconv.ParseInt(os.Getenv("GITHUB_ID"), 10, 64)
@@ -131,13 +199,46 @@ func main() {
 		log.Fatalf("could not read private key for GitHub integration: %s", err)
 	}
 
-	// queuePush is used to add a job to the queue
-	var queuePush = make(chan interface{})
+	// queuePush is used to add a job to the queue, it's buffered so webhooks
+	// aren't delayed while the queuer is busy, such as retrying to publish.
+	queueBufferSize := defaultQueueBufferSize
+	if os.Getenv("QUEUE_BUFFER_SIZE") != "" {
+		size, err := strconv.ParseInt(os.Getenv("QUEUE_BUFFER_SIZE"), 10, 32)
+		if err != nil || size < 0 {
+			log.Fatalf("could not parse QUEUE_BUFFER_SIZE %q", os.Getenv("QUEUE_BUFFER_SIZE"))
+		}
+		queueBufferSize = int(size)
+	}
+	var queuePush = make(chan interface{}, queueBufferSize)
+	expvar.Publish("queue_buffered", expvar.Func(func() interface{} {
+		return len(queuePush)
+	}))
 
 	gh, err := github.New(analyse, db, queuePush, int(integrationID), integrationKey, os.Getenv("GITHUB_WEBHOOK_SECRET"), os.Getenv("GCI_BASE_URL"))
 	if err != nil {
 		log.Fatalln("could not initialise GitHub:", err)
 	}
+	if accounts := os.Getenv("GITHUB_AUTO_APPROVE_ACCOUNTS"); accounts != "" {
+		gh.SetAutoApprove(strings.Split(accounts, ","))
+	}
+	gh.SetTimeouts(envDuration("ANALYSER_CLONE_TIMEOUT"), envDuration("ANALYSER_DEPS_TIMEOUT"), envDuration("ANALYSER_TOOL_TIMEOUT"))
+	if os.Getenv("ANALYSER_TOOL_CONCURRENCY") != "" {
+		concurrency, err := strconv.ParseInt(os.Getenv("ANALYSER_TOOL_CONCURRENCY"), 10, 32)
+		if err != nil || concurrency < 1 {
+			log.Fatalf("could not parse ANALYSER_TOOL_CONCURRENCY %q", os.Getenv("ANALYSER_TOOL_CONCURRENCY"))
+		}
+		gh.SetToolConcurrency(int(concurrency))
+	}
+	// Users sign in with GitHub to ignore issues and to view analyses of
+	// private repositories, which requires the integration's OAuth client,
+	// and a key to sign their sessions.
+	login := os.Getenv("GITHUB_CLIENT_ID") != "" && os.Getenv("GITHUB_CLIENT_SECRET") != ""
+	switch {
+	case login && secretKey == nil:
+		log.Fatalln("GCI_SECRET_KEY is not set, it's required to sign in with GITHUB_CLIENT_ID")
+	case login:
+		gh.SetOAuth(os.Getenv("GITHUB_CLIENT_ID"), os.Getenv("GITHUB_CLIENT_SECRET"))
+	}
 	r.Post("/gh/webhook", gh.WebHookHandler)
 	r.Get("/gh/callback", gh.CallbackHandler)
 
@@ -166,15 +267,69 @@ func main() {
 		log.Fatalf("Unknown QUEUER option %q", os.Getenv("QUEUER"))
 	}
 
+	// Scheduler queues periodic full scans of repositories
+	go Schedule(ctx, db, queuePush)
+
 	// Web routes
-	web, err := web.NewWeb(db, gh)
+	web, err := web.NewWeb(db, gh, queuePush)
 	if err != nil {
 		log.Fatalln("main: error loading web:", err)
 	}
+	if login {
+		web.EnableLogin(secretKey, os.Getenv("GCI_BASE_URL"))
+	}
 	workDir, _ := os.Getwd()
 	r.FileServer("/static", http.Dir(filepath.Join(workDir, "internal", "web", "static")))
 	r.NotFound(web.NotFoundHandler)
 	r.Get("/analysis/:analysisID", web.AnalysisHandler)
+	r.Post("/analysis/:analysisID/issues/:issueID/ignore", web.IgnoreIssueHandler)
+	r.Get("/login", web.LoginHandler)
+	r.Get("/login/callback", web.LoginCallbackHandler)
+	r.Post("/logout", web.LogoutHandler)
+	r.Get("/repositories/:repositoryID/baseline", web.BaselineHandler)
+	r.Route("/api/installations/:installationID/settings", func(r chi.Router) {
+		r.Get("/", web.GetSettingsHandler)
+		r.Put("/", web.SetSettingsHandler)
+	})
+	r.Post("/api/installations/:installationID/scans", web.FullScanHandler)
+	r.Route("/api/installations/:installationID/schedules", func(r chi.Router) {
+		r.Get("/", web.ListSchedulesHandler)
+		r.Put("/", web.SetScheduleHandler)
+		r.Delete("/:scheduleID", web.RemoveScheduleHandler)
+	})
+	r.Route("/api/installations/:installationID/suppressions", func(r chi.Router) {
+		r.Get("/", web.ListSuppressionsHandler)
+		r.Post("/", web.AddSuppressionHandler)
+		r.Delete("/:suppressionID", web.RevokeSuppressionHandler)
+	})
+	r.Route("/api/installations/:installationID/tools", func(r chi.Router) {
+		r.Get("/", web.ListInstallationToolsHandler)
+		r.Post("/", web.AddInstallationToolHandler)
+		r.Put("/:toolID", web.UpdateInstallationToolHandler)
+		r.Delete("/:toolID", web.RemoveInstallationToolHandler)
+	})
+	r.Route("/api/installations/:installationID/deps", func(r chi.Router) {
+		r.Get("/", web.GetDepsHandler)
+		r.Put("/", web.SetDepsHandler)
+		r.Delete("/", web.RemoveDepsHandler)
+	})
+	if os.Getenv("ADMIN_PASSWORD") != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(web.AdminAuth(os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")))
+			r.Get("/tools", web.AdminToolsHandler)
+			r.Post("/tools", web.AdminSaveToolHandler)
+			r.Get("/tools/new", web.AdminNewToolHandler)
+			r.Get("/tools/:toolID", web.AdminEditToolHandler)
+			r.Post("/tools/:toolID", web.AdminSaveToolHandler)
+			r.Post("/tools/:toolID/:action", web.AdminToolActionHandler)
+			r.Get("/installations", web.AdminInstallationsHandler)
+			r.Post("/installations/:installationID/:action", web.AdminInstallationActionHandler)
+			r.Get("/deliveries", web.AdminDeliveriesHandler)
+			r.Get("/deliveries/:guid", web.AdminDeliveryHandler)
+			r.Post("/deliveries/:guid/replay", web.AdminReplayDeliveryHandler)
+			r.Get("/vars", expvar.Handler().ServeHTTP)
+		})
+	}
 
 	// Health checks
 	r.Get("/health-check", HealthCheckHandler)
@@ -213,6 +368,20 @@ func (q *queueProcessor) Process(job interface{}) {
 		if err != nil {
 			err = errors.Wrapf(err, "cannot analyse pr %v", *e.PullRequest.HTMLURL)
 		}
+	case *gh.PullRequestReviewCommentEvent:
+		err = q.github.IgnoreCommentEvent(e)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot ignore issue for comment %v", e.Comment.GetHTMLURL())
+		}
+	case *github.FullScan:
+		var cfg github.AnalyseConfig
+		cfg, err = q.github.FullScanConfig(e)
+		if err == nil {
+			err = q.github.Analyse(cfg)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "cannot analyse full scan of %v/%v@%v", e.Owner, e.Repo, e.Ref)
+		}
 	default:
 		err = fmt.Errorf("unknown queue job type %T", e)
 	}
@@ -221,3 +390,59 @@ func (q *queueProcessor) Process(job interface{}) {
 		log.Println("queueProcessor: processing error:", err)
 	}
 }
+
+// envDuration returns the duration in the environment variable name, or zero
+// if it's empty.
+func envDuration(name string) time.Duration {
+	if os.Getenv(name) == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		log.Fatalf("could not parse %v %q: %v", name, os.Getenv(name), err)
+	}
+	return d
+}
+
+// newKubernetesAnalyser returns a Kubernetes analyser configured from the
+// environment, using KUBECONFIG if set, otherwise the in-cluster config.
+func newKubernetesAnalyser() (*analyser.Kubernetes, error) {
+	var (
+		config *rest.Config
+		err    error
+	)
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load kubernetes config")
+	}
+
+	namespace := os.Getenv("ANALYSER_KUBERNETES_NAMESPACE")
+	if namespace == "" {
+		namespace = analyser.KubernetesDefaultNamespace
+	}
+	image := os.Getenv("ANALYSER_KUBERNETES_IMAGE")
+	if image == "" {
+		image = analyser.DockerDefaultImage
+	}
+
+	requests := make(corev1.ResourceList)
+	for name, env := range map[corev1.ResourceName]string{
+		corev1.ResourceCPU:    "ANALYSER_KUBERNETES_CPU_REQUEST",
+		corev1.ResourceMemory: "ANALYSER_KUBERNETES_MEMORY_REQUEST",
+	} {
+		if os.Getenv(env) == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(os.Getenv(env))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse %v", env)
+		}
+		requests[name] = quantity
+	}
+
+	return analyser.NewKubernetes(config, namespace, image, requests)
+}
@@ -0,0 +1,11 @@
+-- +migrate Up
+
+-- gh_installation_id is the installation a tool is scoped to, NULL tools are
+-- global and used for all installations
+ALTER TABLE tools ADD COLUMN gh_installation_id INT UNSIGNED NULL DEFAULT NULL AFTER id,
+    ADD KEY (gh_installation_id),
+    ADD FOREIGN KEY (gh_installation_id) REFERENCES gh_installations(id) ON DELETE CASCADE;
+
+-- +migrate Down
+ALTER TABLE tools DROP FOREIGN KEY tools_ibfk_1;
+ALTER TABLE tools DROP COLUMN gh_installation_id;
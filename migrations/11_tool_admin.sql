@@ -0,0 +1,11 @@
+-- +migrate Up
+
+-- position orders the tools, lowest first
+ALTER TABLE tools ADD COLUMN position INT NOT NULL DEFAULT 0 AFTER timeout;
+
+-- disabled tools are not used for any analyses
+ALTER TABLE tools ADD COLUMN disabled BOOL NOT NULL DEFAULT FALSE AFTER position;
+
+-- +migrate Down
+ALTER TABLE tools DROP COLUMN disabled;
+ALTER TABLE tools DROP COLUMN position;
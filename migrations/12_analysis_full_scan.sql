@@ -0,0 +1,9 @@
+-- +migrate Up
+
+-- full_scan analyses report all issues in the repository at commit_to
+ALTER TABLE analysis ADD COLUMN full_scan BOOL NOT NULL DEFAULT FALSE AFTER request_number;
+ALTER TABLE analysis ADD INDEX repository_full_scan (repository_id, full_scan);
+
+-- +migrate Down
+ALTER TABLE analysis DROP INDEX repository_full_scan;
+ALTER TABLE analysis DROP COLUMN full_scan;
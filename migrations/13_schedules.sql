@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE schedules (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    gh_installation_id INT UNSIGNED NOT NULL,
+    owner VARCHAR(255) NOT NULL,
+    repo VARCHAR(255) NOT NULL,
+    interval_seconds INT UNSIGNED NOT NULL,
+    next_run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY (gh_installation_id, owner, repo),
+    KEY (next_run_at),
+    FOREIGN KEY (gh_installation_id) REFERENCES gh_installations(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE schedules;
@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- ref is the branch analysed, previous_analysis_id is the analysis issues
+-- were tracked against
+ALTER TABLE analysis ADD COLUMN ref VARCHAR(255) NULL DEFAULT NULL AFTER commit_to,
+    ADD COLUMN previous_analysis_id INT UNSIGNED NULL DEFAULT NULL AFTER full_scan,
+    ADD INDEX repository_ref (repository_id, ref);
+
+-- fingerprint identifies the same issue across analyses, state is whether
+-- the issue was in the previous analysis
+ALTER TABLE issues ADD COLUMN fingerprint CHAR(40) NULL DEFAULT NULL AFTER issue,
+    ADD COLUMN state ENUM("New", "Existing") NULL DEFAULT NULL AFTER fingerprint;
+
+-- +migrate Down
+ALTER TABLE issues DROP COLUMN state, DROP COLUMN fingerprint;
+ALTER TABLE analysis DROP INDEX repository_ref, DROP COLUMN previous_analysis_id, DROP COLUMN ref;
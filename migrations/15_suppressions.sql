@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE suppressions (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    gh_installation_id INT UNSIGNED NOT NULL,
+    repository_id INT UNSIGNED NOT NULL,
+    fingerprint CHAR(40) NOT NULL,
+    issue TEXT NOT NULL,
+    reason VARCHAR(1024) NOT NULL,
+    created_by INT UNSIGNED NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_by INT UNSIGNED NULL DEFAULT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (id),
+    KEY (repository_id, fingerprint),
+    FOREIGN KEY (gh_installation_id) REFERENCES gh_installations(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE suppressions;
@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- single_review submits a pull request's issues as a single review, instead
+-- of a separate comment for each issue
+ALTER TABLE gh_installations ADD COLUMN single_review BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +migrate Down
+ALTER TABLE gh_installations DROP COLUMN single_review;
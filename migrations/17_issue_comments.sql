@@ -0,0 +1,23 @@
+-- +migrate Up
+
+-- issue_comments are the pull request comments written for issues, so the
+-- comments can be updated once the issues are fixed
+CREATE TABLE issue_comments (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    gh_installation_id INT UNSIGNED NOT NULL,
+    repository_id INT UNSIGNED NOT NULL,
+    request_number INT UNSIGNED NOT NULL,
+    tool_id INT UNSIGNED NOT NULL,
+    comment_id INT UNSIGNED NOT NULL,
+    fingerprint CHAR(40) NOT NULL,
+    issue TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    fixed_in VARCHAR(40) NULL DEFAULT NULL,
+    fixed_at TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (id),
+    KEY (repository_id, request_number),
+    FOREIGN KEY (gh_installation_id) REFERENCES gh_installations(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE issue_comments;
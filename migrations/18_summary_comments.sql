@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- summary_comments are the pull request comments summarising the latest
+-- analysis of each pull request, which are edited by each analysis
+CREATE TABLE summary_comments (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    gh_installation_id INT UNSIGNED NOT NULL,
+    repository_id INT UNSIGNED NOT NULL,
+    request_number INT UNSIGNED NOT NULL,
+    comment_id INT UNSIGNED NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY (repository_id, request_number),
+    FOREIGN KEY (gh_installation_id) REFERENCES gh_installations(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE summary_comments;
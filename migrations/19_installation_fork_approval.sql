@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- fork_approval requires pull requests from forks by first time contributors
+-- to be approved by a maintainer before they're analysed
+ALTER TABLE gh_installations ADD COLUMN fork_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +migrate Down
+ALTER TABLE gh_installations DROP COLUMN fork_approval;
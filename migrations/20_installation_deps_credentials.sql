@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- deps_credentials are the settings and credentials used to install private
+-- dependencies, as JSON encrypted with the secret key
+ALTER TABLE gh_installations ADD COLUMN deps_credentials BLOB NULL;
+
+-- +migrate Down
+ALTER TABLE gh_installations DROP COLUMN deps_credentials;
@@ -0,0 +1,20 @@
+-- +migrate Up
+
+-- repositories are the repositories covered by installations, tracked from
+-- webhook events, so analyses refer to their names, and analyses of private
+-- repositories are hidden
+CREATE TABLE repositories (
+    id INT UNSIGNED NOT NULL,
+    gh_installation_id INT UNSIGNED NULL DEFAULT NULL,
+    owner VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    private BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (gh_installation_id),
+    FOREIGN KEY (gh_installation_id) REFERENCES gh_installations(id) ON DELETE SET NULL
+);
+
+-- +migrate Down
+DROP TABLE repositories;
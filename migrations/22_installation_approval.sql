@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- denied_at is set when an operator denies an installation, denied
+-- installations are not analysed and are no longer awaiting approval
+ALTER TABLE gh_installations ADD COLUMN denied_at TIMESTAMP NULL DEFAULT NULL AFTER enabled_at;
+
+-- +migrate Down
+ALTER TABLE gh_installations DROP COLUMN denied_at;
@@ -0,0 +1,23 @@
+-- +migrate Up
+
+-- webhook_deliveries records each webhook delivered by GitHub, guid is the
+-- X-GitHub-Delivery header, NULL for invalid deliveries as it cannot be
+-- trusted, so redeliveries of the same guid update the same row
+CREATE TABLE webhook_deliveries (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    guid VARCHAR(64) NULL DEFAULT NULL,
+    event VARCHAR(64) NOT NULL,
+    payload MEDIUMBLOB NULL DEFAULT NULL,
+    result ENUM("Queued", "Processed", "Ignored", "Invalid", "Error") NOT NULL,
+    error TEXT NOT NULL,
+    duration TIME(3) NOT NULL,
+    attempts INT UNSIGNED NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE guid (guid),
+    INDEX created_at (created_at)
+);
+
+-- +migrate Down
+DROP TABLE webhook_deliveries;
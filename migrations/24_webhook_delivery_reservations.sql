@@ -0,0 +1,9 @@
+-- +migrate Up
+
+-- Pending deliveries have been reserved by a webhook and are being handled,
+-- so concurrent redeliveries of the same guid are not handled twice
+ALTER TABLE webhook_deliveries MODIFY result ENUM("Pending", "Queued", "Processed", "Ignored", "Invalid", "Error") NOT NULL;
+
+-- +migrate Down
+DELETE FROM webhook_deliveries WHERE result = "Pending";
+ALTER TABLE webhook_deliveries MODIFY result ENUM("Queued", "Processed", "Ignored", "Invalid", "Error") NOT NULL;
@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- repository_id is the repository in the delivery's payload, if any, so a
+-- repository's deliveries can be removed with the rest of its data
+ALTER TABLE webhook_deliveries ADD COLUMN repository_id INT UNSIGNED NULL DEFAULT NULL AFTER event, ADD INDEX repository_id (repository_id);
+
+-- +migrate Down
+ALTER TABLE webhook_deliveries DROP COLUMN repository_id;
@@ -0,0 +1,19 @@
+-- +migrate Up
+
+-- fork_approvals are the head commits of pull requests from forks which were
+-- approved for analysis, so commits pushed after the approval are not
+-- analysed until they're approved too
+CREATE TABLE fork_approvals (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    gh_installation_id INT UNSIGNED NOT NULL,
+    repository_id INT UNSIGNED NOT NULL,
+    request_number INT UNSIGNED NOT NULL,
+    sha CHAR(40) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY (repository_id, request_number, sha),
+    FOREIGN KEY (gh_installation_id) REFERENCES gh_installations(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE fork_approvals;
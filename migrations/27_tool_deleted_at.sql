@@ -0,0 +1,9 @@
+-- +migrate Up
+
+-- deleted_at is set when a tool is removed, removed tools are kept so the
+-- analyses which used them aren't removed
+ALTER TABLE tools ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL AFTER disabled;
+
+-- +migrate Down
+DELETE FROM tools WHERE deleted_at IS NOT NULL;
+ALTER TABLE tools DROP COLUMN deleted_at;
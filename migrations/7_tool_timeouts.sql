@@ -0,0 +1,11 @@
+-- +migrate Up
+
+-- timeout is the maximum duration of a tool, NULL uses the analyser's default
+ALTER TABLE tools ADD COLUMN timeout TIME(3) NULL DEFAULT NULL AFTER `regexp`;
+
+-- status is the result of running an individual tool
+ALTER TABLE analysis_tool ADD COLUMN status ENUM("Success", "Timeout") NOT NULL DEFAULT "Success" AFTER tool_id;
+
+-- +migrate Down
+ALTER TABLE analysis_tool DROP COLUMN status;
+ALTER TABLE tools DROP COLUMN timeout;
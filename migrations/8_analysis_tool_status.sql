@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE analysis_tool MODIFY COLUMN status ENUM("Success", "Failure", "Timeout", "Skipped") NOT NULL DEFAULT "Success";
+
+-- +migrate Down
+UPDATE analysis_tool SET status = "Success" WHERE status IN ("Failure", "Skipped");
+ALTER TABLE analysis_tool MODIFY COLUMN status ENUM("Success", "Timeout") NOT NULL DEFAULT "Success";
@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- go_version is the default version of Go for the installation's repositories
+-- which do not specify their own, NULL uses the analyser's default
+ALTER TABLE gh_installations ADD COLUMN go_version VARCHAR(16) NULL DEFAULT NULL;
+
+-- +migrate Down
+ALTER TABLE gh_installations DROP COLUMN go_version;
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+const (
+	// reapInterval is how often orphaned executers and analyses are reaped.
+	reapInterval = 10 * time.Minute
+	// defaultReapAge is the default age of executers and pending analyses
+	// before they're considered orphaned, it must be longer than the longest
+	// analysis.
+	defaultReapAge = time.Hour
+	// defaultDeliveryRetention is the default age of webhook deliveries
+	// before they're removed.
+	defaultDeliveryRetention = 30 * 24 * time.Hour
+)
+
+// Reap removes executers and marks pending analyses as errored when they're
+// older than age, which are left behind if GopherCI exits during an analysis.
+// Webhook deliveries, and their payloads, older than retention are removed.
+// Reap runs immediately and then every reapInterval until ctx is done.
+func Reap(ctx context.Context, reaper analyser.Reaper, db db.DB, age, retention time.Duration) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		before := time.Now().Add(-age)
+
+		executers, err := reaper.Reap(ctx, before)
+		if err != nil {
+			log.Println("reaper: could not reap executers:", err)
+		}
+
+		analyses, err := db.ExpireAnalyses(before)
+		if err != nil {
+			log.Println("reaper: could not expire analyses:", err)
+		}
+
+		if executers > 0 || analyses > 0 {
+			log.Printf("reaper: removed %d executers and expired %d analyses older than %v", executers, analyses, age)
+		}
+
+		deliveries, err := db.PruneWebhookDeliveries(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("reaper: could not prune webhook deliveries:", err)
+		}
+		if deliveries > 0 {
+			log.Printf("reaper: removed %d webhook deliveries older than %v", deliveries, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/github"
+)
+
+// scheduleInterval is how often due schedules are checked.
+const scheduleInterval = 5 * time.Minute
+
+// scheduleEnqueueTimeout is the maximum duration to wait to add a full scan
+// to a full queue, before the schedule is left due until the next check.
+var scheduleEnqueueTimeout = 10 * time.Second
+
+// Schedule queues a full scan of each repository's default branch when its
+// schedule is due. Schedule runs immediately and then every scheduleInterval
+// until ctx is done.
+func Schedule(ctx context.Context, db db.DB, queue chan<- interface{}) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		queueSchedules(ctx, db, queue, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queueSchedules queues a full scan for each schedule due at now, which has
+// not already been claimed by another instance.
+func queueSchedules(ctx context.Context, db db.DB, queue chan<- interface{}, now time.Time) {
+	schedules, err := db.DueSchedules(now)
+	if err != nil {
+		log.Println("scheduler: could not get due schedules:", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		// The next run is stored to the second, so the claim can be released
+		// using the same time.
+		next := now.Add(schedule.Interval).Truncate(time.Second)
+		claimed, err := db.ClaimSchedule(schedule, next)
+		if err != nil {
+			log.Printf("scheduler: could not claim scheduleID %v: %v", schedule.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		log.Printf("scheduler: queueing full scan of %v/%v", schedule.Owner, schedule.Repo)
+		job := &github.FullScan{InstallationID: schedule.GHInstallationID, Owner: schedule.Owner, Repo: schedule.Repo}
+		if !enqueueSchedule(ctx, queue, job) {
+			// Release the claim so the schedule is still due.
+			log.Printf("scheduler: could not queue full scan of %v/%v: queue is full", schedule.Owner, schedule.Repo)
+			claimed := schedule
+			claimed.NextRunAt = next
+			if _, err := db.ClaimSchedule(claimed, schedule.NextRunAt); err != nil {
+				log.Printf("scheduler: could not release scheduleID %v: %v", schedule.ID, err)
+			}
+			return
+		}
+	}
+}
+
+// enqueueSchedule adds job to the queue, returning false if the queue
+// remained full for scheduleEnqueueTimeout or ctx is done.
+func enqueueSchedule(ctx context.Context, queue chan<- interface{}, job interface{}) bool {
+	timer := time.NewTimer(scheduleEnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case queue <- job:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
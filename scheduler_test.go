@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/github"
+)
+
+func TestQueueSchedules(t *testing.T) {
+	now := time.Now()
+	memDB := db.NewMockDB()
+	memDB.Schedules = []db.Schedule{
+		{ID: 1, GHInstallationID: 10, Owner: "owner", Repo: "due", Interval: time.Hour, NextRunAt: now.Add(-time.Minute)},
+		{ID: 2, GHInstallationID: 10, Owner: "owner", Repo: "later", Interval: time.Hour, NextRunAt: now.Add(time.Minute)},
+	}
+
+	queue := make(chan interface{}, 2)
+	queueSchedules(context.Background(), memDB, queue, now)
+
+	if len(queue) != 1 {
+		t.Fatalf("queued %v jobs, want 1", len(queue))
+	}
+	want := &github.FullScan{InstallationID: 10, Owner: "owner", Repo: "due"}
+	if have := <-queue; !reflect.DeepEqual(have, want) {
+		t.Errorf("queued job\nhave: %#v\nwant: %#v", have, want)
+	}
+	if have, want := memDB.Schedules[0].NextRunAt, now.Add(time.Hour).Truncate(time.Second); !have.Equal(want) {
+		t.Errorf("next run have: %v want: %v", have, want)
+	}
+
+	// Already claimed, so nothing is queued
+	queueSchedules(context.Background(), memDB, queue, now)
+	if len(queue) != 0 {
+		t.Errorf("queued %v jobs, want 0", len(queue))
+	}
+}
+
+func TestQueueSchedules_queueFull(t *testing.T) {
+	defer func(timeout time.Duration) { scheduleEnqueueTimeout = timeout }(scheduleEnqueueTimeout)
+	scheduleEnqueueTimeout = time.Millisecond
+
+	now := time.Now()
+	due := now.Add(-time.Minute)
+	memDB := db.NewMockDB()
+	memDB.Schedules = []db.Schedule{
+		{ID: 1, GHInstallationID: 10, Owner: "owner", Repo: "due", Interval: time.Hour, NextRunAt: due},
+	}
+
+	queue := make(chan interface{}) // unbuffered and never received
+	queueSchedules(context.Background(), memDB, queue, now)
+
+	// The schedule is still due, so it's queued on the next check.
+	if have := memDB.Schedules[0].NextRunAt; !have.Equal(due) {
+		t.Errorf("next run have: %v want: %v", have, due)
+	}
+}